@@ -0,0 +1,217 @@
+package generator
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"image"
+	"image/color"
+	_ "image/jpeg"
+	"image/png"
+	"time"
+)
+
+// Fake renders placeholder pictures locally. The same request always gives the same pictures,
+// which makes it useful for development without a runware account.
+type Fake struct {
+	// Delay imitates the time the real service spends on generation.
+	Delay time.Duration
+}
+
+func NewFake(delay time.Duration) *Fake {
+	return &Fake{Delay: delay}
+}
+
+func (f *Fake) Generate(ctx context.Context, req Request) (*Result, error) {
+	if req.Width <= 0 || req.Height <= 0 || req.NumberResults <= 0 {
+		return nil, fmt.Errorf("invalid request: %dx%d, %d results", req.Width, req.Height, req.NumberResults)
+	}
+	select {
+	case <-time.After(f.Delay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	seed := req.Seed
+	if seed == 0 {
+		seed = fakeSeed(req)
+	}
+	var source image.Image
+	if len(req.SeedImage) > 0 {
+		var err error
+		if source, _, err = image.Decode(bytes.NewReader(req.SeedImage)); err != nil {
+			return nil, fmt.Errorf("decode seed image: %w", err)
+		}
+	}
+	result := &Result{Seed: seed}
+	for i := 0; i < req.NumberResults; i++ {
+		// Как и у runware, следующие картинки получают seed+1, seed+2...
+		imageSeed := seed + int64(i)
+		imageBytes, err := renderPlaceholder(req.Width, req.Height, uint32(imageSeed), source, req.Strength)
+		if err != nil {
+			return nil, err
+		}
+		result.Images = append(result.Images, Image{
+			Bytes: imageBytes,
+			Seed:  imageSeed,
+		})
+	}
+	return result, nil
+}
+
+// Ping reports only cancellation, Fake has no service to reach.
+func (f *Fake) Ping(ctx context.Context) error {
+	return ctx.Err()
+}
+
+// Close does nothing, Fake holds no connections.
+func (f *Fake) Close() error {
+	return nil
+}
+
+// Upscale stretches the picture with nearest-neighbour scaling.
+func (f *Fake) Upscale(ctx context.Context, req UpscaleRequest) (*Image, error) {
+	if req.Factor < 2 || req.Factor > 4 {
+		return nil, fmt.Errorf("invalid upscale factor %d", req.Factor)
+	}
+	src, err := f.decode(ctx, req.Image)
+	if err != nil {
+		return nil, err
+	}
+	bounds := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, bounds.Dx()*req.Factor, bounds.Dy()*req.Factor))
+	for y := 0; y < dst.Bounds().Dy(); y++ {
+		for x := 0; x < dst.Bounds().Dx(); x++ {
+			dst.Set(x, y, src.At(bounds.Min.X+x/req.Factor, bounds.Min.Y+y/req.Factor))
+		}
+	}
+	return encodePNG(dst)
+}
+
+// RemoveBackground makes transparent every pixel close to the color of the top left corner.
+func (f *Fake) RemoveBackground(ctx context.Context, req RemoveBackgroundRequest) (*Image, error) {
+	src, err := f.decode(ctx, req.Image)
+	if err != nil {
+		return nil, err
+	}
+	bounds := src.Bounds()
+	background := color.RGBAModel.Convert(src.At(bounds.Min.X, bounds.Min.Y)).(color.RGBA)
+	dst := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	for y := 0; y < bounds.Dy(); y++ {
+		for x := 0; x < bounds.Dx(); x++ {
+			c := color.NRGBAModel.Convert(src.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.NRGBA)
+			if near(c.R, background.R) && near(c.G, background.G) && near(c.B, background.B) {
+				c.A = 0
+			}
+			dst.SetNRGBA(x, y, c)
+		}
+	}
+	return encodePNG(dst)
+}
+
+func near(a, b uint8) bool {
+	d := int(a) - int(b)
+	return d > -32 && d < 32
+}
+
+// EnhancePrompt appends a fixed set of quality words.
+func (f *Fake) EnhancePrompt(ctx context.Context, req EnhanceRequest) (string, error) {
+	select {
+	case <-time.After(f.Delay / 2):
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+	return req.Prompt + ", highly detailed, sharp focus, soft natural lighting, professional photo", nil
+}
+
+// Caption describes the size and the average color of the picture.
+func (f *Fake) Caption(ctx context.Context, req CaptionRequest) (string, error) {
+	src, err := f.decode(ctx, req.Image)
+	if err != nil {
+		return "", err
+	}
+	bounds := src.Bounds()
+	var r, g, b, n int
+	// Достаточно каждого восьмого пикселя
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += 8 {
+		for x := bounds.Min.X; x < bounds.Max.X; x += 8 {
+			c := color.RGBAModel.Convert(src.At(x, y)).(color.RGBA)
+			r, g, b, n = r+int(c.R), g+int(c.G), b+int(c.B), n+1
+		}
+	}
+	return fmt.Sprintf("an abstract picture %dx%d in shades of rgb(%d, %d, %d)", bounds.Dx(), bounds.Dy(), r/n, g/n, b/n), nil
+}
+
+// decode waits for Delay and decodes the input picture. Fake keeps nothing, so only bytes are accepted.
+func (f *Fake) decode(ctx context.Context, input InputImage) (image.Image, error) {
+	if len(input.Bytes) == 0 {
+		return nil, errors.New("fake generator needs image bytes")
+	}
+	select {
+	case <-time.After(f.Delay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	src, _, err := image.Decode(bytes.NewReader(input.Bytes))
+	if err != nil {
+		return nil, fmt.Errorf("decode image: %w", err)
+	}
+	return src, nil
+}
+
+func encodePNG(img image.Image) (*Image, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return &Image{Bytes: buf.Bytes()}, nil
+}
+
+// fakeSeed stands in for a random seed, so the same request still gives the same picture.
+func fakeSeed(req Request) int64 {
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%s|%s|%s|%d|%s|%g", req.PositivePrompt, req.NegativePrompt, req.Model, req.Steps, req.Scheduler, req.CFGScale)
+	return int64(h.Sum32()>>1) + 1
+}
+
+// renderPlaceholder draws a diagonal gradient between two colors derived from seed.
+// If source is set, it is stretched to the picture and mixed with the gradient by strength.
+func renderPlaceholder(width, height int, seed uint32, source image.Image, strength float64) ([]byte, error) {
+	from := color.RGBA{uint8(seed), uint8(seed >> 8), uint8(seed >> 16), 255}
+	to := color.RGBA{255 - from.R, 255 - from.G, 255 - from.B, 255}
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	total := width + height
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			t := (x + y) * 255 / total
+			c := color.RGBA{
+				R: mix(from.R, to.R, t),
+				G: mix(from.G, to.G, t),
+				B: mix(from.B, to.B, t),
+				A: 255,
+			}
+			if source != nil {
+				bounds := source.Bounds()
+				sx := bounds.Min.X + x*bounds.Dx()/width
+				sy := bounds.Min.Y + y*bounds.Dy()/height
+				src := color.RGBAModel.Convert(source.At(sx, sy)).(color.RGBA)
+				s := int(strength * 255)
+				c = color.RGBA{R: mix(src.R, c.R, s), G: mix(src.G, c.G, s), B: mix(src.B, c.B, s), A: 255}
+			}
+			img.SetRGBA(x, y, c)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func mix(a, b uint8, t int) uint8 {
+	return uint8((int(a)*(255-t) + int(b)*t) / 255)
+}
@@ -0,0 +1,107 @@
+package generator
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func fakeRequest() Request {
+	return Request{PositivePrompt: "a cat on a sofa", Width: 64, Height: 32, NumberResults: 2, Model: "runware:100@1", Steps: 20}
+}
+
+func TestFakeIsDeterministic(t *testing.T) {
+	fake := NewFake(0)
+	first, err := fake.Generate(context.Background(), fakeRequest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := fake.Generate(context.Background(), fakeRequest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Seed != second.Seed || first.Seed == 0 {
+		t.Errorf("seeds %d and %d", first.Seed, second.Seed)
+	}
+	for i := range first.Images {
+		if !bytes.Equal(first.Images[i].Bytes, second.Images[i].Bytes) {
+			t.Errorf("picture %d differs for the same request", i)
+		}
+	}
+
+	other := fakeRequest()
+	other.PositivePrompt = "a dog on a sofa"
+	third, err := fake.Generate(context.Background(), other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if third.Seed == first.Seed {
+		t.Error("another prompt got the same seed")
+	}
+}
+
+func TestFakeSeedSequence(t *testing.T) {
+	fake := NewFake(0)
+	req := fakeRequest()
+	req.Seed, req.NumberResults = 100, 3
+	result, err := fake.Generate(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Seed != 100 || len(result.Images) != 3 {
+		t.Fatalf("seed %d and %d pictures", result.Seed, len(result.Images))
+	}
+	for i, img := range result.Images {
+		if img.Seed != req.Seed+int64(i) {
+			t.Errorf("picture %d has seed %d", i, img.Seed)
+		}
+		// Картинку можно повторить отдельно по её seed
+		single := req
+		single.Seed, single.NumberResults = img.Seed, 1
+		repeated, err := fake.Generate(context.Background(), single)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(repeated.Images[0].Bytes, img.Bytes) {
+			t.Errorf("picture %d is not repeated by its seed", i)
+		}
+	}
+	if bytes.Equal(result.Images[0].Bytes, result.Images[1].Bytes) {
+		t.Error("pictures of one request are the same")
+	}
+}
+
+func TestFakeRejectsInvalidSizes(t *testing.T) {
+	tests := []struct {
+		name                         string
+		width, height, numberResults int
+	}{
+		{"zero width", 0, 512, 1},
+		{"negative height", 512, -1, 1},
+		{"no results", 512, 512, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := fakeRequest()
+			req.Width, req.Height, req.NumberResults = tt.width, tt.height, tt.numberResults
+			if result, err := NewFake(0).Generate(context.Background(), req); err == nil {
+				t.Errorf("got %d pictures", len(result.Images))
+			}
+		})
+	}
+}
+
+func TestFakeCancelledDuringDelay(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	start := time.Now()
+	_, err := NewFake(time.Minute).Generate(ctx, fakeRequest())
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("error %v, want cancellation", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("returned after %v", elapsed)
+	}
+}
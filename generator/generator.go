@@ -0,0 +1,131 @@
+package generator
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+// Request describes a single generation. With SeedImage set it is an image-to-image generation.
+type Request struct {
+	UserID         int64
+	PositivePrompt string
+	NegativePrompt string
+	Model          string
+	Steps          int
+	Width          int
+	Height         int
+	NumberResults  int
+	Scheduler      string
+	CFGScale       float64
+	// Seed makes the generation reproducible. Zero means a random seed.
+	Seed int64
+	// SeedImage is the source picture (JPEG or PNG) for image-to-image.
+	SeedImage []byte
+	// Strength tells how much the source picture is changed, from 0 (keep) to 1 (ignore it).
+	Strength float64
+}
+
+// Image is one generated picture. Depending on the generator either Bytes or URL is set.
+// UUID is set only when the provider keeps the picture and can process it later.
+type Image struct {
+	UUID  string
+	URL   string
+	Bytes []byte
+	Seed  int64
+}
+
+type Result struct {
+	Images []Image
+	// Seed is the seed actually used for the first image.
+	Seed int64
+	Cost float64
+}
+
+// InputImage is a picture to process: either one kept by the provider (UUID) or raw bytes.
+type InputImage struct {
+	UUID  string
+	Bytes []byte
+}
+
+type UpscaleRequest struct {
+	UserID int64
+	Image  InputImage
+	Factor int
+}
+
+type RemoveBackgroundRequest struct {
+	UserID int64
+	Image  InputImage
+}
+
+type EnhanceRequest struct {
+	UserID int64
+	Prompt string
+}
+
+type CaptionRequest struct {
+	UserID int64
+	Image  InputImage
+}
+
+// ImageGenerator turns a Request into pictures and processes existing ones.
+type ImageGenerator interface {
+	Generate(ctx context.Context, req Request) (*Result, error)
+	Upscale(ctx context.Context, req UpscaleRequest) (*Image, error)
+	// RemoveBackground returns a PNG with a transparent background.
+	RemoveBackground(ctx context.Context, req RemoveBackgroundRequest) (*Image, error)
+	// EnhancePrompt expands a short description into a detailed prompt.
+	EnhancePrompt(ctx context.Context, req EnhanceRequest) (string, error)
+	// Caption describes the picture with text that can be used as a prompt.
+	Caption(ctx context.Context, req CaptionRequest) (string, error)
+	// Ping checks that the provider answers, it is used by the readiness probe.
+	Ping(ctx context.Context) error
+	// Close releases connections to the provider. Running requests fail.
+	Close() error
+}
+
+type taskUUIDKey struct{}
+
+// WithTaskUUID sets the taskUUID of the main task started with the context, so the caller
+// can find the task in its own logs and in the logs of the provider. Helper tasks, like
+// uploading an input image, get their own UUIDs.
+func WithTaskUUID(ctx context.Context, taskUUID string) context.Context {
+	return context.WithValue(ctx, taskUUIDKey{}, taskUUID)
+}
+
+// taskUUID returns the UUID set by WithTaskUUID or a new one.
+func taskUUID(ctx context.Context) string {
+	if id, ok := ctx.Value(taskUUIDKey{}).(string); ok && id != "" {
+		return id
+	}
+	return uuid.NewString()
+}
+
+var ErrEmptyResponse = errors.New("empty response from generator")
+
+// ErrorClass sorts an error of a generator into a few classes for monitoring:
+// cancelled, timeout, provider (rejected by the provider), connection, empty_response and other.
+func ErrorClass(err error) string {
+	var apiErr *apiError
+	var netErr net.Error
+	var closeErr *websocket.CloseError
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, context.Canceled):
+		return "cancelled"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.As(err, &apiErr):
+		return "provider"
+	case errors.Is(err, errConnClosed), errors.As(err, &netErr), errors.As(err, &closeErr):
+		return "connection"
+	case errors.Is(err, ErrEmptyResponse):
+		return "empty_response"
+	}
+	return "other"
+}
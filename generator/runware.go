@@ -0,0 +1,350 @@
+package generator
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// Runware generates pictures through the runware.ai WebSocket API.
+// Every user gets its own connection.
+type Runware struct {
+	apiKey          string
+	mu              sync.Mutex
+	connectionUsers map[int64]*runwareConn
+	// probe is a connection of its own for Ping, so the probe doesn't wait behind user tasks.
+	probe  *runwareConn
+	closed bool
+}
+
+func NewRunware(apiKey string) (*Runware, error) {
+	if apiKey == "" {
+		return nil, errors.New("runware api key is empty")
+	}
+	return &Runware{
+		apiKey:          apiKey,
+		connectionUsers: make(map[int64]*runwareConn),
+		probe:           newRunwareConn(runwareURL, apiKey),
+	}, nil
+}
+
+func (r *Runware) conn(userID int64) *runwareConn {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	conn, exists := r.connectionUsers[userID]
+	if !exists {
+		conn = newRunwareConn(runwareURL, r.apiKey)
+		// После Close новые соединения не открываются
+		conn.closed = r.closed
+		r.connectionUsers[userID] = conn
+	}
+	return conn
+}
+
+// OpenConnections is the number of users with an open WebSocket connection.
+func (r *Runware) OpenConnections() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	count := 0
+	for _, conn := range r.connectionUsers {
+		if conn.connected() {
+			count++
+		}
+	}
+	return count
+}
+
+// Ping opens the probe connection if needed, which authenticates with the API key,
+// and waits for an answer to a WebSocket ping.
+func (r *Runware) Ping(ctx context.Context) error {
+	return r.probe.ping(ctx)
+}
+
+// Close closes the connections of all users.
+func (r *Runware) Close() error {
+	r.mu.Lock()
+	r.closed = true
+	conns := make([]*runwareConn, 0, len(r.connectionUsers))
+	for _, conn := range r.connectionUsers {
+		conns = append(conns, conn)
+	}
+	r.mu.Unlock()
+	for _, conn := range conns {
+		conn.close()
+	}
+	r.probe.close()
+	slog.Info("Runware connections closed", "count", len(conns))
+	return nil
+}
+
+type imageInferenceTask struct {
+	TaskType       string   `json:"taskType"`
+	TaskUUID       string   `json:"taskUUID"`
+	OutputType     []string `json:"outputType,omitempty"`
+	PositivePrompt string   `json:"positivePrompt"`
+	NegativePrompt string   `json:"negativePrompt,omitempty"`
+	Height         int      `json:"height"`
+	Width          int      `json:"width"`
+	Model          string   `json:"model"`
+	Steps          int      `json:"steps,omitempty"`
+	NumberResults  int      `json:"numberResults"`
+	Scheduler      string   `json:"scheduler,omitempty"`
+	CFGScale       float64  `json:"CFGScale,omitempty"`
+	Seed           int64    `json:"seed,omitempty"`
+	SeedImage      string   `json:"seedImage,omitempty"`
+	Strength       float64  `json:"strength,omitempty"`
+	IncludeCost    bool     `json:"includeCost"`
+}
+
+type imageUpscaleTask struct {
+	TaskType      string   `json:"taskType"`
+	TaskUUID      string   `json:"taskUUID"`
+	InputImage    string   `json:"inputImage"`
+	UpscaleFactor int      `json:"upscaleFactor"`
+	OutputType    []string `json:"outputType,omitempty"`
+	IncludeCost   bool     `json:"includeCost"`
+}
+
+type imageBackgroundRemovalTask struct {
+	TaskType     string   `json:"taskType"`
+	TaskUUID     string   `json:"taskUUID"`
+	InputImage   string   `json:"inputImage"`
+	OutputType   []string `json:"outputType,omitempty"`
+	OutputFormat string   `json:"outputFormat,omitempty"`
+	IncludeCost  bool     `json:"includeCost"`
+}
+
+type promptEnhanceTask struct {
+	TaskType        string `json:"taskType"`
+	TaskUUID        string `json:"taskUUID"`
+	Prompt          string `json:"prompt"`
+	PromptMaxLength int    `json:"promptMaxLength"`
+	PromptVersions  int    `json:"promptVersions"`
+	IncludeCost     bool   `json:"includeCost"`
+}
+
+type imageCaptionTask struct {
+	TaskType    string `json:"taskType"`
+	TaskUUID    string `json:"taskUUID"`
+	InputImage  string `json:"inputImage"`
+	IncludeCost bool   `json:"includeCost"`
+}
+
+// textData is a response of tasks that return text.
+type textData struct {
+	Text string  `json:"text"`
+	Cost float64 `json:"cost"`
+}
+
+type imageUploadTask struct {
+	TaskType string `json:"taskType"`
+	TaskUUID string `json:"taskUUID"`
+	Image    string `json:"image"`
+}
+
+type imageData struct {
+	ImageUUID string  `json:"imageUUID"`
+	ImageURL  string  `json:"imageURL"`
+	Seed      int64   `json:"seed"`
+	Cost      float64 `json:"cost"`
+}
+
+func (r *Runware) Generate(ctx context.Context, req Request) (*Result, error) {
+	task := imageInferenceTask{
+		TaskType:       "imageInference",
+		TaskUUID:       taskUUID(ctx),
+		OutputType:     []string{"URL"},
+		PositivePrompt: req.PositivePrompt,
+		NegativePrompt: req.NegativePrompt,
+		Height:         req.Height,
+		Width:          req.Width,
+		Model:          req.Model,
+		Steps:          req.Steps,
+		NumberResults:  req.NumberResults,
+		Scheduler:      req.Scheduler,
+		CFGScale:       req.CFGScale,
+		Seed:           req.Seed,
+		IncludeCost:    true,
+	}
+	// "Default" означает, что runware выберет планировщик сам
+	if task.Scheduler == "Default" {
+		task.Scheduler = ""
+	}
+	if len(req.SeedImage) > 0 {
+		imageUUID, err := r.uploadImage(ctx, req.UserID, req.SeedImage)
+		if err != nil {
+			return nil, fmt.Errorf("upload seed image: %w", err)
+		}
+		task.SeedImage = imageUUID
+		task.Strength = req.Strength
+	}
+
+	data, err := r.conn(req.UserID).do(ctx, task.TaskUUID, task, req.NumberResults)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, ErrEmptyResponse
+	}
+
+	result := &Result{}
+	for i, raw := range data {
+		var img imageData
+		if err := json.Unmarshal(raw, &img); err != nil {
+			return nil, fmt.Errorf("decode image: %w", err)
+		}
+		if img.ImageURL == "" {
+			return nil, ErrEmptyResponse
+		}
+		if i == 0 {
+			result.Seed = img.Seed
+		}
+		result.Cost += img.Cost
+		result.Images = append(result.Images, Image{
+			UUID: img.ImageUUID,
+			URL:  img.ImageURL,
+			Seed: img.Seed,
+		})
+	}
+	return result, nil
+}
+
+func (r *Runware) Upscale(ctx context.Context, req UpscaleRequest) (*Image, error) {
+	if req.Factor < 2 || req.Factor > 4 {
+		return nil, fmt.Errorf("invalid upscale factor %d", req.Factor)
+	}
+	inputImage, err := r.inputImage(ctx, req.UserID, req.Image)
+	if err != nil {
+		return nil, err
+	}
+	task := imageUpscaleTask{
+		TaskType:      "imageUpscale",
+		TaskUUID:      taskUUID(ctx),
+		InputImage:    inputImage,
+		UpscaleFactor: req.Factor,
+		OutputType:    []string{"URL"},
+		IncludeCost:   true,
+	}
+	return r.processImage(ctx, req.UserID, task.TaskUUID, task)
+}
+
+func (r *Runware) RemoveBackground(ctx context.Context, req RemoveBackgroundRequest) (*Image, error) {
+	inputImage, err := r.inputImage(ctx, req.UserID, req.Image)
+	if err != nil {
+		return nil, err
+	}
+	task := imageBackgroundRemovalTask{
+		TaskType:     "imageBackgroundRemoval",
+		TaskUUID:     taskUUID(ctx),
+		InputImage:   inputImage,
+		OutputType:   []string{"URL"},
+		OutputFormat: "PNG", // Только PNG сохраняет прозрачность
+		IncludeCost:  true,
+	}
+	return r.processImage(ctx, req.UserID, task.TaskUUID, task)
+}
+
+func (r *Runware) EnhancePrompt(ctx context.Context, req EnhanceRequest) (string, error) {
+	task := promptEnhanceTask{
+		TaskType:        "promptEnhance",
+		TaskUUID:        taskUUID(ctx),
+		Prompt:          req.Prompt,
+		PromptMaxLength: 300,
+		PromptVersions:  1,
+		IncludeCost:     true,
+	}
+	return r.processText(ctx, req.UserID, task.TaskUUID, task)
+}
+
+func (r *Runware) Caption(ctx context.Context, req CaptionRequest) (string, error) {
+	inputImage, err := r.inputImage(ctx, req.UserID, req.Image)
+	if err != nil {
+		return "", err
+	}
+	task := imageCaptionTask{
+		TaskType:    "imageCaption",
+		TaskUUID:    taskUUID(ctx),
+		InputImage:  inputImage,
+		IncludeCost: true,
+	}
+	return r.processText(ctx, req.UserID, task.TaskUUID, task)
+}
+
+// processText runs a task that returns a single text.
+func (r *Runware) processText(ctx context.Context, userID int64, taskUUID string, task any) (string, error) {
+	data, err := r.conn(userID).do(ctx, taskUUID, task, 1)
+	if err != nil {
+		return "", err
+	}
+	var text textData
+	if err := json.Unmarshal(data[0], &text); err != nil {
+		return "", fmt.Errorf("decode text: %w", err)
+	}
+	if text.Text == "" {
+		return "", ErrEmptyResponse
+	}
+	return text.Text, nil
+}
+
+// processImage runs a task that returns a single picture.
+func (r *Runware) processImage(ctx context.Context, userID int64, taskUUID string, task any) (*Image, error) {
+	data, err := r.conn(userID).do(ctx, taskUUID, task, 1)
+	if err != nil {
+		return nil, err
+	}
+	var img imageData
+	if err := json.Unmarshal(data[0], &img); err != nil {
+		return nil, fmt.Errorf("decode image: %w", err)
+	}
+	if img.ImageURL == "" {
+		return nil, ErrEmptyResponse
+	}
+	return &Image{UUID: img.ImageUUID, URL: img.ImageURL}, nil
+}
+
+// inputImage returns the imageUUID to use as inputImage, uploading the bytes if needed.
+func (r *Runware) inputImage(ctx context.Context, userID int64, image InputImage) (string, error) {
+	if image.UUID != "" {
+		return image.UUID, nil
+	}
+	if len(image.Bytes) == 0 {
+		return "", errors.New("input image is empty")
+	}
+	imageUUID, err := r.uploadImage(ctx, userID, image.Bytes)
+	if err != nil {
+		return "", fmt.Errorf("upload input image: %w", err)
+	}
+	return imageUUID, nil
+}
+
+// uploadImage stores the picture on runware and returns its imageUUID, which can be used by other tasks.
+func (r *Runware) uploadImage(ctx context.Context, userID int64, image []byte) (string, error) {
+	task := imageUploadTask{
+		TaskType: "imageUpload",
+		TaskUUID: uuid.NewString(),
+		Image:    dataURI(image),
+	}
+	data, err := r.conn(userID).do(ctx, task.TaskUUID, task, 1)
+	if err != nil {
+		return "", err
+	}
+	var img imageData
+	if err := json.Unmarshal(data[0], &img); err != nil {
+		return "", fmt.Errorf("decode upload: %w", err)
+	}
+	if img.ImageUUID == "" {
+		return "", ErrEmptyResponse
+	}
+	return img.ImageUUID, nil
+}
+
+func dataURI(image []byte) string {
+	return "data:" + http.DetectContentType(image) + ";base64," + base64.StdEncoding.EncodeToString(image)
+}
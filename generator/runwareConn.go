@@ -0,0 +1,375 @@
+package generator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/MTUCI-Pixel-Team/Picture_Generator/logging"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	runwareURL   = "wss://ws-api.runware.ai/v1"
+	writeTimeout = 10 * time.Second
+	// taskTimeout limits a task when the caller's context has no deadline.
+	taskTimeout = 2 * time.Minute
+	// resumeWait is how long a task waits for its results on the resumed session after a drop.
+	resumeWait = time.Minute
+)
+
+var errConnClosed = errors.New("runware connection closed")
+
+// apiError is an error returned by runware for a task.
+type apiError struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	Parameter string `json:"parameter"`
+	TaskUUID  string `json:"taskUUID"`
+}
+
+func (e *apiError) Error() string {
+	if e.Parameter != "" {
+		return fmt.Sprintf("runware %s: %s (%s)", e.Code, e.Message, e.Parameter)
+	}
+	return fmt.Sprintf("runware %s: %s", e.Code, e.Message)
+}
+
+type wsResponse struct {
+	Data   []json.RawMessage `json:"data"`
+	Errors []apiError        `json:"errors"`
+}
+
+type taskMessage struct {
+	data json.RawMessage
+	err  error
+}
+
+// runwareLink is an open socket. done is closed when the socket breaks, err tells why.
+type runwareLink struct {
+	socket *websocket.Conn
+	done   chan struct{}
+	err    error
+}
+
+// runwareConn is one authenticated WebSocket connection. Several tasks can run on it at once,
+// responses are matched to them by taskUUID. The connection is opened on the first task and
+// reopened after runware closes it.
+type runwareConn struct {
+	url    string
+	apiKey string
+	// dialing is held while the socket is opened, so tasks don't dial at once. mu is never
+	// held for the network, connected and drop don't wait for a slow dial.
+	dialing chan struct{}
+	mu      sync.Mutex
+	link    *runwareLink
+	session string
+	waiters map[string]chan taskMessage
+	writeMu sync.Mutex
+	closed  bool
+	// resumeWait is the constant of the same name, tests make it shorter.
+	resumeWait time.Duration
+	// pong gets a value when the server answers a ping.
+	pong chan struct{}
+}
+
+func newRunwareConn(url, apiKey string) *runwareConn {
+	return &runwareConn{
+		url:        url,
+		apiKey:     apiKey,
+		dialing:    make(chan struct{}, 1),
+		waiters:    make(map[string]chan taskMessage),
+		resumeWait: resumeWait,
+		pong:       make(chan struct{}, 1),
+	}
+}
+
+// do sends the task and waits for results data messages with its taskUUID. When the socket
+// breaks, the task waits once more on a new socket of the same session: runware sends there
+// the results it couldn't deliver. The task is not sent again, so it is never paid twice.
+func (c *runwareConn) do(ctx context.Context, taskUUID string, task any, results int) ([]json.RawMessage, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, taskTimeout)
+		defer cancel()
+	}
+
+	link, err := c.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan taskMessage, results)
+	c.mu.Lock()
+	c.waiters[taskUUID] = ch
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.waiters, taskUUID)
+		c.mu.Unlock()
+	}()
+
+	logger := logging.FromContext(ctx)
+	if taskUUID != ctx.Value(taskUUIDKey{}) {
+		logger = logger.With("subtask_uuid", taskUUID)
+	}
+	started := time.Now()
+	if err := c.write(link.socket, []any{task}); err != nil {
+		c.drop(link, err)
+		return nil, fmt.Errorf("send task: %w", err)
+	}
+	logger.Debug("Runware task sent")
+
+	var data []json.RawMessage
+	var resumed <-chan time.Time
+	for len(data) < results {
+		select {
+		case msg := <-ch:
+			if msg.err != nil {
+				logger.Debug("Runware task failed", "err", msg.err, "duration", time.Since(started))
+				return nil, msg.err
+			}
+			data = append(data, msg.data)
+		case <-link.done:
+			// Ответы, пришедшие до обрыва, уже в канале
+			if data = drain(ch, data); len(data) >= results {
+				break
+			}
+			lost := fmt.Errorf("%w: %v", errConnClosed, link.err)
+			if resumed != nil || errors.Is(link.err, errConnClosed) {
+				return nil, lost
+			}
+			if link, err = c.connect(ctx); err != nil {
+				logger.Debug("Runware session is not resumed", "err", err)
+				return nil, lost
+			}
+			logger.Debug("Runware session resumed, waiting for results", "results", len(data))
+			timer := time.NewTimer(c.resumeWait)
+			defer timer.Stop()
+			resumed = timer.C
+		case <-resumed:
+			return nil, fmt.Errorf("%w: results are not resent after the drop", errConnClosed)
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	logger.Debug("Runware task finished", "results", len(data), "duration", time.Since(started))
+	return data, nil
+}
+
+// drain takes the messages already delivered to ch without waiting. Errors are dropped,
+// the task fails with the error of the connection anyway.
+func drain(ch chan taskMessage, data []json.RawMessage) []json.RawMessage {
+	for {
+		select {
+		case msg := <-ch:
+			if msg.err == nil {
+				data = append(data, msg.data)
+			}
+		default:
+			return data
+		}
+	}
+}
+
+// connect returns the open socket or opens a new one, resuming the previous session.
+func (c *runwareConn) connect(ctx context.Context) (*runwareLink, error) {
+	select {
+	case c.dialing <- struct{}{}:
+		defer func() { <-c.dialing }()
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	c.mu.Lock()
+	closed, link, session := c.closed, c.link, c.session
+	c.mu.Unlock()
+	if closed {
+		return nil, errConnClosed
+	}
+	if link != nil {
+		return link, nil
+	}
+
+	socket, session, err := c.dial(ctx, session)
+	if err != nil {
+		return nil, err
+	}
+	link = &runwareLink{socket: socket, done: make(chan struct{})}
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		socket.Close()
+		return nil, errConnClosed
+	}
+	c.link, c.session = link, session
+	c.mu.Unlock()
+	go c.readLoop(link)
+	return link, nil
+}
+
+// dial opens and authenticates a socket. It returns the session to resume after a drop.
+func (c *runwareConn) dial(ctx context.Context, session string) (*websocket.Conn, string, error) {
+	socket, _, err := websocket.DefaultDialer.DialContext(ctx, c.url, nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("dial error: %w", err)
+	}
+	// Передаём прошлую сессию, чтобы runware вернул результаты, не доставленные до обрыва
+	auth := map[string]string{"taskType": "authentication", "apiKey": c.apiKey}
+	if session != "" {
+		auth["connectionSessionUUID"] = session
+	}
+	if err := c.write(socket, []any{auth}); err != nil {
+		socket.Close()
+		return nil, "", fmt.Errorf("send auth request: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		socket.SetReadDeadline(deadline)
+	}
+	var resp wsResponse
+	if err := socket.ReadJSON(&resp); err != nil {
+		socket.Close()
+		return nil, "", fmt.Errorf("read auth response: %w", err)
+	}
+	socket.SetReadDeadline(time.Time{})
+	if len(resp.Errors) > 0 {
+		socket.Close()
+		return nil, "", &resp.Errors[0]
+	}
+	var authData struct {
+		ConnectionSessionUUID string `json:"connectionSessionUUID"`
+	}
+	if len(resp.Data) == 0 || json.Unmarshal(resp.Data[0], &authData) != nil {
+		socket.Close()
+		return nil, "", errors.New("empty data in auth response")
+	}
+	socket.SetPongHandler(func(string) error {
+		select {
+		case c.pong <- struct{}{}:
+		default:
+		}
+		return nil
+	})
+	return socket, authData.ConnectionSessionUUID, nil
+}
+
+// ping sends a WebSocket ping and waits for the pong, which is handled by readLoop.
+func (c *runwareConn) ping(ctx context.Context) error {
+	link, err := c.connect(ctx)
+	if err != nil {
+		return err
+	}
+	// Старый ответ от прошлой проверки не считается
+	select {
+	case <-c.pong:
+	default:
+	}
+	c.writeMu.Lock()
+	err = link.socket.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeTimeout))
+	c.writeMu.Unlock()
+	if err != nil {
+		c.drop(link, err)
+		return fmt.Errorf("send ping: %w", err)
+	}
+	select {
+	case <-c.pong:
+		return nil
+	case <-link.done:
+		return fmt.Errorf("wait for pong: %w", link.err)
+	case <-ctx.Done():
+		return fmt.Errorf("wait for pong: %w", ctx.Err())
+	}
+}
+
+// connected reports whether the socket is open now. It is opened again by the next task after a drop.
+func (c *runwareConn) connected() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.link != nil
+}
+
+func (c *runwareConn) write(socket *websocket.Conn, v any) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	socket.SetWriteDeadline(time.Now().Add(writeTimeout))
+	return socket.WriteJSON(v)
+}
+
+// readLoop delivers responses to waiting tasks until the socket fails.
+func (c *runwareConn) readLoop(link *runwareLink) {
+	for {
+		var resp wsResponse
+		if err := link.socket.ReadJSON(&resp); err != nil {
+			c.drop(link, err)
+			return
+		}
+		for _, data := range resp.Data {
+			var head struct {
+				TaskUUID string `json:"taskUUID"`
+			}
+			if err := json.Unmarshal(data, &head); err != nil {
+				slog.Warn("Runware sent a bad data message", "err", err)
+				continue
+			}
+			c.deliver(head.TaskUUID, taskMessage{data: data})
+		}
+		for i := range resp.Errors {
+			apiErr := resp.Errors[i]
+			if apiErr.TaskUUID == "" {
+				slog.Warn("Runware error without a task", "err", &apiErr)
+				continue
+			}
+			c.deliver(apiErr.TaskUUID, taskMessage{err: &apiErr})
+		}
+	}
+}
+
+func (c *runwareConn) deliver(taskUUID string, msg taskMessage) {
+	c.mu.Lock()
+	ch, ok := c.waiters[taskUUID]
+	c.mu.Unlock()
+	if !ok {
+		return
+	}
+	select {
+	case ch <- msg:
+	default:
+		// Лишний ответ на задачу, которая уже получила всё, что ждала
+	}
+}
+
+// close closes the socket for good: waiting tasks fail and new ones are not sent.
+func (c *runwareConn) close() {
+	c.mu.Lock()
+	c.closed = true
+	link := c.link
+	c.mu.Unlock()
+	if link == nil {
+		return
+	}
+	// Вежливо закрываем соединение, ошибка не важна: сокет всё равно будет закрыт
+	c.writeMu.Lock()
+	link.socket.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(writeTimeout))
+	c.writeMu.Unlock()
+	c.drop(link, errConnClosed)
+}
+
+// drop forgets the broken socket. Tasks waiting on it see link.done and decide themselves
+// whether to wait on the resumed session, so no failure is lost in a full channel.
+func (c *runwareConn) drop(link *runwareLink, reason error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.link != link {
+		return
+	}
+	link.socket.Close()
+	c.link = nil
+	link.err = reason
+	close(link.done)
+	if !errors.Is(reason, errConnClosed) {
+		slog.Warn("Runware connection lost", "err", reason)
+	}
+}
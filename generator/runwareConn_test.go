@@ -0,0 +1,368 @@
+package generator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// fakeRunware is a WebSocket server that answers authentication like runware
+// and hands every other task to handle.
+type fakeRunware struct {
+	t      *testing.T
+	server *httptest.Server
+	// handle gets the tasks of a connection, it runs on the goroutine of the connection.
+	handle func(socket *websocket.Conn, tasks <-chan map[string]any)
+	// beforeAuth is called after the authentication request is read, if set.
+	beforeAuth func()
+
+	mu       sync.Mutex
+	sessions []string // connectionSessionUUID из запросов аутентификации
+}
+
+func newFakeRunware(t *testing.T, handle func(socket *websocket.Conn, tasks <-chan map[string]any)) *fakeRunware {
+	f := &fakeRunware{t: t, handle: handle}
+	f.server = httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+func (f *fakeRunware) url() string {
+	return "ws" + strings.TrimPrefix(f.server.URL, "http")
+}
+
+func (f *fakeRunware) connections() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.sessions)
+}
+
+func (f *fakeRunware) serve(w http.ResponseWriter, r *http.Request) {
+	upgrader := websocket.Upgrader{}
+	socket, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		f.t.Errorf("upgrade: %v", err)
+		return
+	}
+	defer socket.Close()
+
+	var auth []map[string]string
+	if err := socket.ReadJSON(&auth); err != nil || len(auth) != 1 || auth[0]["taskType"] != "authentication" {
+		f.t.Errorf("bad authentication request: %v %v", auth, err)
+		return
+	}
+	if f.beforeAuth != nil {
+		f.beforeAuth()
+	}
+	f.mu.Lock()
+	f.sessions = append(f.sessions, auth[0]["connectionSessionUUID"])
+	session := fmt.Sprintf("session-%d", len(f.sessions))
+	f.mu.Unlock()
+	socket.WriteJSON(map[string]any{"data": []any{map[string]string{
+		"taskType": "authentication", "connectionSessionUUID": session,
+	}}})
+
+	tasks := make(chan map[string]any)
+	go func() {
+		defer close(tasks)
+		for {
+			var batch []map[string]any
+			if err := socket.ReadJSON(&batch); err != nil {
+				return
+			}
+			for _, task := range batch {
+				tasks <- task
+			}
+		}
+	}()
+	f.handle(socket, tasks)
+}
+
+func reply(socket *websocket.Conn, taskUUID string, value int) error {
+	return socket.WriteJSON(map[string]any{"data": []any{map[string]any{"taskUUID": taskUUID, "value": value}}})
+}
+
+func testTask(taskUUID string) map[string]string {
+	return map[string]string{"taskType": "test", "taskUUID": taskUUID}
+}
+
+func testContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func TestRunwareConnMatchesConcurrentResponses(t *testing.T) {
+	const tasks = 8
+	server := newFakeRunware(t, func(socket *websocket.Conn, incoming <-chan map[string]any) {
+		// Собираем все задачи и отвечаем в обратном порядке
+		var uuids []string
+		for task := range incoming {
+			uuids = append(uuids, task["taskUUID"].(string))
+			if len(uuids) == tasks {
+				break
+			}
+		}
+		for i := len(uuids) - 1; i >= 0; i-- {
+			var n int
+			fmt.Sscanf(uuids[i], "task-%d", &n)
+			reply(socket, uuids[i], n*10)
+			reply(socket, uuids[i], n*10+1)
+		}
+		for range incoming {
+		}
+	})
+	conn := newRunwareConn(server.url(), "key")
+	defer conn.close()
+	ctx := testContext(t)
+
+	var wg sync.WaitGroup
+	for i := 0; i < tasks; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			id := fmt.Sprintf("task-%d", i)
+			data, err := conn.do(ctx, id, testTask(id), 2)
+			if err != nil {
+				t.Errorf("%s: %v", id, err)
+				return
+			}
+			for k, raw := range data {
+				var msg struct {
+					TaskUUID string `json:"taskUUID"`
+					Value    int    `json:"value"`
+				}
+				json.Unmarshal(raw, &msg)
+				if msg.TaskUUID != id || msg.Value != i*10+k {
+					t.Errorf("%s got result %d: %s", id, k, raw)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if n := server.connections(); n != 1 {
+		t.Errorf("tasks used %d connections, want 1", n)
+	}
+}
+
+func TestRunwareConnAPIError(t *testing.T) {
+	server := newFakeRunware(t, func(socket *websocket.Conn, incoming <-chan map[string]any) {
+		for task := range incoming {
+			socket.WriteJSON(map[string]any{"errors": []any{map[string]string{
+				"code": "invalidModel", "message": "bad model", "taskUUID": task["taskUUID"].(string),
+			}}})
+		}
+	})
+	conn := newRunwareConn(server.url(), "key")
+	defer conn.close()
+
+	_, err := conn.do(testContext(t), "task", testTask("task"), 1)
+	var apiErr *apiError
+	if !errors.As(err, &apiErr) || apiErr.Code != "invalidModel" {
+		t.Fatalf("got %v, want the api error", err)
+	}
+	if ErrorClass(err) != "provider" {
+		t.Errorf("class %q, want provider", ErrorClass(err))
+	}
+}
+
+func TestRunwareConnDropFailsWaitingTasks(t *testing.T) {
+	received := make(chan struct{}, 2)
+	var server *fakeRunware
+	server = newFakeRunware(t, func(socket *websocket.Conn, incoming <-chan map[string]any) {
+		// Возобновлённая сессия тоже обрывается
+		if server.connections() > 1 {
+			return
+		}
+		for range incoming {
+			received <- struct{}{}
+			if len(received) == 2 {
+				// Обрываем соединение, не ответив ни на одну задачу
+				return
+			}
+		}
+	})
+	conn := newRunwareConn(server.url(), "key")
+	defer conn.close()
+	ctx := testContext(t)
+
+	errs := make(chan error, 2)
+	for _, id := range []string{"first", "second"} {
+		go func() {
+			_, err := conn.do(ctx, id, testTask(id), 1)
+			errs <- err
+		}()
+	}
+	for range 2 {
+		select {
+		case err := <-errs:
+			if !errors.Is(err, errConnClosed) {
+				t.Errorf("got %v, want %v", err, errConnClosed)
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatal("task still waits after the connection was dropped")
+		}
+	}
+	if conn.connected() {
+		t.Error("dropped connection is still reported as connected")
+	}
+}
+
+func TestRunwareConnReconnects(t *testing.T) {
+	server := newFakeRunware(t, func(socket *websocket.Conn, incoming <-chan map[string]any) {
+		task, ok := <-incoming
+		if !ok {
+			return
+		}
+		id := task["taskUUID"].(string)
+		if id == "drop" {
+			return
+		}
+		reply(socket, id, 1)
+		for range incoming {
+		}
+	})
+	conn := newRunwareConn(server.url(), "key")
+	conn.resumeWait = 100 * time.Millisecond
+	defer conn.close()
+	ctx := testContext(t)
+
+	// Сессия возобновлена, но результат так и не пришёл
+	if _, err := conn.do(ctx, "drop", testTask("drop"), 1); !errors.Is(err, errConnClosed) {
+		t.Fatalf("got %v, want %v", err, errConnClosed)
+	}
+	if _, err := conn.do(ctx, "after", testTask("after"), 1); err != nil {
+		t.Fatalf("task after reconnect: %v", err)
+	}
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	// Новое соединение продолжает прошлую сессию
+	if len(server.sessions) != 2 || server.sessions[0] != "" || server.sessions[1] != "session-1" {
+		t.Errorf("sessions in authentication requests: %q", server.sessions)
+	}
+}
+
+func TestRunwareConnCancelRemovesWaiter(t *testing.T) {
+	received := make(chan struct{})
+	server := newFakeRunware(t, func(socket *websocket.Conn, incoming <-chan map[string]any) {
+		for range incoming {
+			close(received)
+			break
+		}
+		// Никогда не отвечаем
+		for range incoming {
+		}
+	})
+	conn := newRunwareConn(server.url(), "key")
+	defer conn.close()
+
+	ctx, cancel := context.WithCancel(testContext(t))
+	go func() {
+		<-received
+		cancel()
+	}()
+	if _, err := conn.do(ctx, "slow", testTask("slow"), 1); !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want %v", err, context.Canceled)
+	}
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	if len(conn.waiters) != 0 {
+		t.Errorf("waiters left after cancel: %v", conn.waiters)
+	}
+	if conn.link == nil {
+		t.Error("cancelling a task closed the connection")
+	}
+}
+
+func TestRunwareConnClosed(t *testing.T) {
+	server := newFakeRunware(t, func(socket *websocket.Conn, incoming <-chan map[string]any) {
+		for range incoming {
+		}
+	})
+	conn := newRunwareConn(server.url(), "key")
+	if err := conn.ping(testContext(t)); err != nil {
+		t.Fatalf("ping: %v", err)
+	}
+	conn.close()
+	if _, err := conn.do(testContext(t), "late", testTask("late"), 1); !errors.Is(err, errConnClosed) {
+		t.Fatalf("got %v, want %v", err, errConnClosed)
+	}
+}
+
+func TestRunwareConnResumesSession(t *testing.T) {
+	var server *fakeRunware
+	lost := make(chan string, 1)
+	server = newFakeRunware(t, func(socket *websocket.Conn, incoming <-chan map[string]any) {
+		if server.connections() == 1 {
+			// Принимаем задачу и обрываем соединение, не ответив
+			task := <-incoming
+			lost <- task["taskUUID"].(string)
+			return
+		}
+		// В возобновлённой сессии runware присылает недоставленный результат
+		reply(socket, <-lost, 7)
+		for range incoming {
+		}
+	})
+	conn := newRunwareConn(server.url(), "key")
+	defer conn.close()
+
+	data, err := conn.do(testContext(t), "task", testTask("task"), 1)
+	if err != nil {
+		t.Fatalf("task is not resumed: %v", err)
+	}
+	if !strings.Contains(string(data[0]), `"value":7`) {
+		t.Errorf("got %s", data[0])
+	}
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if len(server.sessions) != 2 || server.sessions[1] != "session-1" {
+		t.Errorf("sessions in authentication requests: %q", server.sessions)
+	}
+}
+
+func TestRunwareConnDialDoesNotBlock(t *testing.T) {
+	authRead := make(chan struct{})
+	release := make(chan struct{})
+	server := newFakeRunware(t, func(socket *websocket.Conn, incoming <-chan map[string]any) {
+		for range incoming {
+		}
+	})
+	server.beforeAuth = func() {
+		close(authRead)
+		<-release
+	}
+	conn := newRunwareConn(server.url(), "key")
+	defer conn.close()
+
+	pinged := make(chan error, 1)
+	go func() { pinged <- conn.ping(testContext(t)) }()
+	<-authRead
+	// Пока соединение открывается, состояние читается сразу, например для метрик
+	checked := make(chan bool)
+	go func() { checked <- conn.connected() }()
+	select {
+	case connected := <-checked:
+		if connected {
+			t.Error("connection is reported before authentication")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("connected waits for the dial")
+	}
+	close(release)
+	if err := <-pinged; err != nil {
+		t.Fatalf("ping: %v", err)
+	}
+	if !conn.connected() {
+		t.Error("connection is not reported after authentication")
+	}
+}
@@ -0,0 +1,88 @@
+package generator
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+// newTestRunware returns a Runware whose user userID is connected to server.
+func newTestRunware(t *testing.T, server *fakeRunware, userID int64) *Runware {
+	conn := newRunwareConn(server.url(), "key")
+	t.Cleanup(conn.close)
+	return &Runware{apiKey: "key", connectionUsers: map[int64]*runwareConn{userID: conn}}
+}
+
+func TestRunwareGenerate(t *testing.T) {
+	received := make(chan map[string]any, 1)
+	server := newFakeRunware(t, func(socket *websocket.Conn, incoming <-chan map[string]any) {
+		for task := range incoming {
+			received <- task
+			id := task["taskUUID"]
+			socket.WriteJSON(map[string]any{"data": []any{
+				map[string]any{"taskType": "imageInference", "taskUUID": id, "imageUUID": "image-1", "imageURL": "https://im.runware.ai/1.jpg", "seed": 42, "cost": 0.002},
+				map[string]any{"taskType": "imageInference", "taskUUID": id, "imageUUID": "image-2", "imageURL": "https://im.runware.ai/2.jpg", "seed": 43, "cost": 0.003},
+			}})
+		}
+	})
+	runware := newTestRunware(t, server, 7)
+
+	ctx := WithTaskUUID(testContext(t), "task-1")
+	result, err := runware.Generate(ctx, Request{
+		UserID: 7, PositivePrompt: "a cat on a sofa", NegativePrompt: "blurry", Model: "runware:100@1",
+		Width: 768, Height: 512, Steps: 30, NumberResults: 2, Scheduler: "Default", CFGScale: 7.5, Seed: 42,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	task := <-received
+	want := map[string]any{
+		"taskType": "imageInference", "taskUUID": "task-1", "positivePrompt": "a cat on a sofa", "negativePrompt": "blurry",
+		"model": "runware:100@1", "width": 768.0, "height": 512.0, "steps": 30.0, "numberResults": 2.0,
+		"CFGScale": 7.5, "seed": 42.0, "includeCost": true,
+	}
+	for key, value := range want {
+		if task[key] != value {
+			t.Errorf("%s is %v, want %v", key, task[key], value)
+		}
+	}
+	// Планировщик "Default" не передаётся, без картинки нет seedImage
+	for _, key := range []string{"scheduler", "seedImage", "strength"} {
+		if value, ok := task[key]; ok {
+			t.Errorf("%s is sent: %v", key, value)
+		}
+	}
+	if output, _ := task["outputType"].([]any); len(output) != 1 || output[0] != "URL" {
+		t.Errorf("outputType %v", task["outputType"])
+	}
+
+	if result.Seed != 42 || result.Cost != 0.005 || len(result.Images) != 2 {
+		t.Fatalf("result %+v", result)
+	}
+	wantImages := []Image{
+		{UUID: "image-1", URL: "https://im.runware.ai/1.jpg", Seed: 42},
+		{UUID: "image-2", URL: "https://im.runware.ai/2.jpg", Seed: 43},
+	}
+	for i, img := range result.Images {
+		if want := wantImages[i]; img.UUID != want.UUID || img.URL != want.URL || img.Seed != want.Seed {
+			t.Errorf("picture %d is %+v, want %+v", i, img, want)
+		}
+	}
+}
+
+func TestRunwareGenerateWithoutURL(t *testing.T) {
+	server := newFakeRunware(t, func(socket *websocket.Conn, incoming <-chan map[string]any) {
+		for task := range incoming {
+			socket.WriteJSON(map[string]any{"data": []any{
+				map[string]any{"taskUUID": task["taskUUID"], "imageUUID": "image-1", "seed": 1},
+			}})
+		}
+	})
+	runware := newTestRunware(t, server, 7)
+	_, err := runware.Generate(testContext(t), Request{UserID: 7, PositivePrompt: "a cat", Width: 512, Height: 512, NumberResults: 1})
+	if !errors.Is(err, ErrEmptyResponse) {
+		t.Errorf("error %v, want ErrEmptyResponse", err)
+	}
+}
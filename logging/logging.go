@@ -0,0 +1,174 @@
+// Package logging sets up the structured logger of the application: JSON or logfmt lines,
+// levels, redaction of secrets and a rotated log file.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Config describes where and how to write logs.
+type Config struct {
+	// Format is "json" or "text" (logfmt).
+	Format string
+	Level  slog.Level
+	// File is the log file, "stdout" or "stderr" write to the console without rotation.
+	File string
+	// MaxSize is the size in bytes after which the file is rotated.
+	MaxSize int64
+	// MaxAge is how long a file is written before it is rotated.
+	MaxAge time.Duration
+	// MaxBackups is how many rotated files are kept, Retention is how long they are kept.
+	MaxBackups int
+	Retention  time.Duration
+	// Secrets are replaced with "[REDACTED]" wherever they appear.
+	Secrets []string
+}
+
+var defaultConfig = Config{
+	Format:     "text",
+	Level:      slog.LevelInfo,
+	File:       "app.log",
+	MaxSize:    10 << 20,
+	MaxAge:     24 * time.Hour,
+	MaxBackups: 7,
+	Retention:  30 * 24 * time.Hour,
+}
+
+func (c *Config) setDefaults() {
+	if c.Format == "" {
+		c.Format = defaultConfig.Format
+	}
+	if c.File == "" {
+		c.File = defaultConfig.File
+	}
+	if c.MaxSize <= 0 {
+		c.MaxSize = defaultConfig.MaxSize
+	}
+	if c.MaxAge <= 0 {
+		c.MaxAge = defaultConfig.MaxAge
+	}
+	if c.MaxBackups <= 0 {
+		c.MaxBackups = defaultConfig.MaxBackups
+	}
+	if c.Retention <= 0 {
+		c.Retention = defaultConfig.Retention
+	}
+}
+
+// ParseLevel reads debug, info, warn or error. Empty means info.
+func ParseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	if s == "" {
+		return slog.LevelInfo, nil
+	}
+	err := level.UnmarshalText([]byte(s))
+	return level, err
+}
+
+// Setup makes the configured logger the default one, the standard log package writes to it too.
+// The returned closer closes the log file.
+func Setup(cfg Config) (io.Closer, error) {
+	cfg.setDefaults()
+	var out io.WriteCloser
+	switch cfg.File {
+	case "stdout":
+		out = nopCloser{os.Stdout}
+	case "stderr":
+		out = nopCloser{os.Stderr}
+	default:
+		w, err := NewRotatingWriter(cfg.File, cfg.MaxSize, cfg.MaxAge, cfg.MaxBackups, cfg.Retention)
+		if err != nil {
+			return nil, err
+		}
+		out = w
+	}
+
+	opts := &slog.HandlerOptions{
+		Level:       cfg.Level,
+		ReplaceAttr: newRedactor(cfg.Secrets).replaceAttr,
+	}
+	var handler slog.Handler
+	switch cfg.Format {
+	case "json":
+		handler = slog.NewJSONHandler(out, opts)
+	case "text", "logfmt":
+		handler = slog.NewTextHandler(out, opts)
+	default:
+		out.Close()
+		return nil, fmt.Errorf("unknown log format %q", cfg.Format)
+	}
+	// Строки пакета log тоже идут в этот обработчик с уровнем info
+	slog.SetDefault(slog.New(handler))
+	return out, nil
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+// tokenPattern matches Telegram bot tokens, they also appear inside file URLs.
+var tokenPattern = regexp.MustCompile(`\d{6,}:[A-Za-z0-9_-]{30,}`)
+
+const redacted = "[REDACTED]"
+
+type redactor struct {
+	secrets *strings.Replacer
+}
+
+func newRedactor(secrets []string) *redactor {
+	var pairs []string
+	for _, secret := range secrets {
+		// Короткие значения заменили бы половину лога
+		if len(secret) >= 8 {
+			pairs = append(pairs, secret, redacted)
+		}
+	}
+	return &redactor{secrets: strings.NewReplacer(pairs...)}
+}
+
+func (r *redactor) redact(s string) string {
+	return tokenPattern.ReplaceAllString(r.secrets.Replace(s), redacted)
+}
+
+// replaceAttr redacts the message and all text values, errors and other values are
+// turned into text first.
+func (r *redactor) replaceAttr(_ []string, a slog.Attr) slog.Attr {
+	switch a.Value.Kind() {
+	case slog.KindString:
+		a.Value = slog.StringValue(r.redact(a.Value.String()))
+	case slog.KindAny:
+		switch v := a.Value.Any().(type) {
+		case error:
+			a.Value = slog.StringValue(r.redact(v.Error()))
+		case fmt.Stringer:
+			a.Value = slog.StringValue(r.redact(v.String()))
+		}
+	}
+	return a
+}
+
+type loggerKey struct{}
+
+// WithLogger returns a context that carries the logger, for example one with the attributes of a job.
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// FromContext returns the logger of the context or the default one.
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
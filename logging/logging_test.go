@@ -0,0 +1,119 @@
+package logging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const (
+	testToken  = "123456789:AAHdqTcvCH1vGWJxfSeofSAs0K5PALDsaw"
+	testAPIKey = "rw-secret-api-key-0001"
+)
+
+func TestRedactor(t *testing.T) {
+	tests := []struct {
+		name string
+		log  func(logger *slog.Logger)
+		// kept must stay in the line, secrets must not.
+		kept string
+	}{
+		{"message", func(l *slog.Logger) { l.Info("token is " + testToken) }, "token is"},
+		{"string", func(l *slog.Logger) { l.Info("request", "url", "https://api.telegram.org/bot"+testToken+"/getMe") }, "https://api.telegram.org/bot"},
+		{"error", func(l *slog.Logger) {
+			l.Error("failed", "err", fmt.Errorf("send: %w", errors.New(`Post "https://api.telegram.org/bot`+testToken+`/sendPhoto": EOF`)))
+		}, "/sendPhoto"},
+		{"stringer", func(l *slog.Logger) {
+			u, _ := url.Parse("wss://ws-api.runware.ai/v1?key=" + testAPIKey)
+			l.Info("connect", "url", u)
+		}, "ws-api.runware.ai"},
+		{"configured secret", func(l *slog.Logger) { l.Info("auth", "apiKey", testAPIKey) }, "auth"},
+		{"other token", func(l *slog.Logger) {
+			l.Info("file", "path", "/file/bot987654:abcdefghijklmnopqrstuvwxyz0123456789/photo.jpg")
+		}, "/photo.jpg"},
+		{"group", func(l *slog.Logger) { l.WithGroup("job").Info("started", "prompt", "a cat", "key", testAPIKey) }, "a cat"},
+		{"with", func(l *slog.Logger) { l.With("token", testToken).Info("started") }, "started"},
+	}
+	handlers := map[string]func(w *bytes.Buffer, opts *slog.HandlerOptions) slog.Handler{
+		"text": func(w *bytes.Buffer, opts *slog.HandlerOptions) slog.Handler { return slog.NewTextHandler(w, opts) },
+		"json": func(w *bytes.Buffer, opts *slog.HandlerOptions) slog.Handler { return slog.NewJSONHandler(w, opts) },
+	}
+	for format, newHandler := range handlers {
+		for _, tt := range tests {
+			t.Run(format+" "+tt.name, func(t *testing.T) {
+				var out bytes.Buffer
+				r := newRedactor([]string{testToken, testAPIKey})
+				tt.log(slog.New(newHandler(&out, &slog.HandlerOptions{ReplaceAttr: r.replaceAttr})))
+				line := out.String()
+				for _, secret := range []string{testToken, testAPIKey, "AAHdqTcvCH1vGWJxfSeofSAs0K5PALDsaw", "abcdefghijklmnopqrstuvwxyz0123456789"} {
+					if strings.Contains(line, secret) {
+						t.Errorf("secret in the log: %s", line)
+					}
+				}
+				if !strings.Contains(line, redacted) || !strings.Contains(line, tt.kept) {
+					t.Errorf("want %q and %q in %s", redacted, tt.kept, line)
+				}
+			})
+		}
+	}
+}
+
+func TestRedactorShortSecrets(t *testing.T) {
+	r := newRedactor([]string{"", "1234", "password1"})
+	tests := []struct {
+		in, want string
+	}{
+		// Короткие значения не заменяются, иначе пропали бы обычные числа
+		{"job 1234 done", "job 1234 done"},
+		{"password1 leaked", redacted + " leaked"},
+		{"nothing here", "nothing here"},
+		// Шесть цифр и двоеточие без длинного хвоста - не токен
+		{"at 123456:abc", "at 123456:abc"},
+	}
+	for _, tt := range tests {
+		if got := r.redact(tt.in); got != tt.want {
+			t.Errorf("redact(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSetupRedactsLogFile(t *testing.T) {
+	saved := slog.Default()
+	t.Cleanup(func() { slog.SetDefault(saved) })
+
+	path := filepath.Join(t.TempDir(), "app.log")
+	closer, err := Setup(Config{Format: "json", File: path, Secrets: []string{testAPIKey}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	slog.Info("starting", "token", testToken, "key", testAPIKey)
+	// Строки пакета log проходят через тот же обработчик
+	log.Printf("bot %s authorized", testToken)
+	slog.Debug("hidden below the level")
+	closer.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := string(data)
+	if strings.Contains(text, testToken) || strings.Contains(text, testAPIKey) {
+		t.Errorf("secret in the log file:\n%s", text)
+	}
+	if strings.Count(text, "\n") != 2 || !strings.Contains(text, "authorized") {
+		t.Errorf("unexpected log file:\n%s", text)
+	}
+}
+
+func TestSetupUnknownFormat(t *testing.T) {
+	if _, err := Setup(Config{Format: "xml", File: "stderr"}); err == nil {
+		t.Error("unknown format is accepted")
+	}
+}
@@ -0,0 +1,175 @@
+package logging
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const backupTimeFormat = "20060102T150405.000"
+
+// RotatingWriter writes to a file and moves it aside when it grows over maxSize bytes or gets
+// older than maxAge. Rotated files are named like app-20240131T150405.000.log, at most maxBackups
+// of them are kept and none older than retention.
+type RotatingWriter struct {
+	path       string
+	maxSize    int64
+	maxAge     time.Duration
+	maxBackups int
+	retention  time.Duration
+
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	openedAt time.Time
+}
+
+func NewRotatingWriter(path string, maxSize int64, maxAge time.Duration, maxBackups int, retention time.Duration) (*RotatingWriter, error) {
+	w := &RotatingWriter{
+		path:       path,
+		maxSize:    maxSize,
+		maxAge:     maxAge,
+		maxBackups: maxBackups,
+		retention:  retention,
+	}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	w.prune()
+	return w, nil
+}
+
+// open continues the existing file, its age is counted from its last rotation.
+func (w *RotatingWriter) open() error {
+	file, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("open log file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("open log file: %w", err)
+	}
+	w.file, w.size, w.openedAt = file, info.Size(), time.Now()
+	if created, ok := w.lastRotation(); ok {
+		w.openedAt = created
+	}
+	return nil
+}
+
+func (w *RotatingWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return 0, os.ErrClosed
+	}
+	if w.size > 0 && (w.size+int64(len(p)) > w.maxSize || time.Since(w.openedAt) >= w.maxAge) {
+		if err := w.rotate(); err != nil {
+			// Лучше писать в старый файл, чем потерять строки
+			fmt.Fprintf(os.Stderr, "log rotation failed: %v\n", err)
+		}
+	}
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *RotatingWriter) rotate() error {
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+	w.file = nil
+	backup := w.backupName(time.Now())
+	if err := os.Rename(w.path, backup); err != nil {
+		if openErr := w.open(); openErr != nil {
+			return openErr
+		}
+		return err
+	}
+	if err := w.open(); err != nil {
+		return err
+	}
+	w.openedAt = time.Now()
+	go w.prune()
+	return nil
+}
+
+// backupName returns a free name for the file rotated at t. Rotations within the same
+// millisecond get the next free millisecond, so a backup is never overwritten.
+func (w *RotatingWriter) backupName(t time.Time) string {
+	ext := filepath.Ext(w.path)
+	for {
+		name := strings.TrimSuffix(w.path, ext) + "-" + t.Format(backupTimeFormat) + ext
+		if _, err := os.Lstat(name); err != nil {
+			return name
+		}
+		t = t.Add(time.Millisecond)
+	}
+}
+
+// backups returns rotated files with their rotation time, the newest first.
+func (w *RotatingWriter) backups() ([]string, []time.Time) {
+	ext := filepath.Ext(w.path)
+	prefix := filepath.Base(strings.TrimSuffix(w.path, ext)) + "-"
+	entries, err := os.ReadDir(filepath.Dir(w.path))
+	if err != nil {
+		return nil, nil
+	}
+	type backup struct {
+		name string
+		at   time.Time
+	}
+	var found []backup
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, ext) {
+			continue
+		}
+		at, err := time.ParseInLocation(backupTimeFormat, strings.TrimSuffix(strings.TrimPrefix(name, prefix), ext), time.Local)
+		if err != nil {
+			continue
+		}
+		found = append(found, backup{filepath.Join(filepath.Dir(w.path), name), at})
+	}
+	sort.Slice(found, func(i, k int) bool { return found[i].at.After(found[k].at) })
+	names := make([]string, len(found))
+	times := make([]time.Time, len(found))
+	for i, b := range found {
+		names[i], times[i] = b.name, b.at
+	}
+	return names, times
+}
+
+// lastRotation is when the current file was started, if it was rotated before.
+func (w *RotatingWriter) lastRotation() (time.Time, bool) {
+	_, times := w.backups()
+	if len(times) == 0 {
+		return time.Time{}, false
+	}
+	return times[0], true
+}
+
+// prune deletes rotated files over maxBackups and older than retention.
+func (w *RotatingWriter) prune() {
+	names, times := w.backups()
+	for i, name := range names {
+		if i >= w.maxBackups || time.Since(times[i]) > w.retention {
+			os.Remove(name)
+		}
+	}
+}
+
+func (w *RotatingWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
@@ -0,0 +1,189 @@
+package logging
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func readLog(t *testing.T, path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// logFiles returns the rotated files from the oldest and the current file last.
+func logFiles(t *testing.T, w *RotatingWriter) []string {
+	names, _ := w.backups()
+	slices.Reverse(names)
+	return append(names, w.path)
+}
+
+func TestRotateBySize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	w, err := NewRotatingWriter(path, 100, time.Hour, 10, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	line := strings.Repeat("x", 59) + "\n"
+	var lines []string
+	for i := 0; i < 4; i++ {
+		l := string(rune('a'+i)) + line[1:]
+		lines = append(lines, l)
+		if _, err := w.Write([]byte(l)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Две строки не помещаются в 100 байт, каждая попадает в свой файл
+	files := logFiles(t, w)
+	if len(files) != 4 {
+		t.Fatalf("%d files, want 4: %v", len(files), files)
+	}
+	for i, file := range files {
+		if got := readLog(t, file); got != lines[i] {
+			t.Errorf("%s: %q, want %q", filepath.Base(file), got, lines[i])
+		}
+	}
+}
+
+func TestLongLineIsNotSplit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	w, _ := NewRotatingWriter(path, 10, time.Hour, 10, time.Hour)
+	defer w.Close()
+	long := strings.Repeat("y", 50) + "\n"
+	w.Write([]byte(long))
+	// Строка длиннее лимита пишется в пустой файл целиком
+	if got := readLog(t, path); got != long {
+		t.Errorf("%q", got)
+	}
+	if names, _ := w.backups(); len(names) != 0 {
+		t.Errorf("empty file is rotated: %v", names)
+	}
+}
+
+func TestRotateByAge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	w, _ := NewRotatingWriter(path, 1<<20, time.Hour, 10, 24*time.Hour)
+	defer w.Close()
+	w.Write([]byte("old\n"))
+	w.Write([]byte("still young\n"))
+	if names, _ := w.backups(); len(names) != 0 {
+		t.Fatalf("young file is rotated: %v", names)
+	}
+
+	w.mu.Lock()
+	w.openedAt = time.Now().Add(-time.Hour)
+	w.mu.Unlock()
+	w.Write([]byte("new\n"))
+	files := logFiles(t, w)
+	if len(files) != 2 || readLog(t, files[0]) != "old\nstill young\n" || readLog(t, files[1]) != "new\n" {
+		t.Fatalf("files after age rotation: %v", files)
+	}
+}
+
+func TestReopenKeepsAge(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	rotated := time.Now().Add(-2 * time.Hour).Truncate(time.Millisecond)
+	os.WriteFile(filepath.Join(dir, "app-"+rotated.Format(backupTimeFormat)+".log"), []byte("older\n"), 0o644)
+	os.WriteFile(path, []byte("current\n"), 0o644)
+
+	w, err := NewRotatingWriter(path, 1<<20, time.Hour, 10, 24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	// Файл начат при прошлой ротации, два часа назад, и сразу уходит в архив
+	if !w.openedAt.Equal(rotated) {
+		t.Errorf("opened at %v, want %v", w.openedAt, rotated)
+	}
+	w.Write([]byte("after restart\n"))
+	files := logFiles(t, w)
+	if len(files) != 3 || readLog(t, files[1]) != "current\n" || readLog(t, files[2]) != "after restart\n" {
+		t.Errorf("files: %v", files)
+	}
+}
+
+func TestPruneBackups(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name       string
+		ages       []time.Duration // Возраст архивов
+		maxBackups int
+		retention  time.Duration
+		wantKept   []time.Duration
+	}{
+		{"under the limits", []time.Duration{time.Hour, 2 * time.Hour}, 5, 24 * time.Hour, []time.Duration{time.Hour, 2 * time.Hour}},
+		{"too many", []time.Duration{time.Hour, 2 * time.Hour, 3 * time.Hour, 4 * time.Hour}, 2, 24 * time.Hour, []time.Duration{time.Hour, 2 * time.Hour}},
+		{"too old", []time.Duration{time.Hour, 48 * time.Hour, 72 * time.Hour}, 5, 24 * time.Hour, []time.Duration{time.Hour}},
+		{"both", []time.Duration{time.Hour, 2 * time.Hour, 3 * time.Hour, 48 * time.Hour}, 2, 24 * time.Hour, []time.Duration{time.Hour, 2 * time.Hour}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			name := func(age time.Duration) string {
+				return filepath.Join(dir, "app-"+now.Add(-age).Format(backupTimeFormat)+".log")
+			}
+			for _, age := range tt.ages {
+				os.WriteFile(name(age), []byte("x\n"), 0o644)
+			}
+			// Чужие файлы не трогаются
+			others := []string{"app.log.bak", "app-notatime.log", "other-20200101T000000.000.log", "app-20200101T000000.000.txt"}
+			for _, other := range others {
+				os.WriteFile(filepath.Join(dir, other), nil, 0o644)
+			}
+
+			w, err := NewRotatingWriter(filepath.Join(dir, "app.log"), 1<<20, time.Hour, tt.maxBackups, tt.retention)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer w.Close()
+			names, _ := w.backups()
+			var want []string
+			for _, age := range tt.wantKept {
+				want = append(want, name(age))
+			}
+			if strings.Join(names, "\n") != strings.Join(want, "\n") {
+				t.Errorf("kept %v, want %v", names, want)
+			}
+			for _, other := range others {
+				if _, err := os.Stat(filepath.Join(dir, other)); err != nil {
+					t.Errorf("%s is removed", other)
+				}
+			}
+		})
+	}
+}
+
+func TestRotateKeepsBackupsOfTheSameMillisecond(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	w, _ := NewRotatingWriter(path, 1, time.Hour, 100, time.Hour)
+	defer w.Close()
+	for i := 0; i < 20; i++ {
+		w.Write([]byte("line\n"))
+	}
+	if files := logFiles(t, w); len(files) != 20 {
+		t.Errorf("%d files after 20 rotations, want 20", len(files))
+	}
+}
+
+func TestWriteAfterClose(t *testing.T) {
+	w, _ := NewRotatingWriter(filepath.Join(t.TempDir(), "app.log"), 100, time.Hour, 1, time.Hour)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("late\n")); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("got %v, want %v", err, os.ErrClosed)
+	}
+	if err := w.Close(); err != nil {
+		t.Errorf("second close: %v", err)
+	}
+}
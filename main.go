@@ -1,27 +1,54 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log"
+	"log/slog"
+	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/MTUCI-Pixel-Team/Picture_Generator/generator"
+	"github.com/MTUCI-Pixel-Team/Picture_Generator/logging"
+	"github.com/MTUCI-Pixel-Team/Picture_Generator/storage"
 	tg "github.com/MTUCI-Pixel-Team/Picture_Generator/tgBot"
 
 	"github.com/joho/godotenv"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 func main() {
-	file, err := os.OpenFile("app.log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	err := godotenv.Load()
 	if err != nil {
-		log.Fatalf("Не удалось открыть файл для логов: %v", err)
+		log.Fatalf("Failed to load .env: %v", err)
 	}
-	defer file.Close()
 
-	// Настраиваем логгер на запись в файл
-	log.SetOutput(file)
-	err = godotenv.Load()
+	level, err := logging.ParseLevel(os.Getenv("LOG_LEVEL"))
 	if err != nil {
-		log.Panic(err)
+		log.Fatalf("Invalid LOG_LEVEL: %v", err)
 	}
+	logFile, err := logging.Setup(logging.Config{
+		Format:     os.Getenv("LOG_FORMAT"),
+		Level:      level,
+		File:       os.Getenv("LOG_FILE"),
+		MaxSize:    int64(envInt("LOG_MAX_SIZE_MB")) << 20,
+		MaxAge:     time.Duration(envInt("LOG_MAX_AGE_HOURS")) * time.Hour,
+		MaxBackups: envInt("LOG_MAX_BACKUPS"),
+		Retention:  time.Duration(envInt("LOG_RETENTION_DAYS")) * 24 * time.Hour,
+		Secrets:    []string{os.Getenv("TG_TOKEN"), os.Getenv("API_KEY2"), os.Getenv("WEBHOOK_SECRET")},
+	})
+	if err != nil {
+		log.Fatalf("Failed to set up logging: %v", err)
+	}
+	defer logFile.Close()
 
 	// c := gp.NewWSClient(os.Getenv("API_KEY2"), 12312)
 
@@ -58,12 +85,216 @@ func main() {
 	// 	time.Sleep(1)
 	// }
 
-	bot, err := tg.NewBot(os.Getenv("TG_TOKEN"))
+	store, err := openStore(os.Getenv("STORAGE_PATH"))
+	if err != nil {
+		fatal("Failed to open storage", err)
+	}
+	defer store.Close()
+
+	gen, err := newGenerator(os.Getenv("GENERATOR"))
+	if err != nil {
+		fatal("Failed to create generator", err)
+	}
+
+	tiers, droppedTiers := envTiers("QUOTA_TIERS")
+	// Без тарифа по умолчанию бот раздал бы его пользователям другой тариф или вовсе снял лимиты
+	if tier := os.Getenv("QUOTA_DEFAULT_TIER"); slices.Contains(droppedTiers, tier) {
+		fatal("Invalid quota configuration", fmt.Errorf("default quota tier %s is invalid", tier))
+	}
+
+	cfg := tg.Config{
+		Token:           os.Getenv("TG_TOKEN"),
+		Workers:         envInt("WORKERS"),
+		QueueSize:       envInt("QUEUE_SIZE"),
+		MaxJobsPerUser:  envInt("MAX_JOBS_PER_USER"),
+		CatalogPath:     os.Getenv("CATALOG_PATH"),
+		Admins:          envIDs("ADMIN_IDS"),
+		ShutdownTimeout: time.Duration(envInt("SHUTDOWN_TIMEOUT")) * time.Second,
+		ProbeInterval:   time.Duration(envInt("PROBE_INTERVAL")) * time.Second,
+		Webhook: tg.WebhookConfig{
+			URL:         os.Getenv("WEBHOOK_URL"),
+			Listen:      os.Getenv("WEBHOOK_LISTEN"),
+			Path:        os.Getenv("WEBHOOK_PATH"),
+			SecretToken: os.Getenv("WEBHOOK_SECRET"),
+			CertFile:    os.Getenv("WEBHOOK_CERT"),
+			KeyFile:     os.Getenv("WEBHOOK_KEY"),
+			UploadCert:  os.Getenv("WEBHOOK_UPLOAD_CERT") == "true",
+		},
+		Quota: tg.QuotaConfig{
+			Tiers:       tiers,
+			DefaultTier: os.Getenv("QUOTA_DEFAULT_TIER"),
+			ResetHour:   envInt("QUOTA_RESET_HOUR"),
+		},
+		Moderation: tg.ModerationConfig{
+			BlocklistPath: os.Getenv("MODERATION_BLOCKLISTS"),
+			DefaultLevel:  os.Getenv("MODERATION_LEVEL"),
+		},
+	}
+	bot, err := tg.NewBot(cfg, store, gen)
 	if err != nil {
-		log.Panic(err)
+		fatal("Failed to create bot", err)
 	}
 
-	go bot.Start()
+	go func() {
+		if err := bot.Start(); err != nil {
+			fatal("Failed to start bot", err)
+		}
+	}()
 
-	select {}
+	// Метрики и проверки здоровья отдаются отдельным сервером, чтобы не светить их наружу вместе с вебхуком
+	var metricsServer *http.Server
+	if listen := os.Getenv("METRICS_LISTEN"); listen != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", promhttp.Handler())
+		mux.Handle("/healthz", bot.HealthHandler())
+		mux.Handle("/readyz", bot.ReadyHandler())
+		metricsServer = &http.Server{Addr: listen, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+		go func() {
+			if err := metricsServer.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				slog.Error("Metrics server stopped", "err", err)
+			}
+		}()
+	}
+
+	// SIGHUP перечитывает каталог моделей и размеров без перезапуска
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	go func() {
+		for range hangup {
+			if err := bot.ReloadCatalog(); err != nil {
+				slog.Error("Failed to reload catalog", "err", err)
+			}
+		}
+	}()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	sig := <-stop
+	slog.Info("Stopping", "signal", sig.String())
+	bot.Shutdown()
+	if metricsServer != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		metricsServer.Shutdown(ctx)
+		cancel()
+	}
+	if err := gen.Close(); err != nil {
+		slog.Error("Failed to close generator", "err", err)
+	}
+}
+
+// fatal logs the error and stops the program.
+func fatal(msg string, err error) {
+	slog.Error(msg, "err", err)
+	os.Exit(1)
+}
+
+// openStore opens the database. ":memory:" keeps everything in memory only and a path ending
+// with .json opens the old single-file store. A new database takes the data of the JSON file
+// with the same name, so storage.db starts with everything saved in storage.json.
+func openStore(path string) (storage.Store, error) {
+	switch {
+	case path == ":memory:":
+		return storage.NewMemoryStore(), nil
+	case strings.HasSuffix(path, ".json"):
+		return storage.OpenFileStore(path)
+	case path == "":
+		path = "storage.db"
+	}
+	_, statErr := os.Stat(path)
+	store, err := storage.OpenBoltStore(path)
+	if err != nil {
+		return nil, err
+	}
+	if !errors.Is(statErr, os.ErrNotExist) {
+		return store, nil
+	}
+
+	legacyPath := strings.TrimSuffix(path, filepath.Ext(path)) + ".json"
+	if _, err := os.Stat(legacyPath); err != nil {
+		return store, nil
+	}
+	legacy, err := storage.OpenFileStore(legacyPath)
+	if err == nil {
+		err = legacy.CopyTo(store)
+		legacy.Close()
+	}
+	if err != nil {
+		// Неполный импорт не должен остаться: при следующем запуске он начнётся заново
+		store.Close()
+		os.Remove(path)
+		return nil, fmt.Errorf("import %s: %w", legacyPath, err)
+	}
+	slog.Info("Storage imported", "from", legacyPath, "to", path)
+	return store, nil
+}
+
+// newGenerator picks the image generator. "fake" renders placeholders locally without runware.
+func newGenerator(kind string) (generator.ImageGenerator, error) {
+	switch kind {
+	case "fake":
+		return generator.NewFake(2 * time.Second), nil
+	case "", "runware":
+		return generator.NewRunware(os.Getenv("API_KEY2"))
+	}
+	return nil, fmt.Errorf("unknown generator %q", kind)
+}
+
+// envInt reads a numeric variable. Zero means "not set" and lets the bot use its default.
+func envInt(name string) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return 0
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		slog.Warn("Ignore invalid variable", "name", name, "value", value, "err", err)
+		return 0
+	}
+	return n
+}
+
+// envIDs reads a comma separated list of chat ids.
+func envIDs(name string) []int64 {
+	var ids []int64
+	for _, value := range strings.Split(os.Getenv(name), ",") {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			slog.Warn("Ignore invalid list item", "name", name, "item", value, "err", err)
+			continue
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// envTiers reads quota tiers as a comma separated list of name:images:credits,
+// e.g. "free:20:100,premium:200:2000". Zero means no limit. Invalid tiers are skipped
+// and their names are returned as dropped.
+func envTiers(name string) (tiers map[string]tg.QuotaLimits, dropped []string) {
+	tiers = make(map[string]tg.QuotaLimits)
+	for _, value := range strings.Split(os.Getenv(name), ",") {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		parts := strings.Split(value, ":")
+		if len(parts) != 3 {
+			slog.Warn("Ignore invalid tier, want name:images:credits", "name", name, "item", value)
+			dropped = append(dropped, parts[0])
+			continue
+		}
+		images, err1 := strconv.Atoi(parts[1])
+		credits, err2 := strconv.Atoi(parts[2])
+		if err1 != nil || err2 != nil || images < 0 || credits < 0 {
+			slog.Warn("Ignore invalid tier, limits must be non-negative numbers", "name", name, "item", value)
+			dropped = append(dropped, parts[0])
+			continue
+		}
+		tiers[parts[0]] = tg.QuotaLimits{Images: images, Credits: credits}
+	}
+	return tiers, dropped
 }
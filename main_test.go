@@ -0,0 +1,29 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	tg "github.com/MTUCI-Pixel-Team/Picture_Generator/tgBot"
+)
+
+func TestEnvTiers(t *testing.T) {
+	tests := []struct {
+		value       string
+		want        map[string]tg.QuotaLimits
+		wantDropped []string
+	}{
+		{"", map[string]tg.QuotaLimits{}, nil},
+		{"free:20:100, premium:0:2000", map[string]tg.QuotaLimits{"free": {Images: 20, Credits: 100}, "premium": {Credits: 2000}}, nil},
+		{"free:20", map[string]tg.QuotaLimits{}, []string{"free"}},
+		{"free:20:100,premium:x:1", map[string]tg.QuotaLimits{"free": {Images: 20, Credits: 100}}, []string{"premium"}},
+		{"free:-1:100", map[string]tg.QuotaLimits{}, []string{"free"}},
+	}
+	for _, tt := range tests {
+		t.Setenv("TEST_TIERS", tt.value)
+		got, dropped := envTiers("TEST_TIERS")
+		if !reflect.DeepEqual(got, tt.want) || !reflect.DeepEqual(dropped, tt.wantDropped) {
+			t.Errorf("%q: got %v and dropped %v, want %v and %v", tt.value, got, dropped, tt.want, tt.wantDropped)
+		}
+	}
+}
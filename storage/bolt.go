@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// BoltStore keeps the buckets in a bbolt database file. A change writes only the pages
+// it touches, and keys are sorted, so a prefix is read without scanning the whole bucket.
+type BoltStore struct {
+	db *bolt.DB
+}
+
+// OpenBoltStore opens or creates the database. It fails if another process holds the file.
+func OpenBoltStore(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("open storage %s: %w", path, err)
+	}
+	return &BoltStore{db: db}, nil
+}
+
+func (s *BoltStore) Get(bucket, key string, v any) (bool, error) {
+	found := false
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return nil
+		}
+		data := b.Get([]byte(key))
+		if data == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(data, v)
+	})
+	return found, closedErr(err)
+}
+
+func (s *BoltStore) Put(bucket, key string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return closedErr(s.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(bucket))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(key), data)
+	}))
+}
+
+func (s *BoltStore) Delete(bucket, key string) error {
+	return closedErr(s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return nil
+		}
+		return b.Delete([]byte(key))
+	}))
+}
+
+func (s *BoltStore) ForEach(bucket string, fn func(key string, data []byte) error) error {
+	return s.ForEachPrefix(bucket, "", fn)
+}
+
+func (s *BoltStore) ForEachPrefix(bucket, prefix string, fn func(key string, data []byte) error) error {
+	return closedErr(s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return nil
+		}
+		c := b.Cursor()
+		for key, data := c.Seek([]byte(prefix)); key != nil && bytes.HasPrefix(key, []byte(prefix)); key, data = c.Next() {
+			if err := fn(string(key), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+}
+
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
+
+// closedErr turns the error of a closed database into ErrClosed, like the other stores return.
+func closedErr(err error) error {
+	if errors.Is(err, bolt.ErrDatabaseNotOpen) {
+		return ErrClosed
+	}
+	return err
+}
@@ -0,0 +1,141 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// FileStore is a single JSON file. The whole content is kept in memory and the file is
+// rewritten after every change, so it is meant for small amounts of data and for tests.
+// BoltStore is the storage for production.
+type FileStore struct {
+	mu     sync.RWMutex
+	path   string
+	data   buckets
+	closed bool
+}
+
+func OpenFileStore(path string) (*FileStore, error) {
+	s := &FileStore{path: path, data: make(buckets)}
+
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read storage file: %w", err)
+	}
+	if len(content) == 0 {
+		return s, nil
+	}
+	if err := json.Unmarshal(content, &s.data); err != nil {
+		return nil, fmt.Errorf("decode storage file: %w", err)
+	}
+	return s, nil
+}
+
+func (s *FileStore) Get(bucket, key string, v any) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return false, ErrClosed
+	}
+	return s.data.get(bucket, key, v)
+}
+
+func (s *FileStore) Put(bucket, key string, v any) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrClosed
+	}
+	if err := s.data.put(bucket, key, v); err != nil {
+		return err
+	}
+	return s.flush()
+}
+
+func (s *FileStore) Delete(bucket, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrClosed
+	}
+	s.data.delete(bucket, key)
+	return s.flush()
+}
+
+func (s *FileStore) ForEach(bucket string, fn func(key string, data []byte) error) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return ErrClosed
+	}
+	return s.data.forEach(bucket, "", fn)
+}
+
+func (s *FileStore) ForEachPrefix(bucket, prefix string, fn func(key string, data []byte) error) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return ErrClosed
+	}
+	return s.data.forEach(bucket, prefix, fn)
+}
+
+func (s *FileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	return s.flush()
+}
+
+// flush writes data to a temporary file and renames it, so the file is never left half-written.
+func (s *FileStore) flush() error {
+	content, err := json.Marshal(s.data)
+	if err != nil {
+		return fmt.Errorf("encode storage: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write storage: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("sync storage: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// CopyTo puts every record into dst, it moves the data of an old JSON file to another store.
+func (s *FileStore) CopyTo(dst Store) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return ErrClosed
+	}
+	for bucket, records := range s.data {
+		for key, data := range records {
+			if err := dst.Put(bucket, key, data); err != nil {
+				return fmt.Errorf("copy %s/%s: %w", bucket, key, err)
+			}
+		}
+	}
+	return nil
+}
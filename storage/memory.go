@@ -0,0 +1,67 @@
+package storage
+
+import "sync"
+
+// MemoryStore keeps everything in process memory. Data is lost on restart.
+type MemoryStore struct {
+	mu     sync.RWMutex
+	data   buckets
+	closed bool
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{data: make(buckets)}
+}
+
+func (s *MemoryStore) Get(bucket, key string, v any) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return false, ErrClosed
+	}
+	return s.data.get(bucket, key, v)
+}
+
+func (s *MemoryStore) Put(bucket, key string, v any) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrClosed
+	}
+	return s.data.put(bucket, key, v)
+}
+
+func (s *MemoryStore) Delete(bucket, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrClosed
+	}
+	s.data.delete(bucket, key)
+	return nil
+}
+
+func (s *MemoryStore) ForEach(bucket string, fn func(key string, data []byte) error) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return ErrClosed
+	}
+	return s.data.forEach(bucket, "", fn)
+}
+
+func (s *MemoryStore) ForEachPrefix(bucket, prefix string, fn func(key string, data []byte) error) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return ErrClosed
+	}
+	return s.data.forEach(bucket, prefix, fn)
+}
+
+func (s *MemoryStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return nil
+}
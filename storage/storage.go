@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+)
+
+// Store is a small key-value storage split into named buckets.
+// Values are kept as JSON, so any serializable struct can be saved.
+type Store interface {
+	// Get decodes the value stored under key into v. It reports false if there is no such key.
+	Get(bucket, key string, v any) (bool, error)
+	Put(bucket, key string, v any) error
+	Delete(bucket, key string) error
+	// ForEach calls fn for every key of the bucket in key order with the raw JSON value.
+	// data is valid only during the call and fn must not change the store.
+	ForEach(bucket string, fn func(key string, data []byte) error) error
+	// ForEachPrefix is ForEach for the keys that start with prefix, it doesn't read the rest of the bucket.
+	ForEachPrefix(bucket, prefix string, fn func(key string, data []byte) error) error
+	Close() error
+}
+
+var ErrClosed = errors.New("storage is closed")
+
+type buckets map[string]map[string]json.RawMessage
+
+func (b buckets) get(bucket, key string, v any) (bool, error) {
+	data, ok := b[bucket][key]
+	if !ok {
+		return false, nil
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return true, err
+	}
+	return true, nil
+}
+
+func (b buckets) put(bucket, key string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if b[bucket] == nil {
+		b[bucket] = make(map[string]json.RawMessage)
+	}
+	b[bucket][key] = data
+	return nil
+}
+
+func (b buckets) delete(bucket, key string) {
+	delete(b[bucket], key)
+}
+
+func (b buckets) forEach(bucket, prefix string, fn func(key string, data []byte) error) error {
+	keys := make([]string, 0, len(b[bucket]))
+	for key := range b[bucket] {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := fn(key, b[bucket][key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
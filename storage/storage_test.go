@@ -0,0 +1,247 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+type record struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// stores opens every implementation in a temporary directory.
+func stores(t *testing.T) map[string]Store {
+	dir := t.TempDir()
+	file, err := OpenFileStore(filepath.Join(dir, "storage.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bolt, err := OpenBoltStore(filepath.Join(dir, "storage.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string]Store{"memory": NewMemoryStore(), "file": file, "bolt": bolt}
+}
+
+func keys(t *testing.T, s Store, bucket, prefix string) []string {
+	var got []string
+	err := s.ForEachPrefix(bucket, prefix, func(key string, data []byte) error {
+		got = append(got, key)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return got
+}
+
+func TestStoreRoundTrip(t *testing.T) {
+	for name, s := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			defer s.Close()
+			var got record
+			if found, err := s.Get("missing", "key", &got); found || err != nil {
+				t.Fatalf("missing bucket: found %v, err %v", found, err)
+			}
+
+			want := record{Name: "first", Count: 3}
+			if err := s.Put("records", "a", want); err != nil {
+				t.Fatal(err)
+			}
+			if found, err := s.Get("records", "a", &got); !found || err != nil || got != want {
+				t.Fatalf("got %+v, found %v, err %v", got, found, err)
+			}
+			if found, _ := s.Get("records", "b", &got); found {
+				t.Fatal("missing key is found")
+			}
+			if found, _ := s.Get("other", "a", &got); found {
+				t.Fatal("key is found in another bucket")
+			}
+
+			want.Count = 4
+			s.Put("records", "a", want)
+			if s.Get("records", "a", &got); got != want {
+				t.Fatalf("overwritten value %+v, want %+v", got, want)
+			}
+
+			if err := s.Delete("records", "a"); err != nil {
+				t.Fatal(err)
+			}
+			if found, _ := s.Get("records", "a", &got); found {
+				t.Fatal("deleted key is found")
+			}
+			if err := s.Delete("missing", "a"); err != nil {
+				t.Fatalf("delete from a missing bucket: %v", err)
+			}
+		})
+	}
+}
+
+func TestStoreForEachPrefix(t *testing.T) {
+	for name, s := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			defer s.Close()
+			for _, key := range []string{"2:b", "12:a", "1:b", "1:a", "10:a"} {
+				s.Put("chats", key, record{Name: key})
+			}
+			tests := []struct {
+				prefix string
+				want   []string
+			}{
+				{"", []string{"10:a", "12:a", "1:a", "1:b", "2:b"}},
+				{"1:", []string{"1:a", "1:b"}},
+				{"2:", []string{"2:b"}},
+				{"3:", nil},
+			}
+			for _, tt := range tests {
+				if got := keys(t, s, "chats", tt.prefix); !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("prefix %q: got %v, want %v", tt.prefix, got, tt.want)
+				}
+			}
+			if got := keys(t, s, "missing", ""); got != nil {
+				t.Errorf("missing bucket has keys %v", got)
+			}
+
+			stop := errors.New("stop")
+			calls := 0
+			err := s.ForEach("chats", func(key string, data []byte) error {
+				calls++
+				return stop
+			})
+			if !errors.Is(err, stop) || calls != 1 {
+				t.Errorf("error of fn is not returned at once: %v after %d calls", err, calls)
+			}
+		})
+	}
+}
+
+func TestStoreClosed(t *testing.T) {
+	for name, s := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			if err := s.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := s.Get("records", "a", &record{}); !errors.Is(err, ErrClosed) {
+				t.Errorf("Get: %v", err)
+			}
+			if err := s.Put("records", "a", record{}); !errors.Is(err, ErrClosed) {
+				t.Errorf("Put: %v", err)
+			}
+			if err := s.ForEach("records", func(string, []byte) error { return nil }); !errors.Is(err, ErrClosed) {
+				t.Errorf("ForEach: %v", err)
+			}
+		})
+	}
+}
+
+func TestStoreReopen(t *testing.T) {
+	open := map[string]func(path string) (Store, error){
+		"file": func(path string) (Store, error) { return OpenFileStore(path) },
+		"bolt": func(path string) (Store, error) { return OpenBoltStore(path) },
+	}
+	for name, openStore := range open {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "storage")
+			s, err := openStore(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s.Put("records", "kept", record{Name: "kept", Count: 1})
+			s.Put("records", "deleted", record{Name: "deleted"})
+			s.Delete("records", "deleted")
+			if err := s.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			s, err = openStore(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+			var got record
+			if found, err := s.Get("records", "kept", &got); !found || err != nil || got.Count != 1 {
+				t.Errorf("after reopen got %+v, found %v, err %v", got, found, err)
+			}
+			if found, _ := s.Get("records", "deleted", &got); found {
+				t.Error("deleted record is back after reopen")
+			}
+		})
+	}
+}
+
+func TestStoreCorruptFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		open    func(path string) error
+	}{
+		{"file truncated", `{"records":{"a":{"name":`, func(path string) error {
+			_, err := OpenFileStore(path)
+			return err
+		}},
+		{"file not an object", `[1, 2]`, func(path string) error {
+			_, err := OpenFileStore(path)
+			return err
+		}},
+		{"bolt garbage", "this is not a database, just some text that is long enough", func(path string) error {
+			s, err := OpenBoltStore(path)
+			if err == nil {
+				s.Close()
+			}
+			return err
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "storage")
+			os.WriteFile(path, []byte(tt.content), 0o600)
+			if err := tt.open(path); err == nil {
+				t.Fatal("corrupt file is opened")
+			}
+			// Испорченный файл не перезаписывается, его можно восстановить вручную
+			if content, _ := os.ReadFile(path); string(content) != tt.content {
+				t.Errorf("corrupt file is changed: %q", content)
+			}
+		})
+	}
+}
+
+func TestFileStoreEmptyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "storage.json")
+	os.WriteFile(path, nil, 0o600)
+	s, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatalf("empty file: %v", err)
+	}
+	defer s.Close()
+	if got := keys(t, s, "records", ""); got != nil {
+		t.Errorf("empty file has keys %v", got)
+	}
+}
+
+func TestFileStoreCopyTo(t *testing.T) {
+	dir := t.TempDir()
+	file, _ := OpenFileStore(filepath.Join(dir, "storage.json"))
+	file.Put("settings", "1", record{Name: "one", Count: 1})
+	file.Put("history", "1:a", record{Name: "a"})
+	bolt, err := OpenBoltStore(filepath.Join(dir, "storage.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bolt.Close()
+
+	if err := file.CopyTo(bolt); err != nil {
+		t.Fatal(err)
+	}
+	var got record
+	if found, _ := bolt.Get("settings", "1", &got); !found || got != (record{Name: "one", Count: 1}) {
+		t.Errorf("settings after copy: %+v", got)
+	}
+	if got := keys(t, bolt, "history", "1:"); !reflect.DeepEqual(got, []string{"1:a"}) {
+		t.Errorf("history after copy: %v", got)
+	}
+}
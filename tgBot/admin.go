@@ -0,0 +1,291 @@
+package tgBot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	bansBucket  = "bans"
+	statsBucket = "stats"
+	// statsRetention is how long the daily statistics are kept.
+	statsRetention = 30 * 24 * time.Hour
+	statsDays      = 7
+	statsTopModels = 5
+	// broadcastInterval keeps the broadcast under the limit of Telegram of 30 messages per second.
+	broadcastInterval = 50 * time.Millisecond
+)
+
+// ban forbids the chat to use the bot. The user is told about it once, later messages are ignored.
+type ban struct {
+	ChatID    int64     `json:"chatId"`
+	By        int64     `json:"by"`
+	Notified  bool      `json:"notified"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// dayStats counts the jobs of a day, the key is the date.
+type dayStats struct {
+	Users     map[int64]int  `json:"users"`
+	Models    map[string]int `json:"models"`
+	Jobs      int            `json:"jobs"`
+	Failures  int            `json:"failures"`
+	CreatedAt time.Time      `json:"createdAt"`
+}
+
+func statsKey(t time.Time) string {
+	return t.Format(time.DateOnly)
+}
+
+func (b *Bot) loadBans() error {
+	count := 0
+	defer func() { slog.Info("Bans loaded", "count", count) }()
+	return b.store.ForEach(bansBucket, func(key string, data []byte) error {
+		chatID, err := strconv.ParseInt(key, 10, 64)
+		if err != nil {
+			slog.Warn("Skip ban with invalid chat id", "key", key)
+			return nil
+		}
+		var record ban
+		if err := json.Unmarshal(data, &record); err != nil {
+			slog.Warn("Skip broken ban", "chat_id", chatID, "err", err)
+			return nil
+		}
+		b.bans.Store(chatID, &record)
+		count++
+		return nil
+	})
+}
+
+// blocked reports whether the update comes from a banned chat and refuses it.
+func (b *Bot) blocked(update tgbotapi.Update) bool {
+	var chatID int64
+	switch {
+	case update.CallbackQuery != nil && update.CallbackQuery.Message != nil:
+		chatID = update.CallbackQuery.Message.Chat.ID
+	case update.Message != nil:
+		chatID = update.Message.Chat.ID
+	default:
+		return false
+	}
+	value, ok := b.bans.Load(chatID)
+	if !ok {
+		return false
+	}
+	if update.CallbackQuery != nil {
+		// Ответ без текста, чтобы у кнопки пропали часики
+		b.tg.Request(tgbotapi.NewCallback(update.CallbackQuery.ID, ""))
+		return true
+	}
+	record := value.(*ban)
+	if !record.Notified {
+		record.Notified = true
+		b.store.Put(bansBucket, strconv.FormatInt(chatID, 10), record)
+		b.tg.Send(tgbotapi.NewMessage(chatID, b.text(chatID, "banned")))
+	}
+	return true
+}
+
+// recordJob counts the finished job in the statistics of the day. Cancelled jobs are not counted.
+func (b *Bot) recordJob(j *job, err error) {
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+	b.statsMu.Lock()
+	defer b.statsMu.Unlock()
+
+	now := time.Now()
+	var stats dayStats
+	if _, getErr := b.store.Get(statsBucket, statsKey(now), &stats); getErr != nil {
+		slog.Error("Failed to load statistics", "err", getErr)
+	}
+	if stats.Users == nil {
+		stats = dayStats{Users: map[int64]int{}, Models: map[string]int{}, CreatedAt: now}
+	}
+	stats.Jobs++
+	stats.Users[j.chatID]++
+	if err != nil {
+		stats.Failures++
+	}
+	if j.kind == jobGenerate {
+		stats.Models[j.settings.model]++
+	}
+	if putErr := b.store.Put(statsBucket, statsKey(now), stats); putErr != nil {
+		slog.Error("Failed to save statistics", "err", putErr)
+	}
+}
+
+// statsText sums up the statistics of today and of the last statsDays days.
+func (b *Bot) statsText(lang string) string {
+	// Известные - все, у кого сохранены настройки, активные - с заданиями за период
+	known, banned := 0, 0
+	b.userSettings.Range(func(_, _ any) bool {
+		known++
+		return true
+	})
+	b.bans.Range(func(_, _ any) bool {
+		banned++
+		return true
+	})
+
+	var today dayStats
+	week := dayStats{Users: map[int64]int{}, Models: map[string]int{}}
+	now := time.Now()
+	for day := 0; day < statsDays; day++ {
+		var stats dayStats
+		if found, err := b.store.Get(statsBucket, statsKey(now.AddDate(0, 0, -day)), &stats); err != nil || !found {
+			continue
+		}
+		if day == 0 {
+			today = stats
+		}
+		week.Jobs += stats.Jobs
+		week.Failures += stats.Failures
+		for chatID, jobs := range stats.Users {
+			week.Users[chatID] += jobs
+		}
+		for model, jobs := range stats.Models {
+			week.Models[model] += jobs
+		}
+	}
+	pending, running := b.queue.depth()
+
+	var text strings.Builder
+	text.WriteString(tr(lang, "stats.text", known, banned, len(today.Users), len(week.Users),
+		today.Jobs, today.Failures, week.Jobs, week.Failures, pending, running))
+
+	models := make([]string, 0, len(week.Models))
+	for model := range week.Models {
+		models = append(models, model)
+	}
+	sort.Slice(models, func(i, k int) bool { return week.Models[models[i]] > week.Models[models[k]] })
+	if len(models) > 0 {
+		text.WriteString("\n\n")
+		text.WriteString(tr(lang, "stats.top_models"))
+	}
+	for i, model := range models[:min(len(models), statsTopModels)] {
+		name, ok := options().modelName(model)
+		if !ok {
+			name = model
+		}
+		text.WriteString("\n")
+		text.WriteString(tr(lang, "stats.model", i+1, name, week.Models[model]))
+	}
+	return text.String()
+}
+
+func handleStats(b *Bot, chatID int64) {
+	if !b.cfg.isAdmin(chatID) {
+		b.tg.Send(tgbotapi.NewMessage(chatID, b.text(chatID, "admin.only")))
+		return
+	}
+	b.tg.Send(tgbotapi.NewMessage(chatID, b.statsText(b.getSettings(chatID).language)))
+}
+
+// handleBan processes /ban <chat id> and /unban <chat id>.
+func handleBan(b *Bot, args string, chatID int64, banned bool) {
+	if !b.cfg.isAdmin(chatID) {
+		b.tg.Send(tgbotapi.NewMessage(chatID, b.text(chatID, "admin.only")))
+		return
+	}
+	target, err := strconv.ParseInt(strings.TrimSpace(args), 10, 64)
+	if err != nil {
+		b.tg.Send(tgbotapi.NewMessage(chatID, b.text(chatID, "ban.usage")))
+		return
+	}
+	key := strconv.FormatInt(target, 10)
+	_, exists := b.bans.Load(target)
+	var text string
+	switch {
+	case banned && b.cfg.isAdmin(target):
+		text = b.text(chatID, "ban.admin")
+	case banned && exists:
+		text = b.text(chatID, "ban.already", target)
+	case banned:
+		record := &ban{ChatID: target, By: chatID, CreatedAt: time.Now()}
+		if err := b.store.Put(bansBucket, key, record); err != nil {
+			slog.Error("Failed to save ban", "chat_id", target, "err", err)
+			text = b.text(chatID, "ban.error")
+			break
+		}
+		b.bans.Store(target, record)
+		// Задания заблокированного пользователя больше не нужны
+		removed, _ := b.queue.cancelUser(target)
+		for _, j := range removed {
+			b.deleteMessage(j.chatID, j.statusMsg)
+		}
+		slog.Info("Chat banned", "chat_id", target, "admin_id", chatID)
+		text = b.text(chatID, "ban.done", target)
+	case !exists:
+		text = b.text(chatID, "ban.not_banned", target)
+	default:
+		if err := b.store.Delete(bansBucket, key); err != nil {
+			slog.Error("Failed to delete ban", "chat_id", target, "err", err)
+			text = b.text(chatID, "ban.error")
+			break
+		}
+		b.bans.Delete(target)
+		slog.Info("Chat unbanned", "chat_id", target, "admin_id", chatID)
+		text = b.text(chatID, "ban.removed", target)
+	}
+	b.tg.Send(tgbotapi.NewMessage(chatID, text))
+}
+
+// handleBroadcast sends the text to every known chat except the banned ones.
+// Messages go out one by one with broadcastInterval between them, the admin gets a report at the end.
+func handleBroadcast(b *Bot, text string, chatID int64) {
+	if !b.cfg.isAdmin(chatID) {
+		b.tg.Send(tgbotapi.NewMessage(chatID, b.text(chatID, "admin.only")))
+		return
+	}
+	text = strings.TrimSpace(text)
+	if text == "" {
+		b.tg.Send(tgbotapi.NewMessage(chatID, b.text(chatID, "broadcast.usage")))
+		return
+	}
+	if !b.broadcasting.CompareAndSwap(false, true) {
+		b.tg.Send(tgbotapi.NewMessage(chatID, b.text(chatID, "broadcast.busy")))
+		return
+	}
+
+	var recipients []int64
+	b.userSettings.Range(func(key, _ any) bool {
+		if _, banned := b.bans.Load(key); !banned {
+			recipients = append(recipients, key.(int64))
+		}
+		return true
+	})
+	b.tg.Send(tgbotapi.NewMessage(chatID, b.text(chatID, "broadcast.start", len(recipients))))
+	slog.Info("Broadcast started", "admin_id", chatID, "recipients", len(recipients))
+
+	go func() {
+		defer b.broadcasting.Store(false)
+		ticker := time.NewTicker(broadcastInterval)
+		defer ticker.Stop()
+		delivered, failed := 0, 0
+		for _, recipient := range recipients {
+			select {
+			case <-ticker.C:
+			case <-b.ctx.Done():
+				slog.Warn("Broadcast interrupted", "delivered", delivered, "failed", failed)
+				return
+			}
+			if _, err := b.tg.Send(tgbotapi.NewMessage(recipient, text)); err != nil {
+				slog.Warn("Broadcast message failed", "chat_id", recipient, "err", err)
+				failed++
+				continue
+			}
+			delivered++
+		}
+		slog.Info("Broadcast finished", "delivered", delivered, "failed", failed)
+		b.tg.Send(tgbotapi.NewMessage(chatID, b.text(chatID, "broadcast.done", delivered, failed)))
+	}()
+}
@@ -0,0 +1,31 @@
+package tgBot
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MTUCI-Pixel-Team/Picture_Generator/storage"
+)
+
+func TestStatsCountsActiveUsers(t *testing.T) {
+	b := &Bot{store: storage.NewMemoryStore(), queue: newJobQueue(10, 10)}
+	// Пятеро сохранили настройки, но задания были только у двоих
+	for chatID := int64(1); chatID <= 5; chatID++ {
+		b.userSettings.Store(chatID, &UserSettings{})
+	}
+	b.recordJob(b.queue.newJob(context.Background(), jobDescribe, 1), nil)
+	b.recordJob(b.queue.newJob(context.Background(), jobDescribe, 1), nil)
+	old := dayStats{Users: map[int64]int{2: 1, 3: 1}, Models: map[string]int{}, CreatedAt: time.Now()}
+	b.store.Put(statsBucket, statsKey(time.Now().AddDate(0, 0, -3)), old)
+	expired := dayStats{Users: map[int64]int{4: 1}, Models: map[string]int{}, CreatedAt: time.Now()}
+	b.store.Put(statsBucket, statsKey(time.Now().AddDate(0, 0, -statsDays)), expired)
+
+	text := b.statsText("en")
+	for _, want := range []string{"Known users: 5, banned: 0", "Active today: 1, for 7 days: 3", "Jobs today: 2, failed: 0"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("statistics don't say %q:\n%s", want, text)
+		}
+	}
+}
@@ -3,14 +3,15 @@ package tgBot
 import (
 	"context"
 	"errors"
-	"io"
-	"log"
+	"fmt"
+	"log/slog"
 	"net/http"
-	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	pg "github.com/prorok210/WS_Client-for_runware.ai-"
+	"github.com/MTUCI-Pixel-Team/Picture_Generator/generator"
+	"github.com/MTUCI-Pixel-Team/Picture_Generator/storage"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
@@ -23,7 +24,13 @@ type UserSettings struct {
 	state              string
 	numberResults      int
 	scheduler          string
-	generatingMsgId    int
+	negativePrompt     string
+	seed               int64   // 0 - случайный seed
+	cfgScale           float64 // 0 - значение по умолчанию для модели
+	strength           float64
+	pendingPhoto       string // Фото, для которого ждём описание
+	enhance            bool
+	language           string // Пусто, пока язык не определён
 	powerOffStartTimer time.Time
 	// Добавьте другие поля, которые могут быть полезны
 }
@@ -33,155 +40,206 @@ type Bot struct {
 	ctx          context.Context
 	cancel       context.CancelFunc
 	userSettings sync.Map
+	store        storage.Store
+	generator    generator.ImageGenerator
+	cfg          Config
+	queue        *jobQueue
+	workers      sync.WaitGroup
+	stopping     atomic.Bool
+	webhook      atomic.Pointer[webhookServer] // Пусто, пока вебхук не установлен
+	bans         sync.Map                      // chatID -> *ban
+	statsMu      sync.Mutex
+	broadcasting atomic.Bool
+	quotaMu      sync.Mutex
+	health       *healthState
+	moderationMu sync.RWMutex
+	blocklists   map[string]*blocklist // Язык -> правила
+	// moderationLevels keeps the levels set by admins, chatID -> level.
+	moderationLevels sync.Map
 }
 
-var (
-	defaultModel         = "runware:100@1@1"
-	defaultSteps         = 10
-	defaultSize          = [2]int{512, 512}
-	defaultState         = "done"
-	defaultNumberResults = 1
-	defaultScheduler     = "Default"
-	defaultSettings      = &UserSettings{
-		steps:         defaultSteps,
-		model:         defaultModel,
-		state:         defaultState,
-		width:         defaultSize[0],
-		heigth:        defaultSize[1],
-		numberResults: defaultNumberResults,
-		scheduler:     defaultScheduler,
-	}
-)
-
-var serviceCommands = []string{"/start", "/help", "/models", "/steps", "/size", "/number_results", "/schedulers", "/power_off"}
-
-var modelsOptions = map[string]string{
-	"default":               "runware:100@1@1",
-	"epicRealism":           "civitai:25694@143906",
-	"JuggernautXL":          "civitai:133005@782002",
-	"Realistic vision":      "civitai:4201@501240",
-	"Realistic vision V6.0": "civitai:4201@501240",
-	"Dream Shaper":          "civitai:4384@128713",
-	"ReV Animated":          "civitai:7371@425083",
-	"FLUX":                  "civitai:618692@691639",
-	"SD XL":                 "civitai:101055@128078",
-	"GhostMix (Anime)":      "civitai:36520@53738",
-	"epicRealism V2":        "civitai:25694@94744",
-	"AbsoluteReality":       "civitai:81458@132760",
-	"CyberRealistic":        "civitai:15003@114429",
-}
+var defaultState = "done"
 
-var stepsOptions = []int{10, 15, 20, 30, 50, 75, 100}
-var numberResultsOptions = []int{1, 2, 3, 4, 5, 10}
+var serviceCommands = []string{"/start", "/help", "/models", "/steps", "/size", "/number_results", "/schedulers", "/power_off", "/language"}
 
-var schedulersOptions = []string{"Default", "DDIMScheduler", "DEISMultistepScheduler", "HeunDiscreteScheduler", "KarrasVeScheduler", "DPM++ SDE"}
+// negativePromptMaxLength is a limit of the provider for the negative prompt.
+const negativePromptMaxLength = 2000
 
-var sizeOptions = map[string][2]int{
-	"default 512x512 (1:1)": {512, 512},
-	"1024x1024 (1:1)":       {1024, 1024},
-	"768x768 (1:1)":         {768, 768},
-	"2048x2048 (1:1)":       {2048, 2048},
-	"768x512 (3:2)":         {768, 512},
-	"1920x1280 (3:2)":       {1920, 1280},
-	"2048x1536 (4:3)":       {2048, 1536},
-	"1024x768 (4:3)":        {1024, 768},
-	"1536x2048 (3:4)":       {1536, 2048},
-	"768x1024 (3:4)":        {768, 1024},
-	"2048x1152 (16:9)":      {2048, 1152},
-	"1024x1792 (9:16)":      {1024, 1792},
-}
-
-var connectionUsers = make(map[int64]*pg.WSClient)
-
-func NewBot(token string) (*Bot, error) {
-	if token == "" {
+func NewBot(cfg Config, store storage.Store, gen generator.ImageGenerator) (*Bot, error) {
+	if cfg.Token == "" {
 		return nil, errors.New("token is empty")
 	}
+	if store == nil {
+		return nil, errors.New("store is nil")
+	}
+	if gen == nil {
+		return nil, errors.New("generator is nil")
+	}
 
-	tgBot, err := tgbotapi.NewBotAPI(token)
+	cfg.setDefaults()
+	if err := cfg.Webhook.setDefaults(); err != nil {
+		return nil, err
+	}
+	if err := cfg.Quota.setDefaults(); err != nil {
+		return nil, err
+	}
+	if err := cfg.Moderation.setDefaults(); err != nil {
+		return nil, err
+	}
+	if cfg.CatalogPath != "" {
+		catalog, err := LoadCatalog(cfg.CatalogPath)
+		if err != nil {
+			return nil, err
+		}
+		currentCatalog.Store(catalog)
+	}
+
+	health := &healthState{}
+	tgBot, err := tgbotapi.NewBotAPIWithClient(cfg.Token, tgbotapi.APIEndpoint, countingClient{&http.Client{}, health})
 	if err != nil {
 		return nil, err
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 
-	return &Bot{
+	bot := &Bot{
 		tg:           tgBot,
 		ctx:          ctx,
 		cancel:       cancel,
 		userSettings: sync.Map{}, // Инициализируем карту
-	}, nil
+		store:        store,
+		generator:    gen,
+		cfg:          cfg,
+		queue:        newJobQueue(cfg.QueueSize, cfg.MaxJobsPerUser),
+		health:       health,
+	}
+	if err := bot.loadAllSettings(); err != nil {
+		cancel()
+		return nil, err
+	}
+	if err := bot.loadBans(); err != nil {
+		cancel()
+		return nil, err
+	}
+	if err := bot.loadModeration(); err != nil {
+		cancel()
+		return nil, err
+	}
+	for _, bucket := range []string{imagesBucket, historyBucket, promptsBucket} {
+		if err := bot.migrateChatKeys(bucket); err != nil {
+			cancel()
+			return nil, err
+		}
+	}
+	bot.pruneAll()
+	bot.registerGauges()
+	return bot, nil
 }
 
-func (b *Bot) Start() {
-	log.Println("Bot is starting")
-	u := tgbotapi.NewUpdate(0)
-	u.Timeout = 60
+// Start receives updates until Shutdown. It returns an error only if updates can't be received at all.
+func (b *Bot) Start() error {
+	slog.Info("Bot is starting")
 	b.tg.Buffer = 100
+	updates, err := b.updates()
+	if err != nil {
+		return err
+	}
 
-	updates := b.tg.GetUpdatesChan(u)
-
-	var wg sync.WaitGroup
-	for update := range updates {
-		if update.Message == nil {
+	b.queue.work(b.cfg.Workers, &b.workers, b.runJob)
+	go b.probeGenerator()
+	go b.registerCommands()
+	go b.pruneLoop()
+
+	b.health.mu.Lock()
+	b.health.loopActive, b.health.polling = true, !b.cfg.Webhook.enabled()
+	b.health.lastBeat, b.health.lastPoll = time.Now(), time.Now()
+	b.health.mu.Unlock()
+	defer func() {
+		b.health.mu.Lock()
+		b.health.loopActive = false
+		b.health.mu.Unlock()
+	}()
+	// Таймер будит цикл без обновлений, чтобы /healthz видел, что он не завис
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		var update tgbotapi.Update
+		select {
+		case u, ok := <-updates:
+			if !ok {
+				return nil
+			}
+			update = u
+		case <-heartbeat.C:
+			b.health.beat()
 			continue
+		case <-b.ctx.Done():
+			// Канал вебхука не закрывается, если сервер не остановился вовремя
+			return nil
 		}
-		wsClient, exists := connectionUsers[update.Message.Chat.ID]
-		if !exists {
-			wsClient = pg.CreateWsClient(os.Getenv("API_KEY2"), uint(update.Message.Chat.ID))
-			connectionUsers[update.Message.Chat.ID] = wsClient
+		b.health.beat()
+		updatesReceived.WithLabelValues(updateType(update)).Inc()
+		if b.stopping.Load() {
+			b.refuse(update)
+			continue
+		}
+		if b.blocked(update) {
+			continue
+		}
+		if update.CallbackQuery != nil {
+			handleCallback(b, update.CallbackQuery)
+			continue
 		}
-
-		log.Println("Client connetcted")
-
 		if update.Message == nil {
 			continue
 		}
-
 		chatID := update.Message.Chat.ID
 
-		loadSettings, exists := b.userSettings.Load(chatID)
-		if !exists {
-			b.userSettings.Store(chatID, defaultSettings)
-			loadSettings = defaultSettings
-		}
-		settings := loadSettings.(*UserSettings)
+		settings := b.getSettings(chatID)
 		if time.Since(settings.powerOffStartTimer) < 2*time.Minute {
-			msg := tgbotapi.NewMessage(chatID, "Please, wait. Your profile restored to default settings.")
+			msg := tgbotapi.NewMessage(chatID, tr(settings.language, "power_off.wait"))
 			b.tg.Send(msg)
 			continue
 		}
-		log.Println("User:", update.Message.Chat.UserName, "asked:", update.Message.Text)
+		if settings.language == "" && update.Message.From != nil {
+			// Первое сообщение: язык берём из настроек Telegram
+			settings.language = detectLanguage(update.Message.From.LanguageCode)
+			b.saveSettings(chatID, settings)
+		}
+		if settings.state == "done" || settings.state == "" {
+			// Кнопки главной клавиатуры подписаны на языке пользователя
+			if command, ok := menuCommand(update.Message.Text); ok {
+				update.Message.Text = command
+			}
+		}
+		slog.Debug("Message received", "chat_id", chatID, "user", update.Message.Chat.UserName, "text", update.Message.Text)
+		command, args := splitCommand(update.Message.Text)
+		countCommand(command)
 		switch {
+		case update.Message.Text == "/cancel":
+			handleCancel(b, chatID)
+		case len(update.Message.Photo) > 0:
+			handlePhoto(b, update.Message, chatID)
 		case update.Message.Text == "/power_off":
-			msg := tgbotapi.NewMessage(chatID, "Please wait 2 minutes. Your profile restored to default settings.")
-			defaultKeyboard := getDefaultMarkup()
+			msg := tgbotapi.NewMessage(chatID, tr(settings.language, "power_off.done"))
+			defaultKeyboard := getDefaultMarkup(settings.language)
 			msg.ReplyMarkup = tgbotapi.NewReplyKeyboard(defaultKeyboard...)
 			b.tg.Send(msg)
-			settings = defaultSettings
-			b.userSettings.Store(chatID, settings)
+			language := settings.language
+			settings = newDefaultSettings()
+			settings.language = language
 			settings.powerOffStartTimer = time.Now()
+			b.saveSettings(chatID, settings)
 		case settings.state == "done" || settings.state == "":
-			switch update.Message.Text {
+			switch command {
 			case "/start":
-				msg := tgbotapi.NewMessage(chatID,
-					"Hello! I'm a bot that can generate a picture for you. Just send me a message with a description of the picture you want to get. Description must be in English and be longer than 2 characters.")
-				defaultKeyboard := getDefaultMarkup()
+				msg := tgbotapi.NewMessage(chatID, tr(settings.language, "start"))
+				defaultKeyboard := getDefaultMarkup(settings.language)
 				msg.ReplyMarkup = tgbotapi.NewReplyKeyboard(defaultKeyboard...)
 				b.tg.Send(msg)
 			case "/help":
-				msg := tgbotapi.NewMessage(chatID,
-					"Available commands: \n"+
-						"/start - restart the bot \n"+
-						"/help - get help \n"+
-						"/models - list of all models for generate \n"+
-						"/steps - More steps - better, but longer generation\n"+
-						"/size - select size of the returned image\n"+
-						"/number_result - select the number of generated images\n"+
-						"/schedulers - select the prototype of generation\n"+
-						"/cancel - back to the start menu \n\n"+
-						"To generate a message, enter a description here.")
-				defaultKeyboard := getDefaultMarkup()
+				msg := tgbotapi.NewMessage(chatID, tr(settings.language, "help"))
+				defaultKeyboard := getDefaultMarkup(settings.language)
 				msg.ReplyMarkup = tgbotapi.NewReplyKeyboard(defaultKeyboard...)
 				b.tg.Send(msg)
 			case "/models":
@@ -204,122 +262,83 @@ func (b *Bot) Start() {
 				settings.state = "showVariableSchedulers"
 				b.userSettings.Store(chatID, settings)
 				handleSchedulers(b, update.Message.Text, chatID)
-			default:
-				// log.Println("User:", update.Message.Chat.UserName, "asked:", update.Message.Text)
-				if len(update.Message.Text) < 3 {
-					msg := tgbotapi.NewMessage(chatID, "Description must be longer than 2 characters.")
-					b.tg.Send(msg)
+			case "/negative":
+				if args != "" {
+					// Негативный промпт передан сразу в команде
+					settings.state = "chooseNegativePrompt"
+					b.userSettings.Store(chatID, settings)
+					handleNegativePrompt(b, args, chatID)
 					continue
 				}
-				msg := tgbotapi.NewMessage(chatID, "Generating a picture, please wait...")
-				botMsg, er := b.tg.Send(msg)
-				if er != nil {
-					log.Println(er)
+				settings.state = "showVariableNegativePrompt"
+				b.userSettings.Store(chatID, settings)
+				handleNegativePrompt(b, update.Message.Text, chatID)
+			case "/settings":
+				handleSettings(b, chatID)
+			case "/preset":
+				handlePreset(b, args, chatID)
+			case "/history":
+				handleHistory(b, chatID)
+			case "/language":
+				if args != "" {
+					settings.state = "chooseLanguage"
+					b.userSettings.Store(chatID, settings)
+					handleLanguage(b, args, chatID)
 					continue
 				}
-				settings.generatingMsgId = botMsg.MessageID
+				settings.state = "showVariableLanguage"
 				b.userSettings.Store(chatID, settings)
-				wg.Add(1)
-				go func() {
-					defer wg.Done()
-					defer func() {
-						settings.state = "done"
-						b.userSettings.Store(chatID, settings)
-						deleteMsg := tgbotapi.DeleteMessageConfig{
-							ChatID:    chatID,
-							MessageID: settings.generatingMsgId,
-						}
-						if _, err := b.tg.Request(deleteMsg); err != nil {
-							log.Printf("Failed to delete message: %v", err)
-						}
-
-						wsClient.DataInChannel.Store(false)
-					}()
-					settings.state = "generatingPicture"
+				handleLanguage(b, update.Message.Text, chatID)
+			case "/reload_catalog":
+				handleReloadCatalog(b, chatID)
+			case "/stats":
+				handleStats(b, chatID)
+			case "/broadcast":
+				handleBroadcast(b, args, chatID)
+			case "/ban":
+				handleBan(b, args, chatID, true)
+			case "/unban":
+				handleBan(b, args, chatID, false)
+			case "/balance":
+				handleBalance(b, chatID)
+			case "/tier":
+				handleTier(b, args, chatID)
+			case "/moderation":
+				handleModeration(b, args, chatID)
+			case "/describe":
+				handleDescribe(b, update.Message, chatID)
+			case "/enhance":
+				handleEnhance(b, args, chatID)
+			case "/remove_bg":
+				handleRemoveBackground(b, update.Message, chatID)
+			case "/strength":
+				settings.state = "showVariableStrength"
+				b.userSettings.Store(chatID, settings)
+				handleStrength(b, update.Message.Text, chatID)
+			case "/cfg":
+				settings.state = "showVariableCFG"
+				b.userSettings.Store(chatID, settings)
+				handleCFG(b, update.Message.Text, chatID)
+			case "/seed":
+				if args != "" {
+					settings.state = "chooseSeed"
 					b.userSettings.Store(chatID, settings)
-					msg := pg.ReqMessage{
-						PositivePrompt: string(update.Message.Text),
-						Model:          settings.model,
-						Steps:          settings.steps,
-						Width:          settings.width,
-						Height:         settings.heigth,
-						NumberResults:  settings.numberResults,
-						Scheduler:      settings.scheduler,
-						OutputType:     []string{"URL"},
-						TaskType:       "imageInference",
-						TaskUUID:       pg.GenerateUUID(),
-					}
-					response, err := wsClient.SendAndReceiveMsg(msg)
-					if err != nil {
-						log.Printf("Recieve message error: %s", err)
-						msg := tgbotapi.NewMessage(chatID, "Error occurred while generating a picture. Please try again or change your settings.")
-						b.tg.Send(msg)
-						return
-					} else {
-						log.Println("RESPONSE", response, len(response))
-
-						if response == nil || len(response) == 0 || len(response[0].Data) == 0 {
-							log.Println("nil response")
-							msg := tgbotapi.NewMessage(chatID, "Error occurred while generating a picture. Please try again or change your settings.")
-							b.tg.Send(msg)
-							return
-						}
-						var mediaGroup []interface{}
-
-						for _, responseData := range response {
-							if len(responseData.Err) > 0 {
-								log.Println("Error response", responseData.Err)
-								msg := tgbotapi.NewMessage(chatID, "Error occurred while generating a picture. Please try again or change your settings.")
-								b.tg.Send(msg)
-								return
-							}
-							imageURL := string(responseData.Data[0].ImageURL)
-
-							resp, err := http.Get(imageURL)
-							if err != nil {
-								log.Println(err)
-								msg := tgbotapi.NewMessage(chatID, "Failed to load image in tgChat")
-								b.tg.Send(msg)
-								return
-							}
-							defer resp.Body.Close()
-
-							imageBytes, err := io.ReadAll(resp.Body)
-							if err != nil {
-								log.Println(err)
-								msg := tgbotapi.NewMessage(chatID, "Error while processing image")
-								b.tg.Send(msg)
-								return
-							}
-
-							// Добавляем изображение в слайс как InputMediaPhoto
-							photo := tgbotapi.NewInputMediaPhoto(tgbotapi.FileBytes{
-								Name:  "image",
-								Bytes: imageBytes,
-							})
-
-							mediaGroup = append(mediaGroup, photo)
-						}
-
-						// Отправляем все фотографии разом
-						if len(mediaGroup) > 0 {
-							mediaMsg := tgbotapi.NewMediaGroup(chatID, mediaGroup)
-
-							_, err := b.tg.SendMediaGroup(mediaMsg)
-							if err != nil {
-								// Обрабатываем ошибку при отправке
-								msg := tgbotapi.NewMessage(chatID, "Не удалось отправить изображения")
-								b.tg.Send(msg)
-								return
-							}
-						}
-					}
-				}()
+					handleSeed(b, args, chatID)
+					continue
+				}
+				settings.state = "showVariableSeed"
+				b.userSettings.Store(chatID, settings)
+				handleSeed(b, update.Message.Text, chatID)
+			default:
+				positive, _ := splitPrompt(update.Message.Text, "")
+				if len(positive) < 3 {
+					msg := tgbotapi.NewMessage(chatID, tr(settings.language, "prompt.too_short"))
+					b.tg.Send(msg)
+					continue
+				}
+				b.submitPrompt(chatID, settings, update.Message.Text, "")
 
 			}
-		case settings.state == "generatingPicture":
-			msg := tgbotapi.NewMessage(chatID, "Please wait, the picture is being generated")
-			b.tg.Send(msg)
 		case settings.state == "chooseModels":
 			handleModels(b, update.Message.Text, chatID)
 		case settings.state == "chooseSteps":
@@ -330,8 +349,37 @@ func (b *Bot) Start() {
 			handleNumberResults(b, update.Message.Text, chatID)
 		case settings.state == "chooseSchedulers":
 			handleSchedulers(b, update.Message.Text, chatID)
+		case settings.state == "chooseNegativePrompt":
+			handleNegativePrompt(b, update.Message.Text, chatID)
+		case settings.state == "chooseStrength":
+			handleStrength(b, update.Message.Text, chatID)
+		case settings.state == "chooseRemoveBgPhoto" || settings.state == "chooseDescribePhoto":
+			msg := tgbotapi.NewMessage(chatID, tr(settings.language, "photo.expected"))
+			b.tg.Send(msg)
+		case settings.state == "choosePhotoPrompt":
+			handlePhotoPrompt(b, update.Message.Text, chatID)
+		case settings.state == "chooseCFG":
+			handleCFG(b, update.Message.Text, chatID)
+		case settings.state == "chooseSeed":
+			handleSeed(b, update.Message.Text, chatID)
+		case settings.state == "choosePreset":
+			handlePresetChoice(b, update.Message.Text, chatID)
+		case settings.state == "chooseLanguage":
+			handleLanguage(b, update.Message.Text, chatID)
 		}
 	}
-	wg.Wait()
-	return
+}
+
+// updates returns the channel of updates from the webhook or from long polling.
+func (b *Bot) updates() (tgbotapi.UpdatesChannel, error) {
+	if b.cfg.Webhook.enabled() {
+		return b.startWebhook()
+	}
+	// Пока установлен вебхук, getUpdates не работает
+	if _, err := b.tg.Request(tgbotapi.DeleteWebhookConfig{}); err != nil {
+		return nil, fmt.Errorf("delete webhook: %w", err)
+	}
+	u := tgbotapi.NewUpdate(0)
+	u.Timeout = 60
+	return b.tg.GetUpdatesChan(u), nil
 }
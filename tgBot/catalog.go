@@ -0,0 +1,353 @@
+package tgBot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Catalog lists the options users can choose from and the default settings.
+// It is read from a JSON file, so models and sizes can be changed without a rebuild.
+type Catalog struct {
+	Models        []ModelOption `json:"models"`
+	Sizes         []SizeOption  `json:"sizes"`
+	Steps         []int         `json:"steps"`
+	NumberResults []int         `json:"numberResults"`
+	Schedulers    []string      `json:"schedulers"`
+	CFGScales     []float64     `json:"cfgScales"`
+	Strengths     []float64     `json:"strengths"`
+	Defaults      Defaults      `json:"defaults"`
+}
+
+type ModelOption struct {
+	Name string `json:"name"`
+	// AIR is the model identifier of runware, e.g. "civitai:4201@501240".
+	AIR string `json:"air"`
+	// CFGScale is used when the user keeps the default guidance. Zero means Defaults.CFGScale.
+	CFGScale float64 `json:"cfgScale,omitempty"`
+}
+
+type SizeOption struct {
+	Name   string `json:"name"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+type Defaults struct {
+	Model         string  `json:"model"`
+	Steps         int     `json:"steps"`
+	Width         int     `json:"width"`
+	Height        int     `json:"height"`
+	NumberResults int     `json:"numberResults"`
+	Scheduler     string  `json:"scheduler"`
+	CFGScale      float64 `json:"cfgScale"`
+	Strength      float64 `json:"strength"`
+}
+
+// builtinCatalog is used when no catalog file is configured.
+var builtinCatalog = Catalog{
+	Models: []ModelOption{
+		{Name: "AbsoluteReality", AIR: "civitai:81458@132760"},
+		{Name: "CyberRealistic", AIR: "civitai:15003@114429"},
+		{Name: "Dream Shaper", AIR: "civitai:4384@128713"},
+		{Name: "FLUX", AIR: "civitai:618692@691639", CFGScale: 3.5},
+		{Name: "GhostMix (Anime)", AIR: "civitai:36520@53738"},
+		{Name: "JuggernautXL", AIR: "civitai:133005@782002", CFGScale: 6},
+		{Name: "ReV Animated", AIR: "civitai:7371@425083"},
+		{Name: "Realistic vision V6.0", AIR: "civitai:4201@501240"},
+		{Name: "SD XL", AIR: "civitai:101055@128078", CFGScale: 6},
+		{Name: "default", AIR: "runware:100@1@1", CFGScale: 1}, // FLUX schnell не использует guidance
+		{Name: "epicRealism", AIR: "civitai:25694@143906"},
+		{Name: "epicRealism V2", AIR: "civitai:25694@94744"},
+	},
+	Sizes: []SizeOption{
+		{Name: "1024x1024 (1:1)", Width: 1024, Height: 1024},
+		{Name: "1024x1792 (9:16)", Width: 1024, Height: 1792},
+		{Name: "1024x768 (4:3)", Width: 1024, Height: 768},
+		{Name: "1536x2048 (3:4)", Width: 1536, Height: 2048},
+		{Name: "1920x1280 (3:2)", Width: 1920, Height: 1280},
+		{Name: "2048x1152 (16:9)", Width: 2048, Height: 1152},
+		{Name: "2048x1536 (4:3)", Width: 2048, Height: 1536},
+		{Name: "2048x2048 (1:1)", Width: 2048, Height: 2048},
+		{Name: "768x1024 (3:4)", Width: 768, Height: 1024},
+		{Name: "768x512 (3:2)", Width: 768, Height: 512},
+		{Name: "768x768 (1:1)", Width: 768, Height: 768},
+		{Name: "default 512x512 (1:1)", Width: 512, Height: 512},
+	},
+	Steps:         []int{10, 15, 20, 30, 50, 75, 100},
+	NumberResults: []int{1, 2, 3, 4, 5, 10},
+	Schedulers:    []string{"DDIMScheduler", "DEISMultistepScheduler", "DPM++ SDE", "Default", "HeunDiscreteScheduler", "KarrasVeScheduler"},
+	CFGScales:     []float64{1, 2, 3.5, 5, 7, 9, 12, 15, 20},
+	Strengths:     []float64{0.3, 0.5, 0.6, 0.7, 0.8, 0.9, 1},
+	Defaults: Defaults{
+		Model:         "runware:100@1@1",
+		Steps:         10,
+		Width:         512,
+		Height:        512,
+		NumberResults: 1,
+		Scheduler:     "Default",
+		CFGScale:      7, // Подходит для моделей SD 1.5
+		Strength:      0.8,
+	},
+}
+
+// airPattern matches runware model identifiers: source:id@version, runware models have one more @number.
+var airPattern = regexp.MustCompile(`^[a-z][a-z0-9-]*:\d+@\d+(@\d+)?$`)
+
+// Ограничения runware на размер картинки
+const (
+	minImageSide   = 128
+	maxImageSide   = 2048
+	imageSideAlign = 64
+)
+
+var currentCatalog atomic.Pointer[Catalog]
+
+func init() {
+	currentCatalog.Store(&builtinCatalog)
+}
+
+// options returns the catalog in use. A catalog is never changed after loading, reload replaces it as a whole.
+func options() *Catalog {
+	return currentCatalog.Load()
+}
+
+// LoadCatalog reads and validates a catalog file.
+func LoadCatalog(path string) (*Catalog, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c Catalog
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if err := c.validate(); err != nil {
+		return nil, fmt.Errorf("invalid catalog %s: %w", path, err)
+	}
+	return &c, nil
+}
+
+// validate returns all problems of the catalog at once, so the file can be fixed in one go.
+func (c *Catalog) validate() error {
+	var errs []error
+	add := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if len(c.Models) == 0 {
+		add("no models")
+	}
+	names := map[string]bool{}
+	airs := map[string]string{}
+	for _, m := range c.Models {
+		if strings.TrimSpace(m.Name) == "" {
+			add("model %q: empty name", m.AIR)
+		} else if names[m.Name] {
+			add("model %q: duplicate name", m.Name)
+		}
+		names[m.Name] = true
+		if !airPattern.MatchString(m.AIR) {
+			add("model %q: invalid AIR identifier %q", m.Name, m.AIR)
+		} else if other, ok := airs[m.AIR]; ok {
+			add("model %q: AIR %s is already used by %q", m.Name, m.AIR, other)
+		}
+		airs[m.AIR] = m.Name
+		if m.CFGScale < 0 {
+			add("model %q: negative cfgScale", m.Name)
+		}
+	}
+
+	if len(c.Sizes) == 0 {
+		add("no sizes")
+	}
+	names = map[string]bool{}
+	for _, s := range c.Sizes {
+		if strings.TrimSpace(s.Name) == "" {
+			add("size %dx%d: empty name", s.Width, s.Height)
+		} else if names[s.Name] {
+			add("size %q: duplicate name", s.Name)
+		}
+		names[s.Name] = true
+		if !validSide(s.Width) || !validSide(s.Height) {
+			add("size %q: width and height must be multiples of %d from %d to %d", s.Name, imageSideAlign, minImageSide, maxImageSide)
+		}
+	}
+
+	checkInts := func(what string, values []int, max int) {
+		if len(values) == 0 {
+			add("no %s", what)
+		}
+		seen := map[int]bool{}
+		for _, v := range values {
+			if v <= 0 || v > max {
+				add("%s: %d is out of range 1-%d", what, v, max)
+			} else if seen[v] {
+				add("%s: duplicate %d", what, v)
+			}
+			seen[v] = true
+		}
+	}
+	checkInts("steps", c.Steps, 100)
+	checkInts("numberResults", c.NumberResults, 20)
+
+	checkFloats := func(what string, values []float64, min, max float64) {
+		if len(values) == 0 {
+			add("no %s", what)
+		}
+		seen := map[float64]bool{}
+		for _, v := range values {
+			if v < min || v > max {
+				add("%s: %s is out of range %s-%s", what, formatFloat(v), formatFloat(min), formatFloat(max))
+			} else if seen[v] {
+				add("%s: duplicate %s", what, formatFloat(v))
+			}
+			seen[v] = true
+		}
+	}
+	checkFloats("cfgScales", c.CFGScales, 1, 30)
+	checkFloats("strengths", c.Strengths, 0, 1)
+
+	if len(c.Schedulers) == 0 {
+		add("no schedulers")
+	}
+	names = map[string]bool{}
+	for _, s := range c.Schedulers {
+		if strings.TrimSpace(s) == "" {
+			add("schedulers: empty name")
+		} else if names[s] {
+			add("schedulers: duplicate %q", s)
+		}
+		names[s] = true
+	}
+
+	// Значения по умолчанию должны быть среди вариантов, иначе кнопки "default" не будет
+	d := c.Defaults
+	if _, ok := c.modelName(d.Model); !ok {
+		add("defaults: model %q is not in models", d.Model)
+	}
+	if _, ok := c.sizeName(d.Width, d.Height); !ok {
+		add("defaults: size %dx%d is not in sizes", d.Width, d.Height)
+	}
+	if !contains(c.Steps, d.Steps) {
+		add("defaults: steps %d is not in steps", d.Steps)
+	}
+	if !contains(c.NumberResults, d.NumberResults) {
+		add("defaults: numberResults %d is not in numberResults", d.NumberResults)
+	}
+	if !contains(c.Schedulers, d.Scheduler) {
+		add("defaults: scheduler %q is not in schedulers", d.Scheduler)
+	}
+	if !contains(c.Strengths, d.Strength) {
+		add("defaults: strength %s is not in strengths", formatFloat(d.Strength))
+	}
+	if d.CFGScale < 1 || d.CFGScale > 30 {
+		add("defaults: cfgScale %s is out of range 1-30", formatFloat(d.CFGScale))
+	}
+	return errors.Join(errs...)
+}
+
+func validSide(side int) bool {
+	return side >= minImageSide && side <= maxImageSide && side%imageSideAlign == 0
+}
+
+func contains[T comparable](values []T, value T) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Catalog) modelAIR(name string) (string, bool) {
+	for _, m := range c.Models {
+		if m.Name == name {
+			return m.AIR, true
+		}
+	}
+	return "", false
+}
+
+func (c *Catalog) modelName(air string) (string, bool) {
+	for _, m := range c.Models {
+		if m.AIR == air {
+			return m.Name, true
+		}
+	}
+	return "", false
+}
+
+func (c *Catalog) size(name string) (SizeOption, bool) {
+	for _, s := range c.Sizes {
+		if s.Name == name {
+			return s, true
+		}
+	}
+	return SizeOption{}, false
+}
+
+func (c *Catalog) sizeName(width, height int) (string, bool) {
+	for _, s := range c.Sizes {
+		if s.Width == width && s.Height == height {
+			return s.Name, true
+		}
+	}
+	return "", false
+}
+
+// version identifies the content of the catalog. Buttons with an index into the catalog carry it,
+// so a button rendered before a reload is not applied to the new catalog.
+func (c *Catalog) version() string {
+	data, _ := json.Marshal(c)
+	h := fnv.New32a()
+	h.Write(data)
+	return strconv.FormatUint(uint64(h.Sum32()), 36)
+}
+
+// cfgForModel returns the guidance scale used when the user keeps the default one.
+func (c *Catalog) cfgForModel(air string) float64 {
+	for _, m := range c.Models {
+		if m.AIR == air && m.CFGScale > 0 {
+			return m.CFGScale
+		}
+	}
+	return c.Defaults.CFGScale
+}
+
+// ReloadCatalog reads the catalog file again. On error the current catalog is kept.
+// Settings of users are not touched: a removed model stays selected until the user changes it.
+func (b *Bot) ReloadCatalog() error {
+	if b.cfg.CatalogPath == "" {
+		return errors.New("catalog file is not configured")
+	}
+	c, err := LoadCatalog(b.cfg.CatalogPath)
+	if err != nil {
+		return err
+	}
+	currentCatalog.Store(c)
+	slog.Info("Catalog reloaded", "path", b.cfg.CatalogPath, "models", len(c.Models), "sizes", len(c.Sizes))
+	return nil
+}
+
+func handleReloadCatalog(b *Bot, chatID int64) {
+	if !b.cfg.isAdmin(chatID) {
+		b.tg.Send(tgbotapi.NewMessage(chatID, b.text(chatID, "admin.only")))
+		return
+	}
+	text := b.text(chatID, "catalog.reloaded")
+	if err := b.ReloadCatalog(); err != nil {
+		slog.Error("Failed to reload catalog", "err", err)
+		text = b.text(chatID, "catalog.failed", err)
+	}
+	b.tg.Send(tgbotapi.NewMessage(chatID, text))
+}
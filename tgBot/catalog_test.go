@@ -0,0 +1,145 @@
+package tgBot
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeCatalog saves the built-in catalog changed by edit and returns the path of the file.
+func writeCatalog(t *testing.T, edit func(c *Catalog)) string {
+	data, _ := json.Marshal(builtinCatalog)
+	var c Catalog
+	json.Unmarshal(data, &c)
+	edit(&c)
+	data, _ = json.Marshal(c)
+	path := filepath.Join(t.TempDir(), "catalog.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestBuiltinCatalogIsValid(t *testing.T) {
+	if err := builtinCatalog.validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadCatalog(t *testing.T) {
+	tests := []struct {
+		name string
+		edit func(c *Catalog)
+		// want are parts of the error, empty means the catalog is valid.
+		want []string
+	}{
+		{"valid", func(c *Catalog) {}, nil},
+		{"duplicate model name", func(c *Catalog) {
+			c.Models = append(c.Models, ModelOption{Name: "FLUX", AIR: "civitai:1@1"})
+		}, []string{`model "FLUX": duplicate name`}},
+		{"duplicate model AIR", func(c *Catalog) {
+			c.Models = append(c.Models, ModelOption{Name: "Copy", AIR: "runware:100@1@1"})
+		}, []string{`model "Copy": AIR runware:100@1@1 is already used by "default"`}},
+		{"invalid AIR", func(c *Catalog) {
+			c.Models[0].AIR = "absolute reality"
+		}, []string{`invalid AIR identifier "absolute reality"`}},
+		{"duplicate size", func(c *Catalog) {
+			c.Sizes = append(c.Sizes, c.Sizes[0])
+		}, []string{`size "1024x1024 (1:1)": duplicate name`}},
+		{"duplicate steps and schedulers", func(c *Catalog) {
+			c.Steps = append(c.Steps, 10)
+			c.Schedulers = append(c.Schedulers, "Default")
+		}, []string{"steps: duplicate 10", `schedulers: duplicate "Default"`}},
+		{"size out of range", func(c *Catalog) {
+			c.Sizes[0].Width = 1000
+		}, []string{"width and height must be multiples of 64"}},
+		{"default model missing", func(c *Catalog) {
+			c.Defaults.Model = "civitai:1@1"
+		}, []string{`defaults: model "civitai:1@1" is not in models`}},
+		{"default size missing", func(c *Catalog) {
+			c.Defaults.Width = 640
+		}, []string{"defaults: size 640x512 is not in sizes"}},
+		{"default steps missing", func(c *Catalog) {
+			c.Defaults.Steps = 12
+		}, []string{"defaults: steps 12 is not in steps"}},
+		{"default number of results missing", func(c *Catalog) {
+			c.Defaults.NumberResults = 7
+		}, []string{"defaults: numberResults 7 is not in numberResults"}},
+		{"default scheduler missing", func(c *Catalog) {
+			c.Schedulers = c.Schedulers[:3]
+		}, []string{`defaults: scheduler "Default" is not in schedulers`}},
+		{"all problems at once", func(c *Catalog) {
+			c.Models = nil
+			c.Strengths = nil
+		}, []string{"no models", "no strengths", "defaults: model", "defaults: strength"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := LoadCatalog(writeCatalog(t, tt.edit))
+			if tt.want == nil {
+				if err != nil || c == nil {
+					t.Fatalf("valid catalog is rejected: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("invalid catalog is loaded")
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error %q doesn't mention %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadCatalogBadFile(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"truncated", `{"models": [`},
+		{"wrong type", `{"steps": "ten"}`},
+		{"not an object", `[]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name+".json")
+			os.WriteFile(path, []byte(tt.content), 0o600)
+			if c, err := LoadCatalog(path); err == nil {
+				t.Fatalf("bad file is loaded: %+v", c)
+			}
+		})
+	}
+	if _, err := LoadCatalog(filepath.Join(dir, "missing.json")); !os.IsNotExist(err) {
+		t.Errorf("missing file: %v", err)
+	}
+}
+
+func TestCFGForModel(t *testing.T) {
+	c := Catalog{
+		Models: []ModelOption{
+			{Name: "Own", AIR: "runware:1@1", CFGScale: 4},
+			{Name: "Shared", AIR: "runware:2@1"},
+		},
+		Defaults: Defaults{CFGScale: 7},
+	}
+	tests := []struct {
+		air  string
+		want float64
+	}{
+		{"runware:1@1", 4},
+		{"runware:2@1", 7},
+		{"removed:3@1", 7},
+		{"", 7},
+	}
+	for _, tt := range tests {
+		if got := c.cfgForModel(tt.air); got != tt.want {
+			t.Errorf("cfgForModel(%q) = %v, want %v", tt.air, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package tgBot
+
+import (
+	"log/slog"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// botCommand is an entry of the command menu of Telegram. Its description is the text "command.<name>".
+type botCommand struct {
+	name  string
+	admin bool
+}
+
+// botCommands are listed in the menu in this order, admin commands only in the chats of admins.
+var botCommands = []botCommand{
+	{name: "start"},
+	{name: "help"},
+	{name: "settings"},
+	{name: "models"},
+	{name: "steps"},
+	{name: "size"},
+	{name: "number_results"},
+	{name: "schedulers"},
+	{name: "negative"},
+	{name: "seed"},
+	{name: "cfg"},
+	{name: "strength"},
+	{name: "remove_bg"},
+	{name: "enhance"},
+	{name: "describe"},
+	{name: "history"},
+	{name: "preset"},
+	{name: "language"},
+	{name: "balance"},
+	{name: "cancel"},
+	{name: "power_off"},
+	{name: "stats", admin: true},
+	{name: "broadcast", admin: true},
+	{name: "ban", admin: true},
+	{name: "unban", admin: true},
+	{name: "tier", admin: true},
+	{name: "moderation", admin: true},
+	{name: "reload_catalog", admin: true},
+}
+
+func commandList(lang string, admin bool) []tgbotapi.BotCommand {
+	var commands []tgbotapi.BotCommand
+	for _, c := range botCommands {
+		if c.admin && !admin {
+			continue
+		}
+		commands = append(commands, tgbotapi.BotCommand{Command: c.name, Description: tr(lang, "command."+c.name)})
+	}
+	return commands
+}
+
+// registerCommands sets the command menu for every language. Admins get their commands in
+// their own chats. The menu is only a hint, so errors are logged and the bot keeps working.
+func (b *Bot) registerCommands() {
+	set := func(scope tgbotapi.BotCommandScope, lang, code string, admin bool) {
+		config := tgbotapi.NewSetMyCommandsWithScopeAndLanguage(scope, code, commandList(lang, admin)...)
+		if _, err := b.tg.Request(config); err != nil {
+			slog.Warn("Failed to register commands", "language", code, "err", err)
+		}
+	}
+	// Пустой код языка - меню для языков без своего перевода
+	set(tgbotapi.NewBotCommandScopeDefault(), defaultLanguage, "", false)
+	for _, id := range b.cfg.Admins {
+		set(tgbotapi.NewBotCommandScopeChat(id), defaultLanguage, "", true)
+	}
+	for _, l := range languages {
+		set(tgbotapi.NewBotCommandScopeDefault(), l.code, l.code, false)
+		for _, id := range b.cfg.Admins {
+			set(tgbotapi.NewBotCommandScopeChat(id), l.code, l.code, true)
+		}
+	}
+}
+
+// menuLabel is the label of a command button of the main keyboard.
+func menuLabel(lang, command string) string {
+	return tr(lang, "menu."+strings.TrimPrefix(command, "/"))
+}
+
+// menuCommand returns the command of a main keyboard label. Labels of all languages are
+// accepted, so a keyboard sent before /language keeps working.
+func menuCommand(text string) (string, bool) {
+	for _, command := range serviceCommands {
+		for _, l := range languages {
+			if text == menuLabel(l.code, command) {
+				return command, true
+			}
+		}
+	}
+	return "", false
+}
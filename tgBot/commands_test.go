@@ -0,0 +1,219 @@
+package tgBot
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// recordingTelegram answers like fakeTelegram and keeps the forms of setMyCommands requests,
+// the texts and keyboards of sent messages and sent documents. getFile answers with the
+// file id as the path, serveTelegramFiles serves the downloads. sendDocument answers with a message.
+type recordingTelegram struct {
+	fakeTelegram
+	mu        sync.Mutex
+	commands  []map[string]string
+	texts     []string
+	markups   []string
+	documents map[string][]byte
+}
+
+func (r *recordingTelegram) Do(req *http.Request) (*http.Response, error) {
+	switch path.Base(req.URL.Path) {
+	case "setMyCommands":
+		req.ParseForm()
+		form := map[string]string{}
+		for key := range req.PostForm {
+			form[key] = req.PostForm.Get(key)
+		}
+		r.mu.Lock()
+		r.commands = append(r.commands, form)
+		r.mu.Unlock()
+	case "sendMessage":
+		req.ParseForm()
+		r.mu.Lock()
+		r.texts = append(r.texts, req.PostForm.Get("text"))
+		r.markups = append(r.markups, req.PostForm.Get("reply_markup"))
+		r.mu.Unlock()
+	case "getFile":
+		req.ParseForm()
+		id := req.PostForm.Get("file_id")
+		body := fmt.Sprintf(`{"ok":true,"result":{"file_id":%q,"file_unique_id":%[1]q,"file_path":%[1]q}}`, id)
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(body)), Header: http.Header{}}, nil
+	case "sendDocument":
+		if err := req.ParseMultipartForm(32 << 20); err == nil {
+			for _, headers := range req.MultipartForm.File {
+				file, _ := headers[0].Open()
+				data, _ := io.ReadAll(file)
+				file.Close()
+				r.mu.Lock()
+				if r.documents == nil {
+					r.documents = map[string][]byte{}
+				}
+				r.documents[headers[0].Filename] = data
+				r.mu.Unlock()
+			}
+		}
+		body := fmt.Sprintf(`{"ok":true,"result":{"message_id":1,"date":0,"chat":{"id":%s,"type":"private"}}}`, req.FormValue("chat_id"))
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(body)), Header: http.Header{}}, nil
+	}
+	return r.fakeTelegram.Do(req)
+}
+
+func (r *recordingTelegram) sentTexts() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.texts)
+}
+
+// sentMarkup returns the keyboard of the message with the text, empty if it has none.
+func (r *recordingTelegram) sentMarkup(text string) (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	i := slices.Index(r.texts, text)
+	if i < 0 {
+		return "", false
+	}
+	return r.markups[i], true
+}
+
+func (r *recordingTelegram) sentDocuments() map[string][]byte {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return maps.Clone(r.documents)
+}
+
+// fileTransport serves Telegram file downloads by the last part of the path.
+type fileTransport map[string][]byte
+
+func (f fileTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	data, ok := f[path.Base(req.URL.Path)]
+	if !ok {
+		return &http.Response{StatusCode: http.StatusNotFound, Status: "404 Not Found", Body: http.NoBody, Header: http.Header{}}, nil
+	}
+	return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewReader(data)), Header: http.Header{}}, nil
+}
+
+// serveTelegramFiles makes downloads of Telegram files return files by file id for the test.
+func serveTelegramFiles(t *testing.T, files map[string][]byte) {
+	previous := http.DefaultClient.Transport
+	http.DefaultClient.Transport = fileTransport(files)
+	t.Cleanup(func() { http.DefaultClient.Transport = previous })
+}
+
+func TestCommandTexts(t *testing.T) {
+	for _, l := range languages {
+		for _, c := range botCommands {
+			key := "command." + c.name
+			text, ok := messages[l.code][key]
+			if !ok || len(text) < 3 || len(text) > 256 {
+				t.Errorf("%s: description %q of /%s", l.code, text, c.name)
+			}
+		}
+		seen := map[string]string{}
+		for _, command := range serviceCommands {
+			label, ok := messages[l.code]["menu."+command[1:]]
+			if !ok {
+				t.Errorf("%s: no label of %s", l.code, command)
+			}
+			if other, ok := seen[label]; ok {
+				t.Errorf("%s: %s and %s have the same label %q", l.code, command, other, label)
+			}
+			seen[label] = command
+		}
+	}
+}
+
+func TestMenuCommand(t *testing.T) {
+	for _, l := range languages {
+		for _, row := range getDefaultMarkup(l.code) {
+			for _, button := range row {
+				command, ok := menuCommand(button.Text)
+				if !ok || menuLabel(l.code, command) != button.Text {
+					t.Errorf("%s: button %q is not a command", l.code, button.Text)
+				}
+			}
+		}
+	}
+	for _, text := range []string{"/models", "a cat on a sofa", ""} {
+		if command, ok := menuCommand(text); ok {
+			t.Errorf("%q is taken for %s", text, command)
+		}
+	}
+}
+
+func TestRegisterCommands(t *testing.T) {
+	client := &recordingTelegram{}
+	api, err := tgbotapi.NewBotAPIWithClient("1:token", tgbotapi.APIEndpoint, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &Bot{tg: api, cfg: Config{Admins: []int64{42}}}
+	b.registerCommands()
+
+	// Меню по умолчанию и по языку, для всех и для админа
+	if want := 2 * (len(languages) + 1); len(client.commands) != want {
+		t.Fatalf("%d requests, want %d", len(client.commands), want)
+	}
+	for _, form := range client.commands {
+		var commands []tgbotapi.BotCommand
+		json.Unmarshal([]byte(form["commands"]), &commands)
+		var scope tgbotapi.BotCommandScope
+		json.Unmarshal([]byte(form["scope"]), &scope)
+		admin := scope.Type == "chat"
+		if admin && scope.ChatID != 42 {
+			t.Errorf("admin commands for chat %d", scope.ChatID)
+		}
+		lang := form["language_code"]
+		if lang == "" {
+			lang = defaultLanguage
+		}
+		for _, c := range commands {
+			if c.Description != tr(lang, "command."+c.Command) {
+				t.Errorf("%s: /%s is described as %q", lang, c.Command, c.Description)
+			}
+		}
+		if want := len(commandList(lang, admin)); len(commands) != want {
+			t.Errorf("%s, admin %v: %d commands, want %d", lang, admin, len(commands), want)
+		}
+		for _, c := range commands {
+			if c.Command == "stats" && !admin {
+				t.Errorf("%s: admin command in the menu of everyone", lang)
+			}
+		}
+	}
+}
+
+func TestChoiceMarkupDefaultLabel(t *testing.T) {
+	markups := map[string]func(lang string) [][]tgbotapi.KeyboardButton{
+		"models":     getModelsMarkup,
+		"size":       getSizeMarkup,
+		"schedulers": getSchedulersMarkup,
+		"steps":      getStepsMarkup,
+	}
+	for name, markup := range markups {
+		for _, l := range languages {
+			defaults := 0
+			for _, row := range markup(l.code) {
+				for _, button := range row {
+					if button.Text == tr(l.code, "button.default") {
+						defaults++
+					}
+				}
+			}
+			if defaults != 1 {
+				t.Errorf("%s in %s: %d default buttons", name, l.code, defaults)
+			}
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package tgBot
+
+import "time"
+
+// Config holds the bot parameters that can be changed without rebuilding.
+type Config struct {
+	Token string
+	// Workers is the number of generations running at the same time.
+	Workers int
+	// QueueSize is the maximum number of jobs waiting for a free worker.
+	QueueSize int
+	// MaxJobsPerUser limits queued and running jobs of a single chat.
+	MaxJobsPerUser int
+	// CatalogPath is a JSON file with models, sizes and other options. Empty means the built-in catalog.
+	CatalogPath string
+	// Admins are chats allowed to use administrative commands.
+	Admins []int64
+	// ShutdownTimeout is how long running generations may take to finish when the bot stops.
+	ShutdownTimeout time.Duration
+	// Webhook receives updates over HTTP instead of long polling when Webhook.URL is set.
+	Webhook WebhookConfig
+	// Quota limits generations of the chats per day.
+	Quota QuotaConfig
+	// Moderation checks prompts against blocklists before generation.
+	Moderation ModerationConfig
+	// ProbeInterval is how often the generator is pinged for the readiness check.
+	ProbeInterval time.Duration
+}
+
+var defaultConfig = Config{
+	Workers:         4,
+	QueueSize:       100,
+	MaxJobsPerUser:  3,
+	ShutdownTimeout: time.Minute,
+	ProbeInterval:   30 * time.Second,
+}
+
+func (c *Config) setDefaults() {
+	if c.Workers <= 0 {
+		c.Workers = defaultConfig.Workers
+	}
+	if c.QueueSize <= 0 {
+		c.QueueSize = defaultConfig.QueueSize
+	}
+	if c.MaxJobsPerUser <= 0 {
+		c.MaxJobsPerUser = defaultConfig.MaxJobsPerUser
+	}
+	if c.ShutdownTimeout <= 0 {
+		c.ShutdownTimeout = defaultConfig.ShutdownTimeout
+	}
+	if c.ProbeInterval <= 0 {
+		c.ProbeInterval = defaultConfig.ProbeInterval
+	}
+}
+
+func (c *Config) isAdmin(chatID int64) bool {
+	for _, id := range c.Admins {
+		if id == chatID {
+			return true
+		}
+	}
+	return false
+}
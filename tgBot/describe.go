@@ -0,0 +1,74 @@
+package tgBot
+
+import (
+	"time"
+
+	"github.com/MTUCI-Pixel-Team/Picture_Generator/generator"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func (b *Bot) submitDescribe(chatID int64, img storedImage) {
+	j := b.queue.newJob(b.ctx, jobDescribe, chatID)
+	j.image = img
+	j.statusText = b.text(chatID, "describe.status")
+	b.enqueue(j)
+}
+
+// runDescribe captions the picture and offers to generate a new one from the caption.
+func (b *Bot) runDescribe(j *job) error {
+	input, err := b.inputImage(j)
+	var caption string
+	if err == nil {
+		caption, err = b.generator.Caption(j.ctx, generator.CaptionRequest{UserID: j.chatID, Image: input})
+	}
+	if j.ctx.Err() != nil {
+		j.log.Info("Job cancelled")
+		return j.ctx.Err()
+	}
+	if err != nil {
+		j.log.Error("Describe failed", "err", err, "class", errorClass(err))
+		b.tg.Send(tgbotapi.NewMessage(j.chatID, tr(j.lang, "describe.error")))
+		return err
+	}
+
+	msg := tgbotapi.NewMessage(j.chatID, tr(j.lang, "describe.result", caption))
+	pending := pendingPrompt{ChatID: j.chatID, Original: caption, CreatedAt: time.Now()}
+	// Без сохранённого описания кнопке нечего запускать, отправляем только текст
+	if key, err := b.savePrompt(pending); err != nil {
+		j.log.Error("Failed to save description", "err", err)
+	} else {
+		msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(tr(j.lang, "button.describe"), "ds::"+key),
+		))
+	}
+	if _, err := b.tg.Send(msg); err != nil {
+		j.log.Error("Failed to send description", "err", err)
+	}
+	j.log.Info("Described", "duration", time.Since(j.createdAt))
+	return nil
+}
+
+// handleGenerateFromDescription sends the caption to the normal generation with the current settings.
+func handleGenerateFromDescription(b *Bot, chatID int64, key string) string {
+	pending, ok := b.loadPrompt(chatID, key)
+	if !ok {
+		return b.text(chatID, "prompt.expired")
+	}
+	// Описание не удаляем: по нему можно сгенерировать ещё раз
+	b.submitPrompt(chatID, b.getSettings(chatID), pending.Original, "")
+	return b.text(chatID, "describe.generating")
+}
+
+// handleDescribe describes the replied picture or asks for a photo.
+func handleDescribe(b *Bot, message *tgbotapi.Message, chatID int64) {
+	if reply := message.ReplyToMessage; reply != nil && len(reply.Photo) > 0 {
+		b.submitDescribe(chatID, b.findImage(chatID, largestPhoto(reply.Photo)))
+		return
+	}
+	settings := b.getSettings(chatID)
+	settings.state = "chooseDescribePhoto"
+	b.userSettings.Store(chatID, settings)
+	msg := tgbotapi.NewMessage(chatID, tr(settings.language, "describe.ask"))
+	b.tg.Send(msg)
+}
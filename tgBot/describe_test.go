@@ -0,0 +1,126 @@
+package tgBot
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/MTUCI-Pixel-Team/Picture_Generator/generator"
+	"github.com/MTUCI-Pixel-Team/Picture_Generator/storage"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// newJobBot returns a bot with the fake generator and a Telegram that records what is sent.
+func newJobBot(t *testing.T, store storage.Store) (*Bot, *recordingTelegram) {
+	client := &recordingTelegram{}
+	api, err := tgbotapi.NewBotAPIWithClient("1:token", tgbotapi.APIEndpoint, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &Bot{
+		tg:        api,
+		store:     store,
+		generator: generator.NewFake(0),
+		queue:     newJobQueue(10, 10),
+		ctx:       context.Background(),
+		health:    &healthState{},
+	}
+	return b, client
+}
+
+// testPNG is a picture with a white background and a red square in the middle.
+func testPNG(t *testing.T, width, height int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := color.RGBA{255, 255, 255, 255}
+			if x >= width/4 && x < width*3/4 && y >= height/4 && y < height*3/4 {
+				c = color.RGBA{255, 0, 0, 255}
+			}
+			img.SetRGBA(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// failingStore refuses to save into one bucket.
+type failingStore struct {
+	storage.Store
+	bucket string
+}
+
+func (s failingStore) Put(bucket, key string, v any) error {
+	if bucket == s.bucket {
+		return errors.New("disk is full")
+	}
+	return s.Store.Put(bucket, key, v)
+}
+
+func describeJob(b *Bot, chatID int64) *job {
+	j := b.queue.newJob(b.ctx, jobDescribe, chatID)
+	j.image = storedImage{ChatID: chatID, FileID: "photo"}
+	j.lang = "en"
+	return j
+}
+
+func TestDescribeOffersGeneration(t *testing.T) {
+	serveTelegramFiles(t, map[string][]byte{"photo": testPNG(t, 64, 32)})
+	b, client := newJobBot(t, storage.NewMemoryStore())
+	b.runJob(describeJob(b, 1))
+
+	var caption, markup string
+	for _, text := range client.sentTexts() {
+		if strings.HasPrefix(text, tr("en", "describe.result", "")) {
+			caption = text
+			markup, _ = client.sentMarkup(text)
+		}
+	}
+	if caption == "" {
+		t.Fatalf("no description in %q", client.sentTexts())
+	}
+	_, id, found := strings.Cut(markup, `"callback_data":"ds::`)
+	if !found {
+		t.Fatalf("no button under the description: %s", markup)
+	}
+	id, _, _ = strings.Cut(id, `"`)
+	if found, _ := b.store.Get(promptsBucket, chatKey(1, id), &pendingPrompt{}); !found {
+		t.Errorf("description %s is not saved under the key of the chat", id)
+	}
+
+	if answer := handleGenerateFromDescription(b, 2, id); answer != tr("", "prompt.expired") {
+		t.Errorf("another chat used the description: %q", answer)
+	}
+	if answer := handleGenerateFromDescription(b, 1, id); answer != tr("", "describe.generating") {
+		t.Errorf("answer %q", answer)
+	}
+	if pending, _ := b.queue.depth(); pending != 1 {
+		t.Errorf("%d jobs queued, want the generation", pending)
+	}
+}
+
+func TestDescribeWithoutSavedPrompt(t *testing.T) {
+	serveTelegramFiles(t, map[string][]byte{"photo": testPNG(t, 64, 32)})
+	b, client := newJobBot(t, failingStore{storage.NewMemoryStore(), promptsBucket})
+	b.runJob(describeJob(b, 1))
+
+	texts := client.sentTexts()
+	if len(texts) == 0 {
+		t.Fatal("description is not sent")
+	}
+	last := texts[len(texts)-1]
+	if !strings.HasPrefix(last, tr("en", "describe.result", "")) {
+		t.Fatalf("last message %q is not the description", last)
+	}
+	if markup, _ := client.sentMarkup(last); markup != "" {
+		t.Errorf("button without a saved description: %s", markup)
+	}
+}
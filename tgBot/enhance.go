@@ -0,0 +1,119 @@
+package tgBot
+
+import (
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/MTUCI-Pixel-Team/Picture_Generator/generator"
+	"github.com/google/uuid"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	promptsBucket = "prompts"
+	// promptRetention is how long the user can choose between the enhanced and the original prompt.
+	promptRetention = 24 * time.Hour
+)
+
+// pendingPrompt waits for the user to choose between the enhanced and the original description.
+type pendingPrompt struct {
+	ChatID    int64     `json:"chatId"`
+	Original  string    `json:"original"`
+	Enhanced  string    `json:"enhanced,omitempty"`
+	Photo     string    `json:"photo,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// savePrompt stores the prompt under a new id for the buttons of the message about it.
+func (b *Bot) savePrompt(pending pendingPrompt) (string, error) {
+	id := uuid.NewString()
+	return id, b.store.Put(promptsBucket, chatKey(pending.ChatID, id), pending)
+}
+
+// loadPrompt returns the prompt saved by the chat if it has not expired.
+func (b *Bot) loadPrompt(chatID int64, id string) (pendingPrompt, bool) {
+	var pending pendingPrompt
+	found, err := b.store.Get(promptsBucket, chatKey(chatID, id), &pending)
+	if err != nil {
+		slog.Error("Failed to load prompt", "chat_id", chatID, "id", id, "err", err)
+		return pending, false
+	}
+	return pending, found && time.Since(pending.CreatedAt) < promptRetention
+}
+
+// submitPrompt starts a generation, first enhancing the prompt if the user turned it on.
+func (b *Bot) submitPrompt(chatID int64, settings *UserSettings, text, photo string) {
+	if !settings.enhance {
+		b.submitJob(chatID, settings, text, photo)
+		return
+	}
+	// Улучшенный промпт проверится ещё раз в submitJob
+	if !b.allowNegative(chatID, settings, text) || !b.allowPrompt(chatID, settings, text) {
+		return
+	}
+	j := b.queue.newJob(b.ctx, jobEnhance, chatID)
+	j.prompt = text
+	j.photo = photo
+	j.statusText = tr(settings.language, "enhance.status")
+	b.enqueue(j)
+}
+
+// runEnhance expands the positive part of the prompt and lets the user choose which one to use.
+func (b *Bot) runEnhance(j *job) error {
+	positive, _ := splitPrompt(j.prompt, "")
+	enhanced, err := b.generator.EnhancePrompt(j.ctx, generator.EnhanceRequest{UserID: j.chatID, Prompt: positive})
+	if j.ctx.Err() != nil {
+		j.log.Info("Job cancelled")
+		return j.ctx.Err()
+	}
+
+	lang := j.lang
+	pending := pendingPrompt{ChatID: j.chatID, Original: j.prompt, Photo: j.photo, CreatedAt: time.Now()}
+	var text string
+	if err != nil {
+		j.log.Error("Enhance failed", "err", err, "class", errorClass(err))
+		text = tr(lang, "enhance.failed")
+	} else {
+		pending.Enhanced = enhanced
+		text = tr(lang, "enhance.result", enhanced, positive)
+	}
+	// err остаётся ошибкой улучшения: по ней runJob вернёт списанный кредит
+	key, saveErr := b.savePrompt(pending)
+	if saveErr != nil {
+		j.log.Error("Failed to save prompt", "err", saveErr)
+		b.tg.Send(tgbotapi.NewMessage(j.chatID, tr(lang, "generation.error")))
+		return saveErr
+	}
+	msg := tgbotapi.NewMessage(j.chatID, text)
+	msg.ReplyMarkup = getEnhanceMarkup(lang, key, pending.Enhanced != "")
+	if _, err := b.tg.Send(msg); err != nil {
+		j.log.Error("Failed to send enhanced prompt", "err", err)
+	}
+	return err
+}
+
+// handleEnhanceChoice generates the picture with the chosen description. choice is "e" for enhanced, "o" for original.
+func handleEnhanceChoice(b *Bot, chatID int64, messageID int, choice, key string) string {
+	pending, ok := b.loadPrompt(chatID, key)
+	if !ok {
+		return b.text(chatID, "prompt.expired")
+	}
+	b.store.Delete(promptsBucket, chatKey(chatID, key))
+	// Убираем кнопки, чтобы не запустить генерацию второй раз
+	b.tg.Send(tgbotapi.NewEditMessageReplyMarkup(chatID, messageID, tgbotapi.InlineKeyboardMarkup{InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{}}))
+
+	text := pending.Original
+	answer := b.text(chatID, "enhance.original")
+	if choice == "e" && pending.Enhanced != "" {
+		text = pending.Enhanced
+		// Негативный промпт из исходного сообщения сохраняем
+		if _, negative, found := strings.Cut(pending.Original, negativeSeparator); found {
+			text += " " + negativeSeparator + negative
+		}
+		answer = b.text(chatID, "enhance.improved")
+	}
+	b.submitJob(chatID, b.getSettings(chatID), text, pending.Photo)
+	return answer
+}
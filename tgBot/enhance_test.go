@@ -0,0 +1,104 @@
+package tgBot
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/MTUCI-Pixel-Team/Picture_Generator/generator"
+	"github.com/MTUCI-Pixel-Team/Picture_Generator/storage"
+)
+
+// runQueued runs the queued jobs one by one, like a single worker, until the queue is empty.
+func runQueued(b *Bot) {
+	for {
+		if pending, _ := b.queue.depth(); pending == 0 {
+			return
+		}
+		j := b.queue.next()
+		b.runJob(j)
+		b.queue.done(j)
+	}
+}
+
+// callbackKey returns the key of the button whose data starts with prefix.
+func callbackKey(t *testing.T, markup, prefix string) string {
+	_, key, found := strings.Cut(markup, `"callback_data":"`+prefix)
+	if !found {
+		t.Fatalf("no %q button in %s", prefix, markup)
+	}
+	key, _, _ = strings.Cut(key, `"`)
+	return key
+}
+
+func TestEnhanceFlow(t *testing.T) {
+	b, client := newJobBot(t, storage.NewMemoryStore())
+	settings := b.getSettings(1)
+	settings.enhance = true
+	b.submitPrompt(1, settings, "a cat on a sofa || blurry", "")
+	runQueued(b)
+
+	enhanced, _ := b.generator.EnhancePrompt(context.Background(), generator.EnhanceRequest{Prompt: "a cat on a sofa"})
+	result := tr("", "enhance.result", enhanced, "a cat on a sofa")
+	markup, sent := client.sentMarkup(result)
+	if !sent {
+		t.Fatalf("no enhanced prompt in %q", client.sentTexts())
+	}
+	key := callbackKey(t, markup, "en:e:")
+	if key != callbackKey(t, markup, "en:o:") {
+		t.Fatalf("buttons point to different prompts: %s", markup)
+	}
+
+	if answer := handleEnhanceChoice(b, 2, 0, "e", key); answer != tr("", "prompt.expired") {
+		t.Errorf("another chat chose the prompt: %q", answer)
+	}
+	if answer := handleEnhanceChoice(b, 1, 0, "e", key); answer != tr("", "enhance.improved") {
+		t.Fatalf("answer %q", answer)
+	}
+	// Второе нажатие не должно запускать генерацию ещё раз
+	if answer := handleEnhanceChoice(b, 1, 0, "o", key); answer != tr("", "prompt.expired") {
+		t.Errorf("prompt chosen twice: %q", answer)
+	}
+
+	if len(b.queue.pending) != 1 {
+		t.Fatalf("%d jobs queued, want the generation", len(b.queue.pending))
+	}
+	j := b.queue.pending[0]
+	if j.kind != jobGenerate || j.prompt != enhanced || j.negative != "blurry" {
+		t.Errorf("queued %v with %q and %q, want generation with the enhanced prompt and the inline negative", j.kind, j.prompt, j.negative)
+	}
+}
+
+func TestEnhanceFailureOffersOriginal(t *testing.T) {
+	b, client := newJobBot(t, storage.NewMemoryStore())
+	b.generator = failingEnhancer{b.generator}
+	settings := b.getSettings(1)
+	settings.enhance = true
+	b.submitPrompt(1, settings, "a cat on a sofa", "")
+	runQueued(b)
+
+	markup, sent := client.sentMarkup(tr("", "enhance.failed"))
+	if !sent {
+		t.Fatalf("no failure message in %q", client.sentTexts())
+	}
+	if strings.Contains(markup, "en:e:") {
+		t.Errorf("improved prompt offered after a failure: %s", markup)
+	}
+	key := callbackKey(t, markup, "en:o:")
+	if answer := handleEnhanceChoice(b, 1, 0, "o", key); answer != tr("", "enhance.original") {
+		t.Errorf("answer %q", answer)
+	}
+	if !slices.ContainsFunc(b.queue.pending, func(j *job) bool { return j.prompt == "a cat on a sofa" }) {
+		t.Error("original prompt is not queued")
+	}
+}
+
+type failingEnhancer struct {
+	generator.ImageGenerator
+}
+
+func (failingEnhancer) EnhancePrompt(context.Context, generator.EnhanceRequest) (string, error) {
+	return "", errors.New("provider is down")
+}
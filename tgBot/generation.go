@@ -0,0 +1,267 @@
+package tgBot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/MTUCI-Pixel-Team/Picture_Generator/generator"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// submitJob puts a generation with a copy of the current settings into the queue
+// and tells the user their position. photo is a Telegram file_id for image-to-image, it may be empty.
+func (b *Bot) submitJob(chatID int64, settings *UserSettings, text, photo string) {
+	if !b.allowNegative(chatID, settings, text) || !b.allowPrompt(chatID, settings, text) {
+		return
+	}
+	j := b.queue.newJob(b.ctx, jobGenerate, chatID)
+	j.prompt, j.negative = splitPrompt(text, settings.negativePrompt)
+	j.photo = photo
+	j.settings = *settings
+	j.statusText = tr(settings.language, "generation.status")
+	b.enqueue(j)
+}
+
+// allowNegative checks the length of the negative prompt written after the separator
+// like /negative does, the provider rejects longer ones.
+func (b *Bot) allowNegative(chatID int64, settings *UserSettings, text string) bool {
+	if _, negative := splitPrompt(text, ""); len(negative) > negativePromptMaxLength {
+		b.tg.Send(tgbotapi.NewMessage(chatID, tr(settings.language, "negative.too_long", negativePromptMaxLength)))
+		return false
+	}
+	return true
+}
+
+// enqueue checks the quota, pushes the job and sends the status message with the queue position.
+func (b *Bot) enqueue(j *job) {
+	chatID := j.chatID
+	j.lang = b.getSettings(chatID).language
+	if !b.checkQuota(j) {
+		j.cancel()
+		return
+	}
+	position, err := b.queue.push(j)
+	switch {
+	case errors.Is(err, errUserLimit):
+		text := tr(j.lang, "queue.user_limit", b.cfg.MaxJobsPerUser)
+		b.tg.Send(tgbotapi.NewMessage(chatID, text))
+		return
+	case errors.Is(err, errQueueClosed):
+		b.tg.Send(tgbotapi.NewMessage(chatID, tr(j.lang, "maintenance")))
+		return
+	case err != nil:
+		j.log.Warn("Job rejected", "err", err)
+		b.tg.Send(tgbotapi.NewMessage(chatID, tr(j.lang, "queue.full")))
+		return
+	}
+	j.log.Info("Job queued", "position", position)
+	defer close(j.ready)
+
+	// Пока задание ждёт, сообщение показывает позицию, потом оно заменяется на статус генерации
+	status := tr(j.lang, "queue.position", position, j.statusText)
+	botMsg, err := b.tg.Send(tgbotapi.NewMessage(chatID, status))
+	if err != nil {
+		j.log.Error("Failed to send queue position", "err", err)
+		return
+	}
+	j.statusMsg = botMsg.MessageID
+}
+
+// runJob is called by a queue worker.
+func (b *Bot) runJob(j *job) {
+	defer b.deleteMessage(j.chatID, j.statusMsg)
+	if j.statusMsg != 0 {
+		b.tg.Send(tgbotapi.NewEditMessageText(j.chatID, j.statusMsg, j.statusText))
+	}
+	err := b.chargeQuota(j)
+	if err != nil {
+		return
+	}
+	kind, model := j.kind.String(), jobModel(j)
+	jobsStarted.WithLabelValues(kind, model).Inc()
+	j.log.Info("Job started", "model", model, "wait", time.Since(j.createdAt))
+	started := time.Now()
+	switch j.kind {
+	case jobGenerate:
+		err = b.runGeneration(j)
+	case jobUpscale:
+		err = b.runUpscale(j)
+	case jobRemoveBackground:
+		err = b.runRemoveBackground(j)
+	case jobEnhance:
+		err = b.runEnhance(j)
+	case jobDescribe:
+		err = b.runDescribe(j)
+	}
+	jobDuration.WithLabelValues(kind).Observe(time.Since(started).Seconds())
+	if err != nil {
+		jobsFailed.WithLabelValues(kind, model, errorClass(err)).Inc()
+		if !errors.Is(err, context.Canceled) {
+			b.health.fail(err)
+		}
+		b.refundQuota(j)
+	} else {
+		jobsSucceeded.WithLabelValues(kind, model).Inc()
+	}
+	b.recordJob(j, err)
+}
+
+// runGeneration generates pictures and sends the result to the chat. The error is already reported to the user.
+func (b *Bot) runGeneration(j *job) error {
+	chatID := j.chatID
+	settings := j.settings
+
+	cfg := settings.cfgScale
+	if cfg == 0 {
+		cfg = options().cfgForModel(settings.model)
+	}
+	var seedImage []byte
+	if j.photo != "" {
+		var err error
+		seedImage, err = b.downloadTelegramFile(j.ctx, j.photo)
+		if j.ctx.Err() != nil {
+			j.log.Info("Job cancelled")
+			return j.ctx.Err()
+		}
+		if err != nil {
+			j.log.Error("Failed to download photo", "err", err)
+			b.tg.Send(tgbotapi.NewMessage(chatID, tr(j.lang, "photo.load_failed")))
+			return err
+		}
+	}
+	result, err := b.generator.Generate(j.ctx, generator.Request{
+		UserID:         chatID,
+		PositivePrompt: j.prompt,
+		NegativePrompt: j.negative,
+		Model:          settings.model,
+		Steps:          settings.steps,
+		Width:          settings.width,
+		Height:         settings.heigth,
+		NumberResults:  settings.numberResults,
+		Scheduler:      settings.scheduler,
+		Seed:           settings.seed,
+		CFGScale:       cfg,
+		SeedImage:      seedImage,
+		Strength:       settings.strength,
+	})
+	if j.ctx.Err() != nil {
+		j.log.Info("Job cancelled")
+		return j.ctx.Err()
+	}
+	if err != nil {
+		j.log.Error("Generation failed", "err", err, "class", errorClass(err))
+		b.tg.Send(tgbotapi.NewMessage(chatID, tr(j.lang, "generation.error")))
+		return err
+	}
+	j.log.Info("Generated", "images", len(result.Images), "seed", result.Seed, "cost", result.Cost, "duration", time.Since(j.createdAt))
+
+	var mediaGroup []interface{}
+	for _, img := range result.Images {
+		imageBytes := img.Bytes
+		if len(imageBytes) == 0 {
+			imageBytes, err = downloadImage(j.ctx, img.URL)
+			if j.ctx.Err() != nil {
+				j.log.Info("Job cancelled")
+				return j.ctx.Err()
+			}
+			if err != nil {
+				j.log.Error("Failed to download image", "err", err)
+				b.tg.Send(tgbotapi.NewMessage(chatID, tr(j.lang, "generation.load_failed")))
+				return err
+			}
+		}
+
+		// Добавляем изображение в слайс как InputMediaPhoto
+		photo := tgbotapi.NewInputMediaPhoto(tgbotapi.FileBytes{
+			Name:  "image",
+			Bytes: imageBytes,
+		})
+		seed := img.Seed
+		if seed == 0 {
+			seed = result.Seed
+		}
+		// С этим seed картинку можно повторить: /seed <seed> и тот же промпт
+		photo.Caption = tr(j.lang, "generation.seed", seed)
+		mediaGroup = append(mediaGroup, photo)
+	}
+
+	// Отправляем все фотографии разом. Последняя проверка отмены: SendMediaGroup не принимает
+	// контекст, начатую загрузку /cancel уже не прервёт
+	if j.ctx.Err() != nil {
+		j.log.Info("Job cancelled")
+		return j.ctx.Err()
+	}
+	if len(mediaGroup) > 0 {
+		mediaMsg := tgbotapi.NewMediaGroup(chatID, mediaGroup)
+		sent, err := b.tg.SendMediaGroup(mediaMsg)
+		if err != nil {
+			j.log.Error("Failed to send pictures", "err", err)
+			b.tg.Send(tgbotapi.NewMessage(chatID, tr(j.lang, "generation.send_failed")))
+			return err
+		}
+		// Картинки доставлены и оплачены провайдеру, отмена во время загрузки их не возвращает
+		if j.ctx.Err() != nil {
+			j.log.Info("Job cancelled during upload, pictures are delivered")
+		}
+		b.sendImageActions(chatID, j.lang, sent, result.Images)
+		b.saveHistory(j, cfg, result, sent)
+	}
+	return nil
+}
+
+func (b *Bot) deleteMessage(chatID int64, messageID int) {
+	if messageID == 0 {
+		return
+	}
+	deleteMsg := tgbotapi.DeleteMessageConfig{
+		ChatID:    chatID,
+		MessageID: messageID,
+	}
+	if _, err := b.tg.Request(deleteMsg); err != nil {
+		slog.Warn("Failed to delete message", "chat_id", chatID, "message_id", messageID, "err", err)
+	}
+}
+
+// downloadTelegramFile downloads a file sent by the user through the Bot API.
+func (b *Bot) downloadTelegramFile(ctx context.Context, fileID string) ([]byte, error) {
+	fileURL, err := b.tg.GetFileDirectURL(fileID)
+	if err != nil {
+		return nil, err
+	}
+	data, err := downloadImage(ctx, fileURL)
+	// В ссылке на файл есть токен бота, он не должен попасть в лог
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		err = fmt.Errorf("download file %s: %w", fileID, urlErr.Err)
+	}
+	return data, err
+}
+
+func downloadImage(ctx context.Context, url string) ([]byte, error) {
+	started := time.Now()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("download image: unexpected status %s", resp.Status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err == nil {
+		downloadDuration.Observe(time.Since(started).Seconds())
+		downloadSize.Observe(float64(len(data)))
+	}
+	return data, err
+}
@@ -0,0 +1,113 @@
+package tgBot
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/MTUCI-Pixel-Team/Picture_Generator/generator"
+	"github.com/MTUCI-Pixel-Team/Picture_Generator/storage"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// uploadTelegram delivers media groups and calls onUpload while the upload is "in progress".
+type uploadTelegram struct {
+	fakeTelegram
+	onUpload func()
+}
+
+func (u *uploadTelegram) Do(req *http.Request) (*http.Response, error) {
+	switch path.Base(req.URL.Path) {
+	case "sendMediaGroup":
+		u.onUpload()
+		body := `{"ok":true,"result":[{"message_id":7,"chat":{"id":1},"photo":[{"file_id":"photo","file_unique_id":"u","width":64,"height":64}]}]}`
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(body)), Header: http.Header{}}, nil
+	}
+	return u.fakeTelegram.Do(req)
+}
+
+// Загрузку не прервать, поэтому доставленные картинки оплачены и сохранены, даже если задание отменили
+func TestCancelDuringUpload(t *testing.T) {
+	tests := []struct {
+		name    string
+		cancel  bool
+		wantErr error
+	}{
+		{"delivered", false, nil},
+		{"cancelled while uploading", true, context.Canceled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := newJobQueue(10, 10)
+			j := q.newJob(context.Background(), jobGenerate, 1)
+			j.prompt = "a cat"
+			j.settings = UserSettings{model: "runware:100@1@1", steps: 10, width: 64, heigth: 64, numberResults: 1, language: "en"}
+
+			client := &uploadTelegram{onUpload: func() {
+				if tt.cancel {
+					j.cancel()
+				}
+			}}
+			api, err := tgbotapi.NewBotAPIWithClient("1:token", tgbotapi.APIEndpoint, client)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b := &Bot{
+				tg:        api,
+				store:     storage.NewMemoryStore(),
+				generator: generator.NewFake(0),
+				cfg:       Config{Quota: QuotaConfig{Tiers: map[string]QuotaLimits{"free": {Credits: 10}}, DefaultTier: "free"}},
+			}
+
+			b.runJob(j)
+			if err := j.ctx.Err(); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("job context: %v", err)
+			}
+			b.quotaMu.Lock()
+			record := b.loadQuota(1)
+			b.quotaMu.Unlock()
+			if record.Credits != 1 || record.Images != 1 {
+				t.Errorf("charged %d credits for %d images, want 1 for 1", record.Credits, record.Images)
+			}
+			if _, history := b.loadHistory(1); len(history) != 1 {
+				t.Errorf("%d history entries, want 1", len(history))
+			}
+		})
+	}
+}
+
+func TestJobKeepsLanguage(t *testing.T) {
+	client := &recordingTelegram{}
+	api, err := tgbotapi.NewBotAPIWithClient("1:token", tgbotapi.APIEndpoint, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake := generator.NewFake(0)
+	b := &Bot{tg: api, store: storage.NewMemoryStore(), generator: fake, queue: newJobQueue(10, 10), ctx: context.Background()}
+	settings := b.getSettings(1)
+	settings.language = "ru"
+
+	j := b.queue.newJob(b.ctx, jobEnhance, 1)
+	j.prompt = "a cat on a sofa"
+	b.enqueue(j)
+	// Пока задание выполняется, пользователь меняет язык в цикле обновлений
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		b.runJob(j)
+	}()
+	for i := 0; i < 100; i++ {
+		settings.language = languages[i%len(languages)].code
+	}
+	<-done
+
+	enhanced, _ := fake.EnhancePrompt(context.Background(), generator.EnhanceRequest{Prompt: j.prompt})
+	if want := tr("ru", "enhance.result", enhanced, j.prompt); !slices.Contains(client.sentTexts(), want) {
+		t.Errorf("no result in the language of the submission, messages %q", client.sentTexts())
+	}
+}
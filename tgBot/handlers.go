@@ -1,9 +1,10 @@
 package tgBot
 
 import (
-	"fmt"
-	"log"
+	"log/slog"
 	"strconv"
+	"strings"
+	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
@@ -16,22 +17,22 @@ func handleSteps(b *Bot, message string, chatID int64) {
 	case settings.state == "showVariableSteps":
 
 		// Переходим к выбору количества шагов
-		text := fmt.Sprintf(`Your current settings steps: "%d" Please choose one from keyboard. Type /cancel if you want to return to the start menu `, settings.steps)
+		text := tr(settings.language, "steps.current", settings.steps)
 		msg := tgbotapi.NewMessage(chatID, text)
 
-		keyboardSteps := getStepsMarkup()
+		keyboardSteps := getStepsMarkup(settings.language)
 
 		msg.ReplyMarkup = tgbotapi.NewReplyKeyboard(keyboardSteps...)
 		b.tg.Send(msg)
 		settings.state = "chooseSteps"
 		b.userSettings.Store(chatID, settings)
 	case settings.state == "chooseSteps":
-		if message == "default" {
-			settings.steps = defaultSteps
+		if message == tr(settings.language, "button.default") {
+			settings.steps = options().Defaults.Steps
 			settings.state = "done"
-			b.userSettings.Store(chatID, settings)
-			msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("Steps set to: %d", defaultSteps))
-			defaultKeyboard := getDefaultMarkup()
+			b.saveSettings(chatID, settings)
+			msg := tgbotapi.NewMessage(chatID, tr(settings.language, "steps.set", options().Defaults.Steps))
+			defaultKeyboard := getDefaultMarkup(settings.language)
 			msg.ReplyMarkup = tgbotapi.NewReplyKeyboard(defaultKeyboard...)
 			b.tg.Send(msg)
 			return
@@ -39,37 +40,102 @@ func handleSteps(b *Bot, message string, chatID int64) {
 		// Строку в число (ascii to integer)
 		steps, err := strconv.Atoi(message)
 		if err != nil {
-			log.Println(err)
-			msg := tgbotapi.NewMessage(chatID, "Invalid input. Please choose a number from keyboard:")
+			slog.Debug("Invalid steps value", "chat_id", chatID, "err", err)
+			msg := tgbotapi.NewMessage(chatID, tr(settings.language, "invalid.choose_number"))
 			b.tg.Send(msg)
 			return
 		}
 
 		// Проверка на вхождение введенного числа в список доступных значений
 		ok := false
-		for _, v := range stepsOptions {
+		for _, v := range options().Steps {
 			if v == steps {
 				ok = true
 				break
 			}
 		}
-		if ok || steps == defaultSteps {
+		if ok || steps == options().Defaults.Steps {
 			settings.steps = steps
 			settings.state = "done"
-			b.userSettings.Store(chatID, settings)
-			msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("Steps set to: %d", steps))
-			defaultKeyboard := getDefaultMarkup()
+			b.saveSettings(chatID, settings)
+			msg := tgbotapi.NewMessage(chatID, tr(settings.language, "steps.set", steps))
+			defaultKeyboard := getDefaultMarkup(settings.language)
 			msg.ReplyMarkup = tgbotapi.NewReplyKeyboard(defaultKeyboard...)
 			b.tg.Send(msg)
 			return
 		} else {
-			msg := tgbotapi.NewMessage(chatID, "Invalid input. Please enter a number from keyboard.")
+			msg := tgbotapi.NewMessage(chatID, tr(settings.language, "invalid.number"))
 			b.tg.Send(msg)
 		}
 	}
 
 }
 
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+func handleCFG(b *Bot, message string, chatID int64) {
+	loadSettings, _ := b.userSettings.Load(chatID)
+	settings := loadSettings.(*UserSettings)
+	switch {
+	case settings.state == "showVariableCFG":
+		current := formatFloat(settings.cfgScale)
+		if settings.cfgScale == 0 {
+			current = tr(settings.language, "cfg.current_default", formatFloat(options().cfgForModel(settings.model)))
+		}
+		text := tr(settings.language, "cfg.current", current)
+		msg := tgbotapi.NewMessage(chatID, text)
+
+		keyboardCFG := getCFGMarkup(settings.language)
+
+		msg.ReplyMarkup = tgbotapi.NewReplyKeyboard(keyboardCFG...)
+		b.tg.Send(msg)
+		settings.state = "chooseCFG"
+		b.userSettings.Store(chatID, settings)
+	case settings.state == "chooseCFG":
+		if message == tr(settings.language, "button.default") {
+			settings.cfgScale = 0
+			settings.state = "done"
+			b.saveSettings(chatID, settings)
+			msg := tgbotapi.NewMessage(chatID, tr(settings.language, "cfg.set_default", formatFloat(options().cfgForModel(settings.model))))
+			defaultKeyboard := getDefaultMarkup(settings.language)
+			msg.ReplyMarkup = tgbotapi.NewReplyKeyboard(defaultKeyboard...)
+			b.tg.Send(msg)
+			return
+		}
+		cfg, err := strconv.ParseFloat(message, 64)
+		if err != nil {
+			slog.Debug("Invalid cfg value", "chat_id", chatID, "err", err)
+			msg := tgbotapi.NewMessage(chatID, tr(settings.language, "invalid.choose_number"))
+			b.tg.Send(msg)
+			return
+		}
+
+		// Проверка на вхождение введенного числа в список доступных значений
+		ok := false
+		for _, v := range options().CFGScales {
+			if v == cfg {
+				ok = true
+				break
+			}
+		}
+		if ok {
+			settings.cfgScale = cfg
+			settings.state = "done"
+			b.saveSettings(chatID, settings)
+			msg := tgbotapi.NewMessage(chatID, tr(settings.language, "cfg.set", formatFloat(cfg)))
+			defaultKeyboard := getDefaultMarkup(settings.language)
+			msg.ReplyMarkup = tgbotapi.NewReplyKeyboard(defaultKeyboard...)
+			b.tg.Send(msg)
+			return
+		} else {
+			msg := tgbotapi.NewMessage(chatID, tr(settings.language, "invalid.number"))
+			b.tg.Send(msg)
+		}
+	}
+}
+
 func handleNumberResults(b *Bot, message string, chatID int64) {
 
 	loadSettings, _ := b.userSettings.Load(chatID)
@@ -78,22 +144,22 @@ func handleNumberResults(b *Bot, message string, chatID int64) {
 	case settings.state == "showVariableNumberResults":
 
 		// Переходим к выбору количества шагов
-		text := fmt.Sprintf(`Your current settings number results: "%d" Please choose one from keyboard. Type /cancel if you want to return to the start menu `, settings.numberResults)
+		text := tr(settings.language, "number_results.current", settings.numberResults)
 		msg := tgbotapi.NewMessage(chatID, text)
 
-		keyboardSteps := getNumberResultsMarkup()
+		keyboardSteps := getNumberResultsMarkup(settings.language)
 
 		msg.ReplyMarkup = tgbotapi.NewReplyKeyboard(keyboardSteps...)
 		b.tg.Send(msg)
 		settings.state = "chooseNumberResults"
 		b.userSettings.Store(chatID, settings)
 	case settings.state == "chooseNumberResults":
-		if message == "default" {
-			settings.numberResults = defaultNumberResults
+		if message == tr(settings.language, "button.default") {
+			settings.numberResults = options().Defaults.NumberResults
 			settings.state = "done"
-			b.userSettings.Store(chatID, settings)
-			msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("Number results set to: %d", defaultNumberResults))
-			defaultKeyboard := getDefaultMarkup()
+			b.saveSettings(chatID, settings)
+			msg := tgbotapi.NewMessage(chatID, tr(settings.language, "number_results.set", options().Defaults.NumberResults))
+			defaultKeyboard := getDefaultMarkup(settings.language)
 			msg.ReplyMarkup = tgbotapi.NewReplyKeyboard(defaultKeyboard...)
 			b.tg.Send(msg)
 			return
@@ -101,31 +167,31 @@ func handleNumberResults(b *Bot, message string, chatID int64) {
 		// Строку в число (ascii to integer)
 		numberResults, err := strconv.Atoi(message)
 		if err != nil {
-			log.Println(err)
-			msg := tgbotapi.NewMessage(chatID, "Invalid input. Please choose a number from keyboard:")
+			slog.Debug("Invalid number_results value", "chat_id", chatID, "err", err)
+			msg := tgbotapi.NewMessage(chatID, tr(settings.language, "invalid.choose_number"))
 			b.tg.Send(msg)
 			return
 		}
 
 		// Проверка на вхождение введенного числа в список доступных значений
 		ok := false
-		for _, v := range numberResultsOptions {
+		for _, v := range options().NumberResults {
 			if v == numberResults {
 				ok = true
 				break
 			}
 		}
-		if ok || numberResults == defaultSteps {
+		if ok || numberResults == options().Defaults.NumberResults {
 			settings.numberResults = numberResults
 			settings.state = "done"
-			b.userSettings.Store(chatID, settings)
-			msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("Number results set to: %d", numberResults))
-			defaultKeyboard := getDefaultMarkup()
+			b.saveSettings(chatID, settings)
+			msg := tgbotapi.NewMessage(chatID, tr(settings.language, "number_results.set", numberResults))
+			defaultKeyboard := getDefaultMarkup(settings.language)
 			msg.ReplyMarkup = tgbotapi.NewReplyKeyboard(defaultKeyboard...)
 			b.tg.Send(msg)
 			return
 		} else {
-			msg := tgbotapi.NewMessage(chatID, "Invalid input. Please enter a number from keyboard.")
+			msg := tgbotapi.NewMessage(chatID, tr(settings.language, "invalid.number"))
 			b.tg.Send(msg)
 		}
 	}
@@ -138,41 +204,33 @@ func handleModels(b *Bot, message string, chatID int64) {
 	// fmt.Println("STATE", settings.state)
 	switch settings.state {
 	case "showVariableModels":
-		modelName := ""
-		for key, value := range modelsOptions {
-			if value == settings.model {
-				modelName = key
-				break
-			}
-		}
+		modelName, _ := options().modelName(settings.model)
 		// Переходим к выбору количества шагов
-		text := fmt.Sprintf(`Your model: "%s" Please choose one from keyboard. Type /cancel if you want to return to the start menu`, modelName)
+		text := tr(settings.language, "models.current", modelName)
 		msg := tgbotapi.NewMessage(chatID, text)
-		keyboard := getModelsMarkup()
+		keyboard := getModelsMarkup(settings.language)
 		msg.ReplyMarkup = tgbotapi.NewReplyKeyboard(keyboard...)
 		b.tg.Send(msg)
 		settings.state = "chooseModels"
 		b.userSettings.Store(chatID, settings)
 	case "chooseModels":
-		// Проверка на вхождение введенной модели в список доступных значений
-		ok := 0
-		for key := range modelsOptions {
-			if key == message {
-				ok = 1
-			}
+		if message == tr(settings.language, "button.default") {
+			message, _ = options().modelName(options().Defaults.Model)
 		}
-		if ok == 1 || modelsOptions[message] == defaultModel {
-			settings.model = modelsOptions[message]
+		// Проверка на вхождение введенной модели в список доступных значений
+		model, ok := options().modelAIR(message)
+		if ok {
+			settings.model = model
 			settings.state = "done"
-			b.userSettings.Store(chatID, settings)
+			b.saveSettings(chatID, settings)
 
-			msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("Model set to: %s", message))
-			defaultKeyboard := getDefaultMarkup()
+			msg := tgbotapi.NewMessage(chatID, tr(settings.language, "models.set", message))
+			defaultKeyboard := getDefaultMarkup(settings.language)
 			msg.ReplyMarkup = tgbotapi.NewReplyKeyboard(defaultKeyboard...)
 			b.tg.Send(msg)
 			return
-		} else if ok == 0 {
-			msg := tgbotapi.NewMessage(chatID, "Invalid input. Please enter a model from keyboard.")
+		} else {
+			msg := tgbotapi.NewMessage(chatID, tr(settings.language, "invalid.model"))
 			b.tg.Send(msg)
 		}
 
@@ -184,42 +242,34 @@ func handleSize(b *Bot, message string, chatID int64) {
 	settings := loadSettings.(*UserSettings)
 	switch settings.state {
 	case "showVariableSize":
-		sizeName := ""
-		for key, value := range sizeOptions {
-			if value[0] == settings.width && value[1] == settings.heigth {
-				sizeName = key
-				break
-			}
-		}
+		sizeName, _ := options().sizeName(settings.width, settings.heigth)
 		// Переходим к выбору количества шагов
-		text := fmt.Sprintf(`Your size: "%s" Please choose one from keyboard. Type /cancel if you want to return to the start menus`, sizeName)
+		text := tr(settings.language, "size.current", sizeName)
 		msg := tgbotapi.NewMessage(chatID, text)
-		keyboard := getSizeMarkup()
+		keyboard := getSizeMarkup(settings.language)
 		msg.ReplyMarkup = tgbotapi.NewReplyKeyboard(keyboard...)
 		b.tg.Send(msg)
 		settings.state = "chooseSize"
 		b.userSettings.Store(chatID, settings)
 	case "chooseSize":
-		// Проверка на вхождение введенной модели в список доступных значений
-		ok := 0
-		for key := range sizeOptions {
-			if key == message {
-				ok = 1
-			}
+		if message == tr(settings.language, "button.default") {
+			message, _ = options().sizeName(options().Defaults.Width, options().Defaults.Height)
 		}
-		if ok == 1 || sizeOptions[message] == defaultSize {
-			settings.width = sizeOptions[message][0]
-			settings.heigth = sizeOptions[message][1]
+		// Проверка на вхождение введенного размера в список доступных значений
+		size, ok := options().size(message)
+		if ok {
+			settings.width = size.Width
+			settings.heigth = size.Height
 			settings.state = "done"
-			b.userSettings.Store(chatID, settings)
+			b.saveSettings(chatID, settings)
 
-			msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("Size set to: %s", message))
-			defaultKeyboard := getDefaultMarkup()
+			msg := tgbotapi.NewMessage(chatID, tr(settings.language, "size.set", message))
+			defaultKeyboard := getDefaultMarkup(settings.language)
 			msg.ReplyMarkup = tgbotapi.NewReplyKeyboard(defaultKeyboard...)
 			b.tg.Send(msg)
 			return
-		} else if ok == 0 {
-			msg := tgbotapi.NewMessage(chatID, "Invalid input. Please enter a model from keyboard.")
+		} else {
+			msg := tgbotapi.NewMessage(chatID, tr(settings.language, "invalid.size"))
 			b.tg.Send(msg)
 		}
 
@@ -233,42 +283,364 @@ func handleSchedulers(b *Bot, message string, chatID int64) {
 	switch settings.state {
 	case "showVariableSchedulers":
 		schedulerName := ""
-		for _, value := range schedulersOptions {
+		for _, value := range options().Schedulers {
 			if value == settings.scheduler {
 				schedulerName = value
 				break
 			}
 		}
 		// Переходим к выбору количества шагов
-		text := fmt.Sprintf(`Your scheduler: "%s" Please choose one from keyboard. Type /cancel if you want to return to the start menu`, schedulerName)
+		text := tr(settings.language, "schedulers.current", schedulerName)
 		msg := tgbotapi.NewMessage(chatID, text)
-		keyboard := getSchedulersMarkup()
+		keyboard := getSchedulersMarkup(settings.language)
 		msg.ReplyMarkup = tgbotapi.NewReplyKeyboard(keyboard...)
 		b.tg.Send(msg)
 		settings.state = "chooseSchedulers"
 		b.userSettings.Store(chatID, settings)
 	case "chooseSchedulers":
+		if message == tr(settings.language, "button.default") {
+			message = options().Defaults.Scheduler
+		}
 		// Проверка на вхождение введенной модели в список доступных значений
 		ok := 0
-		for _, value := range schedulersOptions {
+		for _, value := range options().Schedulers {
 			if value == message {
 				ok = 1
 			}
 		}
-		if ok == 1 || message == defaultModel {
+		if ok == 1 || message == options().Defaults.Scheduler {
 			settings.scheduler = message
 			settings.state = "done"
-			b.userSettings.Store(chatID, settings)
+			b.saveSettings(chatID, settings)
 
-			msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("Scheduler set to: %s", message))
-			defaultKeyboard := getDefaultMarkup()
+			msg := tgbotapi.NewMessage(chatID, tr(settings.language, "schedulers.set", message))
+			defaultKeyboard := getDefaultMarkup(settings.language)
 			msg.ReplyMarkup = tgbotapi.NewReplyKeyboard(defaultKeyboard...)
 			b.tg.Send(msg)
 			return
 		} else if ok == 0 {
-			msg := tgbotapi.NewMessage(chatID, "Invalid input. Please enter a scheduler from keyboard.")
+			msg := tgbotapi.NewMessage(chatID, tr(settings.language, "invalid.scheduler"))
+			b.tg.Send(msg)
+		}
+
+	}
+}
+
+func handleNegativePrompt(b *Bot, message string, chatID int64) {
+	loadSettings, _ := b.userSettings.Load(chatID)
+	settings := loadSettings.(*UserSettings)
+	switch settings.state {
+	case "showVariableNegativePrompt":
+		none := tr(settings.language, "button.none")
+		current := settings.negativePrompt
+		if current == "" {
+			current = none
+		}
+		text := tr(settings.language, "negative.current", current, none)
+		msg := tgbotapi.NewMessage(chatID, text)
+		msg.ReplyMarkup = tgbotapi.NewReplyKeyboard(tgbotapi.NewKeyboardButtonRow(tgbotapi.NewKeyboardButton(none)))
+		b.tg.Send(msg)
+		settings.state = "chooseNegativePrompt"
+		b.userSettings.Store(chatID, settings)
+	case "chooseNegativePrompt":
+		if strings.HasPrefix(message, "/") {
+			msg := tgbotapi.NewMessage(chatID, tr(settings.language, "negative.invalid"))
+			b.tg.Send(msg)
+			return
+		}
+		if len(message) > negativePromptMaxLength {
+			msg := tgbotapi.NewMessage(chatID, tr(settings.language, "negative.too_long", negativePromptMaxLength))
+			b.tg.Send(msg)
+			return
+		}
+		text := tr(settings.language, "negative.set", message)
+		if message == tr(settings.language, "button.none") {
+			message = ""
+			text = tr(settings.language, "negative.cleared")
+		}
+		settings.negativePrompt = message
+		settings.state = "done"
+		b.saveSettings(chatID, settings)
+
+		msg := tgbotapi.NewMessage(chatID, text)
+		defaultKeyboard := getDefaultMarkup(settings.language)
+		msg.ReplyMarkup = tgbotapi.NewReplyKeyboard(defaultKeyboard...)
+		b.tg.Send(msg)
+	}
+}
+
+func handleSeed(b *Bot, message string, chatID int64) {
+	loadSettings, _ := b.userSettings.Load(chatID)
+	settings := loadSettings.(*UserSettings)
+	switch settings.state {
+	case "showVariableSeed":
+		random := tr(settings.language, "button.random")
+		current := random
+		if settings.seed != 0 {
+			current = strconv.FormatInt(settings.seed, 10)
+		}
+		text := tr(settings.language, "seed.current", current, random)
+		msg := tgbotapi.NewMessage(chatID, text)
+		msg.ReplyMarkup = tgbotapi.NewReplyKeyboard(tgbotapi.NewKeyboardButtonRow(tgbotapi.NewKeyboardButton(random)))
+		b.tg.Send(msg)
+		settings.state = "chooseSeed"
+		b.userSettings.Store(chatID, settings)
+	case "chooseSeed":
+		random := tr(settings.language, "button.random")
+		var seed int64
+		if message != random {
+			var err error
+			seed, err = strconv.ParseInt(message, 10, 64)
+			if err != nil || seed <= 0 {
+				msg := tgbotapi.NewMessage(chatID, tr(settings.language, "seed.invalid", random))
+				b.tg.Send(msg)
+				return
+			}
+		}
+		settings.seed = seed
+		settings.state = "done"
+		b.saveSettings(chatID, settings)
+
+		text := tr(settings.language, "seed.set", strconv.FormatInt(seed, 10))
+		if seed == 0 {
+			text = tr(settings.language, "seed.set", random)
+		}
+		msg := tgbotapi.NewMessage(chatID, text)
+		defaultKeyboard := getDefaultMarkup(settings.language)
+		msg.ReplyMarkup = tgbotapi.NewReplyKeyboard(defaultKeyboard...)
+		b.tg.Send(msg)
+	}
+}
+
+func handleStrength(b *Bot, message string, chatID int64) {
+	loadSettings, _ := b.userSettings.Load(chatID)
+	settings := loadSettings.(*UserSettings)
+	switch {
+	case settings.state == "showVariableStrength":
+		text := tr(settings.language, "strength.current", formatFloat(settings.strength))
+		msg := tgbotapi.NewMessage(chatID, text)
+
+		keyboardStrength := getStrengthMarkup(settings.language)
+
+		msg.ReplyMarkup = tgbotapi.NewReplyKeyboard(keyboardStrength...)
+		b.tg.Send(msg)
+		settings.state = "chooseStrength"
+		b.userSettings.Store(chatID, settings)
+	case settings.state == "chooseStrength":
+		if message == tr(settings.language, "button.default") {
+			message = formatFloat(options().Defaults.Strength)
+		}
+		strength, err := strconv.ParseFloat(message, 64)
+		if err != nil {
+			slog.Debug("Invalid strength value", "chat_id", chatID, "err", err)
+			msg := tgbotapi.NewMessage(chatID, tr(settings.language, "invalid.choose_number"))
 			b.tg.Send(msg)
+			return
 		}
 
+		// Проверка на вхождение введенного числа в список доступных значений
+		ok := false
+		for _, v := range options().Strengths {
+			if v == strength {
+				ok = true
+				break
+			}
+		}
+		if ok {
+			settings.strength = strength
+			settings.state = "done"
+			b.saveSettings(chatID, settings)
+			msg := tgbotapi.NewMessage(chatID, tr(settings.language, "strength.set", formatFloat(strength)))
+			defaultKeyboard := getDefaultMarkup(settings.language)
+			msg.ReplyMarkup = tgbotapi.NewReplyKeyboard(defaultKeyboard...)
+			b.tg.Send(msg)
+			return
+		} else {
+			msg := tgbotapi.NewMessage(chatID, tr(settings.language, "invalid.number"))
+			b.tg.Send(msg)
+		}
+	}
+}
+
+// handlePhoto starts an image-to-image generation from a sent photo. The caption is the prompt,
+// without a caption the bot asks for it.
+func handlePhoto(b *Bot, message *tgbotapi.Message, chatID int64) {
+	settings := b.getSettings(chatID)
+	photo := largestPhoto(message.Photo)
+	uploaded := storedImage{ChatID: chatID, FileID: photo.FileID, CreatedAt: time.Now()}
+	command, _ := splitCommand(message.Caption)
+	switch {
+	case command == "/remove_bg" || settings.state == "chooseRemoveBgPhoto":
+		settings.state = "done"
+		b.userSettings.Store(chatID, settings)
+		b.submitRemoveBackground(chatID, uploaded)
+		return
+	case command == "/describe" || settings.state == "chooseDescribePhoto":
+		settings.state = "done"
+		b.userSettings.Store(chatID, settings)
+		b.submitDescribe(chatID, uploaded)
+		return
+	}
+	if settings.state != "done" && settings.state != "" && settings.state != "choosePhotoPrompt" {
+		msg := tgbotapi.NewMessage(chatID, tr(settings.language, "photo.finish_menu"))
+		b.tg.Send(msg)
+		return
+	}
+	prompt, _ := splitPrompt(message.Caption, "")
+	if len(prompt) < 3 {
+		settings.pendingPhoto = photo.FileID
+		settings.state = "choosePhotoPrompt"
+		b.userSettings.Store(chatID, settings)
+		msg := tgbotapi.NewMessage(chatID, tr(settings.language, "photo.ask_prompt"))
+		msg.ReplyMarkup = tgbotapi.NewRemoveKeyboard(false)
+		b.tg.Send(msg)
+		return
+	}
+	settings.pendingPhoto = ""
+	settings.state = "done"
+	b.userSettings.Store(chatID, settings)
+	b.submitPrompt(chatID, settings, message.Caption, photo.FileID)
+}
+
+// handlePhotoPrompt receives the description for a photo sent without a caption.
+func handlePhotoPrompt(b *Bot, message string, chatID int64) {
+	settings := b.getSettings(chatID)
+	if strings.HasPrefix(message, "/") || message == "" {
+		msg := tgbotapi.NewMessage(chatID, tr(settings.language, "photo.prompt_expected"))
+		b.tg.Send(msg)
+		return
+	}
+	if prompt, _ := splitPrompt(message, ""); len(prompt) < 3 {
+		msg := tgbotapi.NewMessage(chatID, tr(settings.language, "prompt.too_short"))
+		b.tg.Send(msg)
+		return
+	}
+	fileID := settings.pendingPhoto
+	settings.pendingPhoto = ""
+	settings.state = "done"
+	b.userSettings.Store(chatID, settings)
+
+	msg := tgbotapi.NewMessage(chatID, tr(settings.language, "photo.prompt_accepted"))
+	defaultKeyboard := getDefaultMarkup(settings.language)
+	msg.ReplyMarkup = tgbotapi.NewReplyKeyboard(defaultKeyboard...)
+	b.tg.Send(msg)
+	b.submitPrompt(chatID, settings, message, fileID)
+}
+
+// handleEnhance switches the prompt enhancer. Without arguments it toggles the current value.
+func handleEnhance(b *Bot, args string, chatID int64) {
+	settings := b.getSettings(chatID)
+	switch args {
+	case "":
+		settings.enhance = !settings.enhance
+	case "on":
+		settings.enhance = true
+	case "off":
+		settings.enhance = false
+	default:
+		msg := tgbotapi.NewMessage(chatID, tr(settings.language, "enhance.usage"))
+		b.tg.Send(msg)
+		return
+	}
+	b.saveSettings(chatID, settings)
+
+	text := tr(settings.language, "enhance.off")
+	if settings.enhance {
+		text = tr(settings.language, "enhance.on")
+	}
+	msg := tgbotapi.NewMessage(chatID, text)
+	defaultKeyboard := getDefaultMarkup(settings.language)
+	msg.ReplyMarkup = tgbotapi.NewReplyKeyboard(defaultKeyboard...)
+	b.tg.Send(msg)
+}
+
+// handleRemoveBackground removes the background of the replied picture or asks for a photo.
+func handleRemoveBackground(b *Bot, message *tgbotapi.Message, chatID int64) {
+	settings := b.getSettings(chatID)
+	if reply := message.ReplyToMessage; reply != nil && len(reply.Photo) > 0 {
+		b.submitRemoveBackground(chatID, b.findImage(chatID, largestPhoto(reply.Photo)))
+		return
+	}
+	settings.state = "chooseRemoveBgPhoto"
+	b.userSettings.Store(chatID, settings)
+	msg := tgbotapi.NewMessage(chatID, tr(settings.language, "remove_bg.ask"))
+	b.tg.Send(msg)
+}
+
+func largestPhoto(sizes []tgbotapi.PhotoSize) tgbotapi.PhotoSize {
+	largest := sizes[0]
+	for _, size := range sizes[1:] {
+		if size.Width*size.Height > largest.Width*largest.Height {
+			largest = size
+		}
+	}
+	return largest
+}
+
+// handleCancel leaves any settings menu and stops queued and running generations of the user.
+func handleCancel(b *Bot, chatID int64) {
+	settings := b.getSettings(chatID)
+	inMenu := settings.state != "done" && settings.state != ""
+	settings.state = "done"
+	settings.pendingPhoto = ""
+	b.userSettings.Store(chatID, settings)
+
+	removed, running := b.queue.cancelUser(chatID)
+	for _, j := range removed {
+		b.deleteMessage(chatID, j.statusMsg)
+	}
+
+	cancelled := len(removed)
+	if running != nil {
+		cancelled++
+	}
+	var text string
+	switch {
+	case cancelled > 0:
+		text = tr(settings.language, "cancel.cancelled", cancelled)
+	case inMenu:
+		text = tr(settings.language, "cancel.menu")
+	default:
+		text = tr(settings.language, "cancel.nothing")
+	}
+	msg := tgbotapi.NewMessage(chatID, text)
+	defaultKeyboard := getDefaultMarkup(settings.language)
+	msg.ReplyMarkup = tgbotapi.NewReplyKeyboard(defaultKeyboard...)
+	b.tg.Send(msg)
+}
+
+func handleLanguage(b *Bot, message string, chatID int64) {
+	settings := b.getSettings(chatID)
+	switch settings.state {
+	case "showVariableLanguage":
+		text := tr(settings.language, "language.current", languageName(settings.language))
+		msg := tgbotapi.NewMessage(chatID, text)
+		keyboard := getLanguageMarkup()
+		msg.ReplyMarkup = tgbotapi.NewReplyKeyboard(keyboard...)
+		b.tg.Send(msg)
+		settings.state = "chooseLanguage"
+		b.userSettings.Store(chatID, settings)
+	case "chooseLanguage":
+		// Подходит и название с клавиатуры, и код языка: /language ru
+		language := ""
+		for _, l := range languages {
+			if message == l.name || strings.EqualFold(message, l.code) {
+				language = l.code
+				break
+			}
+		}
+		if language == "" {
+			msg := tgbotapi.NewMessage(chatID, tr(settings.language, "language.invalid"))
+			b.tg.Send(msg)
+			return
+		}
+		settings.language = language
+		settings.state = "done"
+		b.saveSettings(chatID, settings)
+
+		msg := tgbotapi.NewMessage(chatID, tr(language, "language.set", languageName(language)))
+		defaultKeyboard := getDefaultMarkup(settings.language)
+		msg.ReplyMarkup = tgbotapi.NewReplyKeyboard(defaultKeyboard...)
+		b.tg.Send(msg)
 	}
 }
@@ -0,0 +1,54 @@
+package tgBot
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/MTUCI-Pixel-Team/Picture_Generator/storage"
+)
+
+func TestHandleCFG(t *testing.T) {
+	c := builtinCatalog
+	c.Models = []ModelOption{
+		{Name: "Own", AIR: "runware:1@1", CFGScale: 4},
+		{Name: "Shared", AIR: "runware:2@1"},
+	}
+	c.CFGScales = []float64{3.5, 7, 9}
+	c.Defaults.CFGScale = 7
+	currentCatalog.Store(&c)
+	defer currentCatalog.Store(&builtinCatalog)
+
+	tests := []struct {
+		name      string
+		model     string
+		state     string
+		cfg       float64
+		message   string
+		wantCFG   float64
+		wantState string
+		wantText  string
+	}{
+		{"current per-model default", "runware:1@1", "showVariableCFG", 0, "", 0, "chooseCFG", tr("", "cfg.current", tr("", "cfg.current_default", "4"))},
+		{"value from the list", "runware:1@1", "chooseCFG", 5, "9", 9, "done", tr("", "cfg.set", "9")},
+		{"value out of the list", "runware:1@1", "chooseCFG", 5, "10", 5, "chooseCFG", tr("", "invalid.number")},
+		{"negative value", "runware:1@1", "chooseCFG", 5, "-7", 5, "chooseCFG", tr("", "invalid.number")},
+		{"not a number", "runware:1@1", "chooseCFG", 5, "high", 5, "chooseCFG", tr("", "invalid.choose_number")},
+		{"default of the model", "runware:1@1", "chooseCFG", 5, tr("", "button.default"), 0, "done", tr("", "cfg.set_default", "4")},
+		{"default of the catalog", "runware:2@1", "chooseCFG", 5, tr("", "button.default"), 0, "done", tr("", "cfg.set_default", "7")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, client := newJobBot(t, storage.NewMemoryStore())
+			settings := b.getSettings(1)
+			settings.model, settings.state, settings.cfgScale = tt.model, tt.state, tt.cfg
+			handleCFG(b, tt.message, 1)
+
+			if settings.cfgScale != tt.wantCFG || settings.state != tt.wantState {
+				t.Errorf("cfg %v in state %q, want %v in %q", settings.cfgScale, settings.state, tt.wantCFG, tt.wantState)
+			}
+			if texts := client.sentTexts(); !slices.Contains(texts, tt.wantText) {
+				t.Errorf("messages %q, want %q", texts, tt.wantText)
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package tgBot
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"path"
+	"sync"
+	"time"
+)
+
+const (
+	// heartbeatInterval wakes the update loop when there are no updates.
+	heartbeatInterval = 30 * time.Second
+	// loopStaleAfter is how long the update loop may stay silent, a longer pause means a handler is stuck.
+	loopStaleAfter = 2 * time.Minute
+	// pollStaleAfter is how long long polling may go without a successful getUpdates, one request lasts up to a minute.
+	pollStaleAfter = 3 * time.Minute
+	probeTimeout   = 10 * time.Second
+)
+
+// healthState is what /healthz and /readyz report.
+type healthState struct {
+	mu         sync.Mutex
+	lastBeat   time.Time // Последний проход цикла обновлений
+	lastPoll   time.Time // Последний успешный getUpdates
+	probeAt    time.Time
+	probeErr   error
+	lastErr    string
+	lastErrAt  time.Time
+	polling    bool
+	loopActive bool
+}
+
+func (h *healthState) beat() {
+	h.mu.Lock()
+	h.lastBeat = time.Now()
+	h.mu.Unlock()
+}
+
+func (h *healthState) polled() {
+	h.mu.Lock()
+	h.lastPoll = time.Now()
+	h.mu.Unlock()
+}
+
+// fail remembers the error for the reports.
+func (h *healthState) fail(err error) {
+	h.mu.Lock()
+	h.lastErr, h.lastErrAt = err.Error(), time.Now()
+	h.mu.Unlock()
+}
+
+// observe counts a request to the Bot API, successful getUpdates calls show that polling works.
+func (h *healthState) observe(req *http.Request, resp *http.Response, err error) {
+	if err == nil && resp.StatusCode == http.StatusOK && path.Base(req.URL.Path) == "getUpdates" {
+		h.polled()
+	}
+}
+
+type healthReport struct {
+	Status      string     `json:"status"`
+	Problems    []string   `json:"problems,omitempty"`
+	LastUpdate  *time.Time `json:"lastUpdate,omitempty"`
+	LastPoll    *time.Time `json:"lastPoll,omitempty"`
+	LastProbe   *time.Time `json:"lastProbe,omitempty"`
+	ProbeError  string     `json:"probeError,omitempty"`
+	Pending     int        `json:"pending"`
+	Running     int        `json:"running"`
+	LastError   string     `json:"lastError,omitempty"`
+	LastErrorAt *time.Time `json:"lastErrorAt,omitempty"`
+}
+
+func timeRef(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// report checks the update loop and, for readiness, the generator probe and the shutdown.
+func (b *Bot) report(ready bool) healthReport {
+	h := b.health
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	r := healthReport{
+		LastUpdate:  timeRef(h.lastBeat),
+		LastPoll:    timeRef(h.lastPoll),
+		LastProbe:   timeRef(h.probeAt),
+		LastError:   h.lastErr,
+		LastErrorAt: timeRef(h.lastErrAt),
+	}
+	r.Pending, r.Running = b.queue.depth()
+	if h.probeErr != nil {
+		r.ProbeError = h.probeErr.Error()
+	}
+
+	now := time.Now()
+	switch {
+	case !h.loopActive:
+		r.Problems = append(r.Problems, "update loop is not running")
+	case now.Sub(h.lastBeat) > loopStaleAfter:
+		r.Problems = append(r.Problems, "update loop is stuck")
+	case h.polling && now.Sub(h.lastPoll) > pollStaleAfter:
+		r.Problems = append(r.Problems, "no successful getUpdates")
+	}
+	if ready {
+		switch {
+		case b.stopping.Load():
+			r.Problems = append(r.Problems, "shutting down")
+		case h.probeAt.IsZero():
+			r.Problems = append(r.Problems, "generator is not probed yet")
+		case h.probeErr != nil:
+			r.Problems = append(r.Problems, "generator probe failed")
+		case now.Sub(h.probeAt) > 3*b.cfg.ProbeInterval:
+			r.Problems = append(r.Problems, "generator probe is stale")
+		}
+	}
+	r.Status = "ok"
+	if len(r.Problems) > 0 {
+		r.Status = "fail"
+	}
+	return r
+}
+
+// HealthHandler answers 200 while the update loop works. A supervisor should restart the bot on 503.
+func (b *Bot) HealthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeReport(w, b.report(false))
+	})
+}
+
+// ReadyHandler answers 200 when the bot can also generate: the generator answers and the bot is not stopping.
+func (b *Bot) ReadyHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeReport(w, b.report(true))
+	})
+}
+
+func writeReport(w http.ResponseWriter, report healthReport) {
+	w.Header().Set("Content-Type", "application/json")
+	if report.Status != "ok" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(report)
+}
+
+// probeGenerator pings the generator every cfg.ProbeInterval until the bot stops.
+func (b *Bot) probeGenerator() {
+	ticker := time.NewTicker(b.cfg.ProbeInterval)
+	defer ticker.Stop()
+	for {
+		ctx, cancel := context.WithTimeout(b.ctx, probeTimeout)
+		err := b.generator.Ping(ctx)
+		cancel()
+		if b.ctx.Err() != nil {
+			return
+		}
+		b.health.mu.Lock()
+		wasFailing := b.health.probeErr != nil
+		b.health.probeAt, b.health.probeErr = time.Now(), err
+		b.health.mu.Unlock()
+		switch {
+		case err != nil:
+			slog.Warn("Generator probe failed", "err", err)
+			b.health.fail(err)
+		case wasFailing:
+			slog.Info("Generator probe succeeded again")
+		}
+
+		select {
+		case <-ticker.C:
+		case <-b.ctx.Done():
+			return
+		}
+	}
+}
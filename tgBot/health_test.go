@@ -0,0 +1,167 @@
+package tgBot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/MTUCI-Pixel-Team/Picture_Generator/generator"
+	"github.com/MTUCI-Pixel-Team/Picture_Generator/storage"
+)
+
+type failingPing struct {
+	generator.ImageGenerator
+}
+
+func (failingPing) Ping(context.Context) error {
+	return errors.New("connection refused")
+}
+
+// probe runs probeGenerator until the first probe is recorded.
+func probe(t *testing.T, b *Bot) {
+	ctx, cancel := context.WithCancel(context.Background())
+	b.ctx = ctx
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		b.probeGenerator()
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+	deadline := time.Now().Add(time.Second)
+	for {
+		b.health.mu.Lock()
+		probed := !b.health.probeAt.IsZero()
+		b.health.mu.Unlock()
+		if probed {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("generator is not probed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestHealthHandlers(t *testing.T) {
+	tests := []struct {
+		name       string
+		setup      func(t *testing.T, b *Bot)
+		wantHealth int
+		wantReady  int
+		problem    string
+	}{
+		{
+			name:       "healthy probe",
+			setup:      probe,
+			wantHealth: http.StatusOK,
+			wantReady:  http.StatusOK,
+		},
+		{
+			name: "stale probe",
+			setup: func(t *testing.T, b *Bot) {
+				probe(t, b)
+				b.health.probeAt = time.Now().Add(-4 * b.cfg.ProbeInterval)
+			},
+			wantHealth: http.StatusOK,
+			wantReady:  http.StatusServiceUnavailable,
+			problem:    "generator probe is stale",
+		},
+		{
+			name: "failing generator probe",
+			setup: func(t *testing.T, b *Bot) {
+				b.generator = failingPing{b.generator}
+				probe(t, b)
+			},
+			wantHealth: http.StatusOK,
+			wantReady:  http.StatusServiceUnavailable,
+			problem:    "generator probe failed",
+		},
+		{
+			name:       "not probed yet",
+			setup:      func(t *testing.T, b *Bot) {},
+			wantHealth: http.StatusOK,
+			wantReady:  http.StatusServiceUnavailable,
+			problem:    "generator is not probed yet",
+		},
+		{
+			name: "stuck update loop",
+			setup: func(t *testing.T, b *Bot) {
+				probe(t, b)
+				b.health.lastBeat = time.Now().Add(-loopStaleAfter - time.Second)
+			},
+			wantHealth: http.StatusServiceUnavailable,
+			wantReady:  http.StatusServiceUnavailable,
+			problem:    "update loop is stuck",
+		},
+		{
+			name: "no getUpdates",
+			setup: func(t *testing.T, b *Bot) {
+				probe(t, b)
+				b.health.lastPoll = time.Now().Add(-pollStaleAfter - time.Second)
+			},
+			wantHealth: http.StatusServiceUnavailable,
+			wantReady:  http.StatusServiceUnavailable,
+			problem:    "no successful getUpdates",
+		},
+		{
+			name: "shutting down",
+			setup: func(t *testing.T, b *Bot) {
+				probe(t, b)
+				b.stopping.Store(true)
+			},
+			wantHealth: http.StatusOK,
+			wantReady:  http.StatusServiceUnavailable,
+			problem:    "shutting down",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, _ := newJobBot(t, storage.NewMemoryStore())
+			b.cfg.ProbeInterval = time.Minute
+			b.health.loopActive, b.health.polling = true, true
+			b.health.lastBeat, b.health.lastPoll = time.Now(), time.Now()
+			tt.setup(t, b)
+
+			for _, check := range []struct {
+				handler http.Handler
+				want    int
+			}{{b.HealthHandler(), tt.wantHealth}, {b.ReadyHandler(), tt.wantReady}} {
+				w := httptest.NewRecorder()
+				check.handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+				var report healthReport
+				if err := json.NewDecoder(w.Body).Decode(&report); err != nil {
+					t.Fatal(err)
+				}
+				if w.Code != check.want {
+					t.Errorf("status %d, want %d, problems %q", w.Code, check.want, report.Problems)
+				}
+				if (w.Code == http.StatusOK) != (report.Status == "ok") {
+					t.Errorf("status %q with code %d", report.Status, w.Code)
+				}
+				if w.Code != http.StatusOK && !slices.Contains(report.Problems, tt.problem) {
+					t.Errorf("problems %q, want %q", report.Problems, tt.problem)
+				}
+			}
+		})
+	}
+}
+
+func TestFailedProbeIsReported(t *testing.T) {
+	b, _ := newJobBot(t, storage.NewMemoryStore())
+	b.cfg.ProbeInterval = time.Minute
+	b.generator = failingPing{b.generator}
+	probe(t, b)
+
+	report := b.report(true)
+	if report.ProbeError != "connection refused" || report.LastError != "connection refused" || report.LastErrorAt == nil {
+		t.Errorf("probe error %q, last error %q at %v", report.ProbeError, report.LastError, report.LastErrorAt)
+	}
+}
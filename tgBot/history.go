@@ -0,0 +1,206 @@
+package tgBot
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MTUCI-Pixel-Team/Picture_Generator/generator"
+	"github.com/google/uuid"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	historyBucket = "history"
+	// historyLimit is how many generations are kept for a chat, older ones are deleted.
+	historyLimit    = 50
+	historyPageSize = 5
+	// historyPromptLength is how many characters of the prompt are shown in the list.
+	historyPromptLength = 60
+)
+
+// historyEntry is a finished generation with everything needed to repeat it.
+type historyEntry struct {
+	ChatID        int64     `json:"chatId"`
+	Prompt        string    `json:"prompt"`
+	Negative      string    `json:"negative,omitempty"`
+	Photo         string    `json:"photo,omitempty"`
+	Model         string    `json:"model"`
+	Steps         int       `json:"steps"`
+	Width         int       `json:"width"`
+	Height        int       `json:"height"`
+	NumberResults int       `json:"numberResults"`
+	Scheduler     string    `json:"scheduler"`
+	CFGScale      float64   `json:"cfgScale"`
+	Strength      float64   `json:"strength,omitempty"`
+	Seed          int64     `json:"seed"`
+	MessageIDs    []int     `json:"messageIds"`
+	CreatedAt     time.Time `json:"createdAt"`
+	FinishedAt    time.Time `json:"finishedAt"`
+}
+
+// saveHistory records a finished generation and forgets the oldest ones over historyLimit.
+func (b *Bot) saveHistory(j *job, cfg float64, result *generator.Result, sent []tgbotapi.Message) {
+	entry := historyEntry{
+		ChatID:        j.chatID,
+		Prompt:        j.prompt,
+		Negative:      j.negative,
+		Photo:         j.photo,
+		Model:         j.settings.model,
+		Steps:         j.settings.steps,
+		Width:         j.settings.width,
+		Height:        j.settings.heigth,
+		NumberResults: j.settings.numberResults,
+		Scheduler:     j.settings.scheduler,
+		CFGScale:      cfg,
+		Seed:          result.Seed,
+		CreatedAt:     j.createdAt,
+		FinishedAt:    time.Now(),
+	}
+	if j.photo != "" {
+		entry.Strength = j.settings.strength
+	}
+	for _, msg := range sent {
+		entry.MessageIDs = append(entry.MessageIDs, msg.MessageID)
+	}
+	if err := b.store.Put(historyBucket, chatKey(j.chatID, uuid.NewString()), entry); err != nil {
+		j.log.Error("Failed to save history", "err", err)
+		return
+	}
+
+	ids, _ := b.loadHistory(j.chatID)
+	for _, id := range ids[min(len(ids), historyLimit):] {
+		b.store.Delete(historyBucket, chatKey(j.chatID, id))
+	}
+}
+
+// loadHistory returns ids and generations of the chat, the newest first.
+func (b *Bot) loadHistory(chatID int64) ([]string, []historyEntry) {
+	type keyed struct {
+		key   string
+		entry historyEntry
+	}
+	var all []keyed
+	prefix := chatPrefix(chatID)
+	err := b.store.ForEachPrefix(historyBucket, prefix, func(key string, data []byte) error {
+		var entry historyEntry
+		if err := json.Unmarshal(data, &entry); err == nil {
+			all = append(all, keyed{strings.TrimPrefix(key, prefix), entry})
+		}
+		return nil
+	})
+	if err != nil {
+		slog.Error("Failed to load history", "chat_id", chatID, "err", err)
+	}
+	sort.Slice(all, func(i, k int) bool { return all[i].entry.CreatedAt.After(all[k].entry.CreatedAt) })
+
+	keys := make([]string, len(all))
+	entries := make([]historyEntry, len(all))
+	for i, item := range all {
+		keys[i], entries[i] = item.key, item.entry
+	}
+	return keys, entries
+}
+
+// historyPage renders the page of the history with buttons to repeat the generations.
+func (b *Bot) historyPage(chatID int64, page int) (string, *tgbotapi.InlineKeyboardMarkup) {
+	lang := b.getSettings(chatID).language
+	keys, entries := b.loadHistory(chatID)
+	if len(entries) == 0 {
+		return tr(lang, "history.empty"), nil
+	}
+	pages := (len(entries) + historyPageSize - 1) / historyPageSize
+	page = max(0, min(page, pages-1))
+
+	var text strings.Builder
+	text.WriteString(tr(lang, "history.title", page+1, pages))
+	var keyboard [][]tgbotapi.InlineKeyboardButton
+	for i := page * historyPageSize; i < min(len(entries), (page+1)*historyPageSize); i++ {
+		entry := entries[i]
+		model, ok := options().modelName(entry.Model)
+		if !ok {
+			model = entry.Model
+		}
+		prompt := []rune(entry.Prompt)
+		if len(prompt) > historyPromptLength {
+			prompt = append(prompt[:historyPromptLength], '…')
+		}
+		text.WriteString("\n\n")
+		text.WriteString(tr(lang, "history.entry", i+1, string(prompt), model, entry.Width, entry.Height,
+			entry.Steps, entry.Seed, entry.CreatedAt.Format("02.01.2006 15:04")))
+		keyboard = append(keyboard, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(tr(lang, "button.rerun_same", i+1), "hr:s:"+keys[i]),
+			tgbotapi.NewInlineKeyboardButtonData(tr(lang, "button.rerun_current", i+1), "hr:c:"+keys[i]),
+		))
+	}
+
+	var nav []tgbotapi.InlineKeyboardButton
+	if page > 0 {
+		nav = append(nav, tgbotapi.NewInlineKeyboardButtonData(tr(lang, "button.newer"), fmt.Sprintf("hs:%d:", page-1)))
+	}
+	if page < pages-1 {
+		nav = append(nav, tgbotapi.NewInlineKeyboardButtonData(tr(lang, "button.older"), fmt.Sprintf("hs:%d:", page+1)))
+	}
+	if len(nav) > 0 {
+		keyboard = append(keyboard, nav)
+	}
+	markup := tgbotapi.NewInlineKeyboardMarkup(keyboard...)
+	return text.String(), &markup
+}
+
+func handleHistory(b *Bot, chatID int64) {
+	text, markup := b.historyPage(chatID, 0)
+	msg := tgbotapi.NewMessage(chatID, text)
+	if markup != nil {
+		msg.ReplyMarkup = markup
+	}
+	b.tg.Send(msg)
+}
+
+// handleHistoryPage shows another page in the same message.
+func handleHistoryPage(b *Bot, chatID int64, messageID int, pageArg string) string {
+	page, err := strconv.Atoi(pageArg)
+	if err != nil {
+		return b.text(chatID, "button.unknown")
+	}
+	text, markup := b.historyPage(chatID, page)
+	edit := tgbotapi.NewEditMessageText(chatID, messageID, text)
+	edit.ReplyMarkup = markup
+	if _, err := b.tg.Send(edit); err != nil {
+		slog.Warn("Failed to show history page", "chat_id", chatID, "err", err)
+	}
+	return ""
+}
+
+// handleRerun repeats a generation from the history. mode is "s" for the same parameters
+// and seed, "c" for the same prompt with the current settings of the user.
+func handleRerun(b *Bot, chatID int64, mode, key string) string {
+	var entry historyEntry
+	found, err := b.store.Get(historyBucket, chatKey(chatID, key), &entry)
+	if err != nil || !found || entry.ChatID != chatID {
+		return b.text(chatID, "history.expired")
+	}
+	current := b.getSettings(chatID)
+	settings := *current
+	if mode == "s" {
+		settings.model = entry.Model
+		settings.steps = entry.Steps
+		settings.width = entry.Width
+		settings.heigth = entry.Height
+		settings.numberResults = entry.NumberResults
+		settings.scheduler = entry.Scheduler
+		settings.cfgScale = entry.CFGScale
+		settings.seed = entry.Seed
+		settings.negativePrompt = entry.Negative
+		if entry.Strength > 0 {
+			settings.strength = entry.Strength
+		}
+	}
+	b.submitJob(chatID, &settings, entry.Prompt, entry.Photo)
+	return b.text(chatID, "history.rerun")
+}
@@ -0,0 +1,123 @@
+package tgBot
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/MTUCI-Pixel-Team/Picture_Generator/generator"
+	"github.com/MTUCI-Pixel-Team/Picture_Generator/storage"
+)
+
+func historyJob(b *Bot, chatID int64, prompt string, createdAt time.Time) *job {
+	j := b.queue.newJob(b.ctx, jobGenerate, chatID)
+	j.prompt = prompt
+	j.settings = *b.getSettings(chatID)
+	j.createdAt = createdAt
+	return j
+}
+
+func TestSaveHistoryKeepsLimit(t *testing.T) {
+	b, _ := newJobBot(t, storage.NewMemoryStore())
+	start := time.Now().Add(-time.Hour)
+	b.saveHistory(historyJob(b, 2, "other chat", start), 7, &generator.Result{}, nil)
+	for i := range historyLimit + 3 {
+		j := historyJob(b, 1, fmt.Sprintf("prompt %d", i), start.Add(time.Duration(i)*time.Second))
+		b.saveHistory(j, 7, &generator.Result{Seed: int64(i)}, nil)
+	}
+
+	_, history := b.loadHistory(1)
+	if len(history) != historyLimit {
+		t.Fatalf("%d entries kept, want %d", len(history), historyLimit)
+	}
+	// Удаляются самые старые записи
+	if newest, oldest := history[0].Prompt, history[len(history)-1].Prompt; newest != fmt.Sprintf("prompt %d", historyLimit+2) || oldest != "prompt 3" {
+		t.Errorf("kept from %q to %q", oldest, newest)
+	}
+	if _, other := b.loadHistory(2); len(other) != 1 {
+		t.Errorf("history of another chat has %d entries", len(other))
+	}
+}
+
+func TestLoadHistoryOrder(t *testing.T) {
+	b, _ := newJobBot(t, storage.NewMemoryStore())
+	start := time.Now().Add(-time.Hour)
+	// Порядок ключей не совпадает с порядком времени, сортировать должен CreatedAt
+	saved := []struct {
+		key    string
+		minute int
+	}{{"c", 2}, {"a", 3}, {"d", 0}, {"b", 1}}
+	for _, s := range saved {
+		entry := historyEntry{ChatID: 1, Prompt: s.key, CreatedAt: start.Add(time.Duration(s.minute) * time.Minute)}
+		if err := b.store.Put(historyBucket, chatKey(1, s.key), entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	keys, history := b.loadHistory(1)
+	want := []string{"a", "c", "b", "d"}
+	if fmt.Sprint(keys) != fmt.Sprint(want) {
+		t.Fatalf("keys %v, want %v", keys, want)
+	}
+	for i, entry := range history {
+		if entry.Prompt != keys[i] {
+			t.Errorf("entry %d is %q under the key %q", i, entry.Prompt, keys[i])
+		}
+	}
+}
+
+func TestHandleRerun(t *testing.T) {
+	entry := historyEntry{
+		ChatID: 1, Prompt: "a cat on a sofa", Negative: "blurry", Model: "runware:100@1",
+		Steps: 30, Width: 768, Height: 512, NumberResults: 2, Scheduler: "Euler", CFGScale: 9, Seed: 42,
+		CreatedAt: time.Now(),
+	}
+	foreign := entry
+	foreign.ChatID = 2
+
+	tests := []struct {
+		name   string
+		id     string
+		mode   string
+		answer string
+		seed   int64
+	}{
+		{"same parameters", "own", "s", "history.rerun", 42},
+		{"current settings", "own", "c", "history.rerun", 0},
+		{"missing entry", "missing", "s", "history.expired", 0},
+		{"entry of another chat", "foreign", "s", "history.expired", 0},
+		{"entry of another chat under the key of this one", "moved", "s", "history.expired", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, _ := newJobBot(t, storage.NewMemoryStore())
+			b.store.Put(historyBucket, chatKey(1, "own"), entry)
+			b.store.Put(historyBucket, chatKey(2, "foreign"), foreign)
+			b.store.Put(historyBucket, chatKey(1, "moved"), foreign)
+
+			if answer := handleRerun(b, 1, tt.mode, tt.id); answer != tr("", tt.answer) {
+				t.Fatalf("answer %q, want %q", answer, tr("", tt.answer))
+			}
+			if tt.answer != "history.rerun" {
+				if pending, _ := b.queue.depth(); pending != 0 {
+					t.Errorf("%d jobs queued", pending)
+				}
+				return
+			}
+			if len(b.queue.pending) != 1 {
+				t.Fatalf("%d jobs queued", len(b.queue.pending))
+			}
+			j := b.queue.pending[0]
+			if j.prompt != entry.Prompt || j.settings.seed != tt.seed {
+				t.Errorf("queued %q with seed %d", j.prompt, j.settings.seed)
+			}
+			if tt.mode == "s" && (j.negative != entry.Negative || j.settings.model != entry.Model || j.settings.width != entry.Width ||
+				j.settings.numberResults != entry.NumberResults || j.settings.cfgScale != entry.CFGScale) {
+				t.Errorf("parameters of the entry are not restored: %+v", j.settings)
+			}
+			if tt.mode == "c" && j.settings.model != b.getSettings(1).model {
+				t.Errorf("model %q instead of the current one", j.settings.model)
+			}
+		})
+	}
+}
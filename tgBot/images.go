@@ -0,0 +1,338 @@
+package tgBot
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MTUCI-Pixel-Team/Picture_Generator/generator"
+	"github.com/google/uuid"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	imagesBucket = "images"
+	// imageRetention is how long buttons under a picture keep working.
+	imageRetention = 7 * 24 * time.Hour
+	// pruneInterval is how often records past their retention are deleted while the bot runs.
+	pruneInterval = time.Hour
+)
+
+var upscaleFactors = []int{2, 4}
+
+// storedImage remembers a picture sent to the chat, so it can be processed later from a button.
+type storedImage struct {
+	ChatID int64 `json:"chatId"`
+	// ProviderUUID is the imageUUID kept by the provider, empty if the provider can't reuse it.
+	ProviderUUID string    `json:"providerUUID,omitempty"`
+	FileID       string    `json:"fileId"`
+	Seed         int64     `json:"seed,omitempty"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// saveImage stores the picture and returns its id for callback data.
+func (b *Bot) saveImage(img storedImage) (string, error) {
+	id := uuid.NewString()
+	if err := b.store.Put(imagesBucket, chatKey(img.ChatID, id), img); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+func (b *Bot) loadImage(chatID int64, id string) (storedImage, bool) {
+	var img storedImage
+	found, err := b.store.Get(imagesBucket, chatKey(chatID, id), &img)
+	if err != nil {
+		slog.Error("Failed to load image", "chat_id", chatID, "id", id, "err", err)
+		return img, false
+	}
+	return img, found && time.Since(img.CreatedAt) < imageRetention
+}
+
+// chatKey puts the chat id in front of the id of a record, so the records of a chat are read by prefix.
+func chatKey(chatID int64, id string) string {
+	return chatPrefix(chatID) + id
+}
+
+func chatPrefix(chatID int64) string {
+	return strconv.FormatInt(chatID, 10) + ":"
+}
+
+// migrateChatKeys moves records saved before the keys got the chat prefix. The id is kept,
+// so buttons under old messages still work.
+func (b *Bot) migrateChatKeys(bucket string) error {
+	type legacy struct {
+		key    string
+		chatID int64
+		data   json.RawMessage
+	}
+	var records []legacy
+	err := b.store.ForEach(bucket, func(key string, data []byte) error {
+		if strings.Contains(key, ":") {
+			return nil
+		}
+		var record struct {
+			ChatID int64 `json:"chatId"`
+		}
+		if err := json.Unmarshal(data, &record); err != nil {
+			return nil
+		}
+		records = append(records, legacy{key, record.ChatID, append(json.RawMessage(nil), data...)})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		if err := b.store.Put(bucket, chatKey(record.chatID, record.key), record.data); err != nil {
+			return err
+		}
+		if err := b.store.Delete(bucket, record.key); err != nil {
+			return err
+		}
+	}
+	if len(records) > 0 {
+		slog.Info("Records moved to chat keys", "bucket", bucket, "count", len(records))
+	}
+	return nil
+}
+
+// pruneBucket deletes records whose createdAt is older than retention.
+func (b *Bot) pruneBucket(bucket string, retention time.Duration) {
+	var expired []string
+	err := b.store.ForEach(bucket, func(key string, data []byte) error {
+		var record struct {
+			CreatedAt time.Time `json:"createdAt"`
+		}
+		if err := json.Unmarshal(data, &record); err != nil || time.Since(record.CreatedAt) >= retention {
+			expired = append(expired, key)
+		}
+		return nil
+	})
+	if err != nil {
+		slog.Error("Failed to prune", "bucket", bucket, "err", err)
+		return
+	}
+	for _, key := range expired {
+		b.store.Delete(bucket, key)
+	}
+	if len(expired) > 0 {
+		slog.Info("Pruned old records", "bucket", bucket, "count", len(expired))
+	}
+}
+
+// pruneAll deletes old records of every bucket that has a retention.
+func (b *Bot) pruneAll() {
+	b.pruneBucket(imagesBucket, imageRetention)
+	b.pruneBucket(promptsBucket, promptRetention)
+	b.pruneBucket(statsBucket, statsRetention)
+	b.pruneBucket(moderationAuditBucket, moderationAuditRetention)
+}
+
+// pruneLoop prunes the buckets every pruneInterval until Shutdown, so a bot that stays up
+// doesn't keep records past their retention.
+func (b *Bot) pruneLoop() {
+	ticker := time.NewTicker(pruneInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			b.pruneAll()
+		case <-b.ctx.Done():
+			return
+		}
+	}
+}
+
+// sendImageActions remembers sent pictures and shows buttons to process them.
+func (b *Bot) sendImageActions(chatID int64, lang string, sent []tgbotapi.Message, images []generator.Image) {
+	var keys []string
+	for i, msg := range sent {
+		if len(msg.Photo) == 0 || i >= len(images) {
+			continue
+		}
+		key, err := b.saveImage(storedImage{
+			ChatID:       chatID,
+			ProviderUUID: images[i].UUID,
+			FileID:       largestPhoto(msg.Photo).FileID,
+			Seed:         images[i].Seed,
+			CreatedAt:    time.Now(),
+		})
+		if err != nil {
+			slog.Error("Failed to save image", "chat_id", chatID, "err", err)
+			return
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return
+	}
+	msg := tgbotapi.NewMessage(chatID, tr(lang, "images.actions"))
+	msg.ReplyMarkup = getImageActionsMarkup(lang, keys)
+	if _, err := b.tg.Send(msg); err != nil {
+		slog.Error("Failed to send image actions", "chat_id", chatID, "err", err)
+	}
+}
+
+// handleCallback processes buttons of inline keyboards. Callback data looks like "action:argument:key".
+func handleCallback(b *Bot, query *tgbotapi.CallbackQuery) {
+	if query.Message == nil {
+		return
+	}
+	chatID := query.Message.Chat.ID
+	slog.Debug("Button pressed", "chat_id", chatID, "user", query.From.UserName, "data", query.Data)
+
+	parts := strings.Split(query.Data, ":")
+	answer := ""
+	switch {
+	case len(parts) == 3 && parts[0] == "up":
+		answer = handleUpscale(b, chatID, parts[1], parts[2])
+	case len(parts) == 3 && parts[0] == "bg":
+		answer = handleRemoveBackgroundButton(b, chatID, parts[2])
+	case len(parts) == 3 && parts[0] == "ds":
+		answer = handleGenerateFromDescription(b, chatID, parts[2])
+	case len(parts) == 3 && parts[0] == "st":
+		answer = handleSettingsButton(b, chatID, query.Message.MessageID, parts[1])
+	case len(parts) == 4 && parts[0] == "sv":
+		answer = handleSettingsValue(b, chatID, query.Message.MessageID, parts[1], parts[2], parts[3])
+	case len(parts) == 3 && parts[0] == "hs":
+		answer = handleHistoryPage(b, chatID, query.Message.MessageID, parts[1])
+	case len(parts) == 3 && parts[0] == "hr":
+		answer = handleRerun(b, chatID, parts[1], parts[2])
+	case len(parts) == 3 && parts[0] == "en":
+		answer = handleEnhanceChoice(b, chatID, query.Message.MessageID, parts[1], parts[2])
+	default:
+		answer = b.text(chatID, "button.unknown")
+	}
+	if _, err := b.tg.Request(tgbotapi.NewCallback(query.ID, answer)); err != nil {
+		slog.Warn("Failed to answer callback", "chat_id", chatID, "err", err)
+	}
+}
+
+func handleUpscale(b *Bot, chatID int64, factorArg, key string) string {
+	factor, err := strconv.Atoi(factorArg)
+	if err != nil {
+		return b.text(chatID, "button.unknown")
+	}
+	img, ok := b.loadImage(chatID, key)
+	if !ok || img.ChatID != chatID {
+		return b.text(chatID, "images.expired")
+	}
+	j := b.queue.newJob(b.ctx, jobUpscale, chatID)
+	j.image = img
+	j.factor = factor
+	j.statusText = b.text(chatID, "upscale.status", factor)
+	b.enqueue(j)
+	return b.text(chatID, "button.upscale", factor)
+}
+
+func handleRemoveBackgroundButton(b *Bot, chatID int64, key string) string {
+	img, ok := b.loadImage(chatID, key)
+	if !ok || img.ChatID != chatID {
+		return b.text(chatID, "images.expired")
+	}
+	b.submitRemoveBackground(chatID, img)
+	return b.text(chatID, "button.remove_bg")
+}
+
+func (b *Bot) submitRemoveBackground(chatID int64, img storedImage) {
+	j := b.queue.newJob(b.ctx, jobRemoveBackground, chatID)
+	j.image = img
+	j.statusText = b.text(chatID, "remove_bg.status")
+	b.enqueue(j)
+}
+
+// findImage looks for a picture sent by the bot, so its original can be taken from the provider.
+// Pictures that are not found are downloaded from Telegram.
+func (b *Bot) findImage(chatID int64, photo tgbotapi.PhotoSize) storedImage {
+	found := storedImage{ChatID: chatID, FileID: photo.FileID, CreatedAt: time.Now()}
+	b.store.ForEachPrefix(imagesBucket, chatPrefix(chatID), func(key string, data []byte) error {
+		var img storedImage
+		if err := json.Unmarshal(data, &img); err == nil && img.FileID == photo.FileID {
+			found = img
+		}
+		return nil
+	})
+	return found
+}
+
+// inputImage gives the generator the provider's copy of the picture or downloads it from Telegram.
+func (b *Bot) inputImage(j *job) (generator.InputImage, error) {
+	if j.image.ProviderUUID != "" {
+		return generator.InputImage{UUID: j.image.ProviderUUID}, nil
+	}
+	data, err := b.downloadTelegramFile(j.ctx, j.image.FileID)
+	if err != nil {
+		return generator.InputImage{}, err
+	}
+	return generator.InputImage{Bytes: data}, nil
+}
+
+// runUpscale upscales a stored picture and sends it as a document to keep the full resolution.
+func (b *Bot) runUpscale(j *job) error {
+	return b.runImageJob(j, fmt.Sprintf("upscaled_x%d", j.factor), tr(j.lang, "upscale.error"),
+		func(input generator.InputImage) (*generator.Image, error) {
+			return b.generator.Upscale(j.ctx, generator.UpscaleRequest{UserID: j.chatID, Image: input, Factor: j.factor})
+		})
+}
+
+func (b *Bot) runRemoveBackground(j *job) error {
+	return b.runImageJob(j, "no_background", tr(j.lang, "remove_bg.error"),
+		func(input generator.InputImage) (*generator.Image, error) {
+			return b.generator.RemoveBackground(j.ctx, generator.RemoveBackgroundRequest{UserID: j.chatID, Image: input})
+		})
+}
+
+// runImageJob processes the picture of the job and sends the result as a document called name.
+func (b *Bot) runImageJob(j *job, name, errorText string, process func(generator.InputImage) (*generator.Image, error)) error {
+	input, err := b.inputImage(j)
+	if err == nil {
+		var img *generator.Image
+		if img, err = process(input); err == nil {
+			err = b.sendDocument(j, img, name)
+		}
+	}
+	if j.ctx.Err() != nil {
+		j.log.Info("Job cancelled")
+		return j.ctx.Err()
+	}
+	if err != nil {
+		j.log.Error("Image processing failed", "err", err, "class", errorClass(err))
+		b.tg.Send(tgbotapi.NewMessage(j.chatID, errorText))
+		return err
+	}
+	j.log.Info("Image processed", "duration", time.Since(j.createdAt))
+	return nil
+}
+
+// sendDocument sends the picture as a file, so Telegram neither compresses it nor drops transparency.
+func (b *Bot) sendDocument(j *job, img *generator.Image, name string) error {
+	data := img.Bytes
+	if len(data) == 0 {
+		var err error
+		if data, err = downloadImage(j.ctx, img.URL); err != nil {
+			return err
+		}
+	}
+	if err := j.ctx.Err(); err != nil {
+		return err
+	}
+	doc := tgbotapi.NewDocument(j.chatID, tgbotapi.FileBytes{Name: name + imageExtension(data), Bytes: data})
+	_, err := b.tg.Send(doc)
+	return err
+}
+
+func imageExtension(data []byte) string {
+	switch http.DetectContentType(data) {
+	case "image/png":
+		return ".png"
+	case "image/webp":
+		return ".webp"
+	}
+	return ".jpg"
+}
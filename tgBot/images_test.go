@@ -0,0 +1,118 @@
+package tgBot
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"testing"
+	"time"
+
+	"github.com/MTUCI-Pixel-Team/Picture_Generator/storage"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestMigrateChatKeys(t *testing.T) {
+	b := &Bot{store: storage.NewMemoryStore()}
+	now := time.Now()
+	b.store.Put(imagesBucket, "old-id", storedImage{ChatID: 12, FileID: "old", CreatedAt: now})
+	b.store.Put(imagesBucket, chatKey(12, "new-id"), storedImage{ChatID: 12, FileID: "new", CreatedAt: now})
+	b.store.Put(imagesBucket, "other-id", storedImage{ChatID: 1, FileID: "other", CreatedAt: now})
+
+	if err := b.migrateChatKeys(imagesBucket); err != nil {
+		t.Fatal(err)
+	}
+	// Кнопки под старыми сообщениями передают тот же id
+	for _, tt := range []struct {
+		chatID int64
+		id     string
+		fileID string
+	}{{12, "old-id", "old"}, {12, "new-id", "new"}, {1, "other-id", "other"}} {
+		if img, ok := b.loadImage(tt.chatID, tt.id); !ok || img.FileID != tt.fileID {
+			t.Errorf("image %s of chat %d: %+v, found %v", tt.id, tt.chatID, img, ok)
+		}
+	}
+	if found, _ := b.store.Get(imagesBucket, "old-id", &storedImage{}); found {
+		t.Error("record under the old key is kept")
+	}
+	if _, ok := b.loadImage(1, "old-id"); ok {
+		t.Error("image is found by another chat")
+	}
+}
+
+// sentImage decodes the document sent under the name.
+func sentImage(t *testing.T, client *recordingTelegram, name string) image.Image {
+	data, ok := client.sentDocuments()[name]
+	if !ok {
+		t.Fatalf("no document %q, messages %q", name, client.sentTexts())
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return img
+}
+
+// limitQuota turns the quota on, so the jobs of the test are charged.
+func limitQuota(t *testing.T, b *Bot) {
+	b.cfg.Quota = QuotaConfig{Tiers: map[string]QuotaLimits{"free": {Credits: 100}}}
+	if err := b.cfg.Quota.setDefaults(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func chargedCredits(b *Bot, chatID int64) (credits, images int) {
+	b.quotaMu.Lock()
+	defer b.quotaMu.Unlock()
+	record := b.loadQuota(chatID)
+	return record.Credits, record.Images
+}
+
+func TestUpscaleFlow(t *testing.T) {
+	serveTelegramFiles(t, map[string][]byte{"photo": testPNG(t, 40, 20)})
+	b, client := newJobBot(t, storage.NewMemoryStore())
+	limitQuota(t, b)
+	key, err := b.saveImage(storedImage{ChatID: 1, FileID: "photo", CreatedAt: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if answer := handleUpscale(b, 2, "2", key); answer != tr("", "images.expired") {
+		t.Errorf("another chat upscaled the picture: %q", answer)
+	}
+	handleCallback(b, &tgbotapi.CallbackQuery{
+		ID: "1", From: &tgbotapi.User{ID: 1}, Data: "up:2:" + key,
+		Message: &tgbotapi.Message{MessageID: 5, Chat: &tgbotapi.Chat{ID: 1}},
+	})
+	runQueued(b)
+
+	if size := sentImage(t, client, "upscaled_x2.png").Bounds().Size(); size != image.Pt(80, 40) {
+		t.Errorf("upscaled to %v", size)
+	}
+	if credits, images := chargedCredits(b, 1); credits != 2 || images != 1 {
+		t.Errorf("charged %d credits and %d images, want the factor and one picture", credits, images)
+	}
+}
+
+func TestRemoveBackgroundFlow(t *testing.T) {
+	serveTelegramFiles(t, map[string][]byte{"photo": testPNG(t, 40, 20)})
+	b, client := newJobBot(t, storage.NewMemoryStore())
+	limitQuota(t, b)
+	photo := &tgbotapi.Message{Photo: []tgbotapi.PhotoSize{
+		{FileID: "thumb", Width: 4, Height: 2},
+		{FileID: "photo", Width: 40, Height: 20},
+	}}
+	handleRemoveBackground(b, &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: 1}, ReplyToMessage: photo}, 1)
+	runQueued(b)
+
+	img := sentImage(t, client, "no_background.png")
+	// Фон по цвету угла становится прозрачным, красный квадрат остаётся
+	if _, _, _, a := img.At(0, 0).RGBA(); a != 0 {
+		t.Errorf("background alpha %d", a)
+	}
+	if r, g, _, a := img.At(20, 10).RGBA(); a != 0xffff || r != 0xffff || g != 0 {
+		t.Errorf("subject is %v", img.At(20, 10))
+	}
+	if credits, images := chargedCredits(b, 1); credits != taskCredits || images != 1 {
+		t.Errorf("charged %d credits and %d images", credits, images)
+	}
+}
@@ -0,0 +1,580 @@
+package tgBot
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+const defaultLanguage = "en"
+
+// languages are shown on the /language keyboard in this order.
+var languages = []struct {
+	code string
+	name string
+}{
+	{"en", "English"},
+	{"ru", "Русский"},
+}
+
+// messages holds the texts of the bot by language and key. A text missing in a language is taken from English.
+var messages = map[string]map[string]string{
+	"en": {
+		"start": "Hello! I'm a bot that can generate a picture for you. Just send me a message with a description of the picture you want to get. Description must be in English and be longer than 2 characters.",
+		"help": "Available commands: \n" +
+			"/start - restart the bot \n" +
+			"/help - get help \n" +
+			"/settings - all your settings in one message\n" +
+			"/models - list of all models for generate \n" +
+			"/steps - More steps - better, but longer generation\n" +
+			"/size - select size of the returned image\n" +
+			"/number_result - select the number of generated images\n" +
+			"/schedulers - select the prototype of generation\n" +
+			"/negative - what you don't want to see in the picture\n" +
+			"/seed - fix the seed to get the same picture again\n" +
+			"/cfg - how strictly the picture follows the description\n" +
+			"/strength - how much a sent photo is changed\n" +
+			"/remove_bg - cut out an object from a photo or a generated picture\n" +
+			"/enhance - turn on or off improving short descriptions before generation\n" +
+			"/describe - get a description of a photo to generate something like it\n" +
+			"/history - your last pictures, to generate them again\n" +
+			"/preset - save and load named sets of settings\n" +
+			"/language - change the language of the bot\n" +
+			"/balance - your daily limits and what a generation costs\n" +
+			"/cancel - back to the start menu \n\n" +
+			"To generate a message, enter a description here. " +
+			"Add \"||\" and a negative prompt after it to override the default one for a single picture, e.g. \"cat on a sofa || blurry, watermark\". " +
+			"Send a photo with a description to change the photo.",
+		"power_off.wait":   "Please, wait. Your profile restored to default settings.",
+		"power_off.done":   "Please wait 2 minutes. Your profile restored to default settings.",
+		"prompt.too_short": "Description must be longer than 2 characters.",
+		"prompt.expired":   "This description is no longer available",
+		"photo.expected":   "Please send a photo or type /cancel.",
+
+		"button.default":         "default",
+		"button.none":            "none",
+		"button.random":          "random",
+		"button.unknown":         "Unknown button",
+		"button.upscale":         "Upscale x%d",
+		"button.upscale_short":   "#%d x%d",
+		"button.remove_bg":       "Remove background",
+		"button.remove_bg_short": "#%d no bg",
+		"button.use_improved":    "Use improved",
+		"button.use_original":    "Use original",
+		"button.describe":        "Generate from this",
+
+		"invalid.choose_number": "Invalid input. Please choose a number from keyboard:",
+		"invalid.number":        "Invalid input. Please enter a number from keyboard.",
+		"invalid.model":         "Invalid input. Please enter a model from keyboard.",
+		"invalid.size":          "Invalid input. Please enter a size from keyboard.",
+		"invalid.scheduler":     "Invalid input. Please enter a scheduler from keyboard.",
+
+		"steps.current":          `Your current settings steps: "%d" Please choose one from keyboard. Type /cancel if you want to return to the start menu `,
+		"steps.set":              "Steps set to: %d",
+		"cfg.current":            `Your current CFG scale: "%s" Higher values follow the description more strictly. Please choose one from keyboard. Type /cancel if you want to return to the start menu `,
+		"cfg.current_default":    "default (%s for your model)",
+		"cfg.set_default":        "CFG scale set to model default: %s",
+		"cfg.set":                "CFG scale set to: %s",
+		"number_results.current": `Your current settings number results: "%d" Please choose one from keyboard. Type /cancel if you want to return to the start menu `,
+		"number_results.set":     "Number results set to: %d",
+		"models.current":         `Your model: "%s" Please choose one from keyboard. Type /cancel if you want to return to the start menu`,
+		"models.set":             "Model set to: %s",
+		"size.current":           `Your size: "%s" Please choose one from keyboard. Type /cancel if you want to return to the start menu`,
+		"size.set":               "Size set to: %s",
+		"schedulers.current":     `Your scheduler: "%s" Please choose one from keyboard. Type /cancel if you want to return to the start menu`,
+		"schedulers.set":         "Scheduler set to: %s",
+		"negative.current":       `Your negative prompt: "%s" Send what you don't want to see in the picture or choose "%s" to clear it. Type /cancel if you want to return to the start menu`,
+		"negative.invalid":       "Invalid input. Please send a text or type /cancel.",
+		"negative.too_long":      "Negative prompt must be shorter than %d characters.",
+		"negative.set":           "Negative prompt set to: %s",
+		"negative.cleared":       "Negative prompt cleared",
+		"seed.current":           `Your seed: "%s" Send a number to get the same picture for the same prompt or choose "%s". Type /cancel if you want to return to the start menu`,
+		"seed.invalid":           `Invalid input. Please send a positive number or "%s".`,
+		"seed.set":               "Seed set to: %s",
+		"strength.current":       `Your current strength: "%s" It is used when you send a photo: lower values keep more of the photo. Please choose one from keyboard. Type /cancel if you want to return to the start menu `,
+		"strength.set":           "Strength set to: %s",
+		"language.current":       `Your language: "%s" Please choose one from keyboard. Type /cancel if you want to return to the start menu`,
+		"language.set":           "Language set to: %s",
+		"language.invalid":       "Invalid input. Please choose a language from keyboard.",
+
+		"photo.finish_menu":     "Please finish choosing from the menu first. Type /cancel if you want to return to the start menu",
+		"photo.ask_prompt":      "Got the photo. Now send a description of what it should become. Type /cancel if you want to return to the start menu",
+		"photo.prompt_expected": "Please send a description of the picture or type /cancel.",
+		"photo.prompt_accepted": "Description accepted.",
+		"photo.load_failed":     "Failed to load your photo. Please send it again.",
+
+		"enhance.usage":    "Invalid input. Use /enhance, /enhance on or /enhance off.",
+		"enhance.off":      "Prompt enhancer is off. Descriptions are used as they are.",
+		"enhance.on":       "Prompt enhancer is on. Short descriptions will be expanded before generation, and you can choose which one to use.",
+		"enhance.status":   "Improving the description, please wait...",
+		"enhance.failed":   "Failed to improve the description. You can generate the picture with the original one.",
+		"enhance.result":   "Improved description:\n\n%s\n\nOriginal: %s",
+		"enhance.original": "Using the original description",
+		"enhance.improved": "Using the improved description",
+
+		"describe.ask":        "Send a photo to describe or reply with /describe to a picture. Type /cancel if you want to return to the start menu",
+		"describe.status":     "Describing the picture, please wait...",
+		"describe.error":      "Error occurred while describing the picture. Please try again later.",
+		"describe.result":     "Description:\n\n%s",
+		"describe.generating": "Generating from the description",
+
+		"queue.user_limit": "You already have %d pictures in progress. Please wait until one of them is ready.",
+		"queue.full":       "The bot is overloaded right now, your request was not accepted. Please try again in a few minutes.",
+		"queue.position":   "Your request is in the queue, position: %d. %s",
+		"maintenance":      "The bot is restarting for maintenance. Please send your request again in a few minutes.",
+
+		"generation.status":      "Generating a picture, please wait...",
+		"generation.error":       "Error occurred while generating a picture. Please try again or change your settings.",
+		"generation.load_failed": "Failed to load the picture. Please try again.",
+		"generation.send_failed": "Failed to send the pictures. Please try again.",
+		"generation.seed":        "Seed: %d",
+
+		"settings.title":          "Your settings:",
+		"settings.hint":           "Tap a button to change a setting.",
+		"settings.outdated":       "The options have changed, choose again.",
+		"settings.choose":         "%s (now: %s). Choose a new value:",
+		"settings.updated":        "%s: %s",
+		"settings.model":          "Model",
+		"settings.steps":          "Steps",
+		"settings.size":           "Size",
+		"settings.scheduler":      "Scheduler",
+		"settings.number_results": "Number of pictures",
+		"settings.cfg":            "CFG scale",
+		"settings.strength":       "Strength",
+		"settings.seed":           "Seed",
+		"settings.negative":       "Negative prompt",
+		"settings.enhance":        "Prompt enhancer",
+		"settings.language":       "Language",
+		"button.back":             "« Back",
+		"option.on":               "on",
+		"option.off":              "off",
+
+		"preset.usage":        "Use /preset save <name>, /preset load <name>, /preset list or /preset delete <name>.",
+		"preset.invalid_name": "Preset name must be from 1 to %d characters and must not start with \"/\".",
+		"preset.limit":        "You can keep up to %d presets. Delete one with /preset delete <name>.",
+		"preset.error":        "Failed to save or load the preset. Please try again later.",
+		"preset.saved":        "Preset \"%s\" saved. Load it with /preset load %[1]s",
+		"preset.loaded":       "Preset \"%s\" loaded.",
+		"preset.deleted":      "Preset \"%s\" deleted.",
+		"preset.not_found":    "There is no preset \"%s\".",
+		"preset.empty":        "You have no presets. Save the current settings with /preset save <name>.",
+		"preset.list":         "Your presets, choose one to load or type /cancel:",
+		"preset.item":         "• %s: %s, %dx%d, %d steps",
+
+		"history.empty":   "You have no generations yet.",
+		"history.title":   "Your generations, page %d of %d:",
+		"history.entry":   "%d. %s\n%s, %dx%d, %d steps, seed %d, %s",
+		"history.expired": "This generation is no longer in the history",
+		"history.rerun":   "Generating again",
+
+		"button.rerun_same":    "#%d again",
+		"button.rerun_current": "#%d with my settings",
+		"button.newer":         "« Newer",
+		"button.older":         "Older »",
+
+		"images.actions":   "What to do with the pictures?",
+		"images.expired":   "This picture is no longer available",
+		"upscale.status":   "Upscaling the picture x%d, please wait...",
+		"upscale.error":    "Error occurred while upscaling the picture. Please try again later.",
+		"remove_bg.ask":    "Send a photo to remove its background or reply with /remove_bg to a generated picture. Type /cancel if you want to return to the start menu",
+		"remove_bg.status": "Removing the background, please wait...",
+		"remove_bg.error":  "Error occurred while removing the background. Please try again later.",
+		"cancel.cancelled": "Cancelled generations: %d",
+		"cancel.menu":      "Returned to the start menu.",
+		"cancel.nothing":   "Nothing to cancel.",
+		"admin.only":       "This command is only for administrators.",
+		"catalog.reloaded": "Catalog reloaded.",
+		"catalog.failed":   "Catalog is not reloaded, the old one is kept:\n%v",
+		"ban.usage":        "Usage: /ban <chat id> or /unban <chat id>",
+		"ban.admin":        "Administrators can't be banned.",
+		"ban.done":         "Chat %d is banned.",
+		"ban.already":      "Chat %d is already banned.",
+		"ban.removed":      "Chat %d is unbanned.",
+		"ban.not_banned":   "Chat %d is not banned.",
+		"ban.error":        "Failed to save the ban list, try again.",
+		"banned":           "Sorry, you are not allowed to use this bot.",
+		"broadcast.usage":  "Usage: /broadcast <text>",
+		"broadcast.busy":   "Another broadcast is in progress, wait until it is finished.",
+		"broadcast.start":  "Sending the message to %d chats…",
+		"broadcast.done":   "Broadcast finished: delivered %d, failed %d.",
+		"stats.text": "Statistics\n" +
+			"Known users: %d, banned: %d\n" +
+			"Active today: %d, for 7 days: %d\n" +
+			"Jobs today: %d, failed: %d\n" +
+			"Jobs for 7 days: %d, failed: %d\n" +
+			"Queue: %d waiting, %d running",
+		"stats.top_models": "Top models for 7 days:",
+		"stats.model":      "%d. %s — %d",
+		"quota.exceeded": "Daily limit reached. This job costs %d credits for %d pictures, you have %s credits and %s pictures left. " +
+			"Limits reset at %s. Fewer pictures, a smaller size or fewer steps cost less.",
+		"quota.balance":         "Tier: %s\nPictures today: %s\nCredits today: %s\nA generation with your settings costs %d credits.\nLimits reset at %s.",
+		"quota.no_limits":       "You have no daily limits. A generation with your settings costs %d credits.",
+		"quota.task_prices":     "Upscaling costs as many credits as its factor, removing a background, enhancing and describing cost %d.",
+		"quota.usage":           "%d of %d",
+		"quota.usage_unlimited": "%d, no limit",
+		"quota.unlimited":       "unlimited",
+		"quota.tier_usage":      "Usage: /tier <chat id> <tier>. Tiers: %s",
+		"quota.tier_unknown":    "Unknown tier %s. Tiers: %s",
+		"quota.tier_set":        "Chat %d is moved to tier %s.",
+		"moderation.blocked":    "Sorry, this description can't be used: “%s” is not allowed here. Please rephrase it and send again.",
+		"moderation.usage": "Usage:\n" +
+			"/moderation list [language] - show the blocklists\n" +
+			"/moderation add <language> [strict] <word or phrase> - block a word\n" +
+			"/moderation regex <language> [strict] <expression> - block a regular expression\n" +
+			"/moderation remove <language> <number or pattern> - remove a rule\n" +
+			"/moderation level <chat id> <off|normal|strict|default> - strictness of a chat, the default is %s\n" +
+			"/moderation log [count] - latest blocked prompts\n" +
+			"Strict rules apply only to chats with the strict level.",
+		"moderation.list_title":   "Blocklist %s, rules: %d",
+		"moderation.list_empty":   "There are no blocklists.",
+		"moderation.strict_mark":  " (strict)",
+		"moderation.invalid_rule": "The rule is not added: %v",
+		"moderation.exists":       "%s is already in the blocklist %s.",
+		"moderation.added":        "%s is added to the blocklist %s.",
+		"moderation.not_found":    "%s is not found in the blocklist %s.",
+		"moderation.removed":      "%s is removed from the blocklist %s.",
+		"moderation.error":        "Failed to save the change, try again.",
+		"moderation.level_set":    "Moderation level of chat %d: %s.",
+		"moderation.log_empty":    "No prompts were blocked.",
+		"moderation.log_title":    "Latest blocked prompts: %d",
+		"moderation.log_entry":    "%s, chat %d, level %s\nRule %s: %s\n%s",
+
+		"menu.start":          "Start",
+		"menu.help":           "Help",
+		"menu.models":         "Models",
+		"menu.steps":          "Steps",
+		"menu.size":           "Size",
+		"menu.number_results": "Number of pictures",
+		"menu.schedulers":     "Schedulers",
+		"menu.power_off":      "Reset settings",
+		"menu.language":       "Language",
+
+		"command.start":          "Restart the bot",
+		"command.help":           "Get help",
+		"command.settings":       "All your settings in one message",
+		"command.models":         "Choose the model",
+		"command.steps":          "More steps - better, but longer generation",
+		"command.size":           "Choose the size of the picture",
+		"command.number_results": "Choose the number of pictures",
+		"command.schedulers":     "Choose the scheduler",
+		"command.negative":       "What you don't want to see in the picture",
+		"command.seed":           "Fix the seed to get the same picture again",
+		"command.cfg":            "How strictly the picture follows the description",
+		"command.strength":       "How much a sent photo is changed",
+		"command.remove_bg":      "Cut out an object from a picture",
+		"command.enhance":        "Improve short descriptions before generation",
+		"command.describe":       "Describe a photo to generate something like it",
+		"command.history":        "Your last pictures",
+		"command.preset":         "Save and load sets of settings",
+		"command.language":       "Change the language",
+		"command.balance":        "Your daily limits",
+		"command.cancel":         "Cancel your jobs and go back to the start menu",
+		"command.power_off":      "Reset your settings",
+		"command.stats":          "Usage statistics",
+		"command.broadcast":      "Send a message to all users",
+		"command.ban":            "Ban a chat",
+		"command.unban":          "Unban a chat",
+		"command.tier":           "Move a chat to another tier",
+		"command.moderation":     "Manage blocklists and moderation levels",
+		"command.reload_catalog": "Reload the catalog of models and sizes",
+	},
+	"ru": {
+		"start": "Привет! Я бот, который может сгенерировать для вас картинку. Просто отправьте мне сообщение с описанием картинки, которую хотите получить. Описание должно быть на английском языке и длиннее 2 символов.",
+		"help": "Доступные команды: \n" +
+			"/start - перезапустить бота \n" +
+			"/help - получить помощь \n" +
+			"/settings - все ваши настройки в одном сообщении\n" +
+			"/models - список моделей для генерации \n" +
+			"/steps - больше шагов - лучше, но дольше генерация\n" +
+			"/size - выбрать размер картинки\n" +
+			"/number_result - выбрать количество картинок\n" +
+			"/schedulers - выбрать планировщик генерации\n" +
+			"/negative - что вы не хотите видеть на картинке\n" +
+			"/seed - зафиксировать seed, чтобы снова получить ту же картинку\n" +
+			"/cfg - насколько точно картинка следует описанию\n" +
+			"/strength - насколько сильно меняется отправленное фото\n" +
+			"/remove_bg - вырезать объект с фото или сгенерированной картинки\n" +
+			"/enhance - включить или выключить улучшение коротких описаний перед генерацией\n" +
+			"/describe - получить описание фото, чтобы сгенерировать похожее\n" +
+			"/history - ваши последние картинки, чтобы сгенерировать их снова\n" +
+			"/preset - сохранить и загрузить наборы настроек\n" +
+			"/language - сменить язык бота\n" +
+			"/balance - ваши дневные лимиты и стоимость генерации\n" +
+			"/cancel - вернуться в главное меню \n\n" +
+			"Чтобы сгенерировать картинку, отправьте сюда описание. " +
+			"Добавьте \"||\" и негативный промпт после него, чтобы заменить промпт по умолчанию для одной картинки, например \"cat on a sofa || blurry, watermark\". " +
+			"Отправьте фото с описанием, чтобы изменить фото.",
+		"power_off.wait":   "Пожалуйста, подождите. Ваш профиль сброшен к настройкам по умолчанию.",
+		"power_off.done":   "Подождите 2 минуты. Ваш профиль сброшен к настройкам по умолчанию.",
+		"prompt.too_short": "Описание должно быть длиннее 2 символов.",
+		"prompt.expired":   "Это описание больше недоступно",
+		"photo.expected":   "Пожалуйста, отправьте фото или введите /cancel.",
+
+		"button.default":         "по умолчанию",
+		"button.none":            "нет",
+		"button.random":          "случайный",
+		"button.unknown":         "Неизвестная кнопка",
+		"button.upscale":         "Увеличить x%d",
+		"button.upscale_short":   "#%d x%d",
+		"button.remove_bg":       "Удалить фон",
+		"button.remove_bg_short": "#%d без фона",
+		"button.use_improved":    "Улучшенное",
+		"button.use_original":    "Исходное",
+		"button.describe":        "Сгенерировать по нему",
+
+		"invalid.choose_number": "Неверный ввод. Пожалуйста, выберите число на клавиатуре:",
+		"invalid.number":        "Неверный ввод. Пожалуйста, выберите число на клавиатуре.",
+		"invalid.model":         "Неверный ввод. Пожалуйста, выберите модель на клавиатуре.",
+		"invalid.size":          "Неверный ввод. Пожалуйста, выберите размер на клавиатуре.",
+		"invalid.scheduler":     "Неверный ввод. Пожалуйста, выберите планировщик на клавиатуре.",
+
+		"steps.current":          `Текущее количество шагов: "%d" Пожалуйста, выберите значение на клавиатуре. Введите /cancel, чтобы вернуться в главное меню `,
+		"steps.set":              "Количество шагов: %d",
+		"cfg.current":            `Текущий CFG scale: "%s" Чем больше значение, тем точнее картинка следует описанию. Пожалуйста, выберите значение на клавиатуре. Введите /cancel, чтобы вернуться в главное меню `,
+		"cfg.current_default":    "по умолчанию (%s для вашей модели)",
+		"cfg.set_default":        "CFG scale по умолчанию для модели: %s",
+		"cfg.set":                "CFG scale: %s",
+		"number_results.current": `Текущее количество картинок: "%d" Пожалуйста, выберите значение на клавиатуре. Введите /cancel, чтобы вернуться в главное меню `,
+		"number_results.set":     "Количество картинок: %d",
+		"models.current":         `Ваша модель: "%s" Пожалуйста, выберите модель на клавиатуре. Введите /cancel, чтобы вернуться в главное меню`,
+		"models.set":             "Модель: %s",
+		"size.current":           `Ваш размер: "%s" Пожалуйста, выберите размер на клавиатуре. Введите /cancel, чтобы вернуться в главное меню`,
+		"size.set":               "Размер: %s",
+		"schedulers.current":     `Ваш планировщик: "%s" Пожалуйста, выберите планировщик на клавиатуре. Введите /cancel, чтобы вернуться в главное меню`,
+		"schedulers.set":         "Планировщик: %s",
+		"negative.current":       `Ваш негативный промпт: "%s" Отправьте то, что не хотите видеть на картинке, или выберите "%s", чтобы очистить его. Введите /cancel, чтобы вернуться в главное меню`,
+		"negative.invalid":       "Неверный ввод. Пожалуйста, отправьте текст или введите /cancel.",
+		"negative.too_long":      "Негативный промпт должен быть короче %d символов.",
+		"negative.set":           "Негативный промпт: %s",
+		"negative.cleared":       "Негативный промпт очищен",
+		"seed.current":           `Ваш seed: "%s" Отправьте число, чтобы получать ту же картинку для того же промпта, или выберите "%s". Введите /cancel, чтобы вернуться в главное меню`,
+		"seed.invalid":           `Неверный ввод. Пожалуйста, отправьте положительное число или "%s".`,
+		"seed.set":               "Seed: %s",
+		"strength.current":       `Текущая сила изменения: "%s" Она используется, когда вы отправляете фото: чем меньше значение, тем больше сохраняется от фото. Пожалуйста, выберите значение на клавиатуре. Введите /cancel, чтобы вернуться в главное меню `,
+		"strength.set":           "Сила изменения: %s",
+		"language.current":       `Ваш язык: "%s" Пожалуйста, выберите язык на клавиатуре. Введите /cancel, чтобы вернуться в главное меню`,
+		"language.set":           "Язык: %s",
+		"language.invalid":       "Неверный ввод. Пожалуйста, выберите язык на клавиатуре.",
+
+		"photo.finish_menu":     "Сначала завершите выбор в меню. Введите /cancel, чтобы вернуться в главное меню",
+		"photo.ask_prompt":      "Фото получено. Теперь отправьте описание того, чем оно должно стать. Введите /cancel, чтобы вернуться в главное меню",
+		"photo.prompt_expected": "Пожалуйста, отправьте описание картинки или введите /cancel.",
+		"photo.prompt_accepted": "Описание принято.",
+		"photo.load_failed":     "Не удалось загрузить ваше фото. Пожалуйста, отправьте его снова.",
+
+		"enhance.usage":    "Неверный ввод. Используйте /enhance, /enhance on или /enhance off.",
+		"enhance.off":      "Улучшение описаний выключено. Описания используются как есть.",
+		"enhance.on":       "Улучшение описаний включено. Короткие описания будут дополняться перед генерацией, и вы сможете выбрать, какое использовать.",
+		"enhance.status":   "Улучшаю описание, пожалуйста, подождите...",
+		"enhance.failed":   "Не удалось улучшить описание. Можно сгенерировать картинку по исходному.",
+		"enhance.result":   "Улучшенное описание:\n\n%s\n\nИсходное: %s",
+		"enhance.original": "Используется исходное описание",
+		"enhance.improved": "Используется улучшенное описание",
+
+		"describe.ask":        "Отправьте фото для описания или ответьте командой /describe на картинку. Введите /cancel, чтобы вернуться в главное меню",
+		"describe.status":     "Описываю картинку, пожалуйста, подождите...",
+		"describe.error":      "Ошибка при описании картинки. Пожалуйста, попробуйте позже.",
+		"describe.result":     "Описание:\n\n%s",
+		"describe.generating": "Генерирую по описанию",
+
+		"queue.user_limit": "У вас уже %d картинок в работе. Пожалуйста, дождитесь, пока одна из них будет готова.",
+		"queue.full":       "Бот сейчас перегружен, ваш запрос не принят. Пожалуйста, попробуйте через несколько минут.",
+		"queue.position":   "Ваш запрос в очереди, позиция: %d. %s",
+		"maintenance":      "Бот перезапускается на обслуживание. Пожалуйста, отправьте запрос снова через несколько минут.",
+
+		"generation.status":      "Генерирую картинку, пожалуйста, подождите...",
+		"generation.error":       "Ошибка при генерации картинки. Пожалуйста, попробуйте ещё раз или измените настройки.",
+		"generation.load_failed": "Не удалось загрузить картинку. Пожалуйста, попробуйте ещё раз.",
+		"generation.send_failed": "Не удалось отправить изображения. Пожалуйста, попробуйте ещё раз.",
+		"generation.seed":        "Seed: %d",
+
+		"settings.title":          "Ваши настройки:",
+		"settings.hint":           "Нажмите на кнопку, чтобы изменить настройку.",
+		"settings.outdated":       "Варианты изменились, выберите ещё раз.",
+		"settings.choose":         "%s (сейчас: %s). Выберите новое значение:",
+		"settings.updated":        "%s: %s",
+		"settings.model":          "Модель",
+		"settings.steps":          "Шаги",
+		"settings.size":           "Размер",
+		"settings.scheduler":      "Планировщик",
+		"settings.number_results": "Количество картинок",
+		"settings.cfg":            "CFG scale",
+		"settings.strength":       "Сила изменения",
+		"settings.seed":           "Seed",
+		"settings.negative":       "Негативный промпт",
+		"settings.enhance":        "Улучшение описаний",
+		"settings.language":       "Язык",
+		"button.back":             "« Назад",
+		"option.on":               "вкл",
+		"option.off":              "выкл",
+
+		"preset.usage":        "Используйте /preset save <имя>, /preset load <имя>, /preset list или /preset delete <имя>.",
+		"preset.invalid_name": "Имя пресета должно быть от 1 до %d символов и не начинаться с \"/\".",
+		"preset.limit":        "Можно хранить до %d пресетов. Удалите один командой /preset delete <имя>.",
+		"preset.error":        "Не удалось сохранить или загрузить пресет. Пожалуйста, попробуйте позже.",
+		"preset.saved":        "Пресет \"%s\" сохранён. Загрузить его: /preset load %[1]s",
+		"preset.loaded":       "Пресет \"%s\" загружен.",
+		"preset.deleted":      "Пресет \"%s\" удалён.",
+		"preset.not_found":    "Пресета \"%s\" нет.",
+		"preset.empty":        "У вас нет пресетов. Сохраните текущие настройки командой /preset save <имя>.",
+		"preset.list":         "Ваши пресеты, выберите один для загрузки или введите /cancel:",
+		"preset.item":         "• %s: %s, %dx%d, шагов: %d",
+
+		"history.empty":   "У вас пока нет генераций.",
+		"history.title":   "Ваши генерации, страница %d из %d:",
+		"history.entry":   "%d. %s\n%s, %dx%d, шагов: %d, seed %d, %s",
+		"history.expired": "Этой генерации больше нет в истории",
+		"history.rerun":   "Генерирую снова",
+
+		"button.rerun_same":    "#%d повторить",
+		"button.rerun_current": "#%d с моими настройками",
+		"button.newer":         "« Новее",
+		"button.older":         "Старше »",
+
+		"images.actions":   "Что сделать с картинками?",
+		"images.expired":   "Эта картинка больше недоступна",
+		"upscale.status":   "Увеличиваю картинку x%d, пожалуйста, подождите...",
+		"upscale.error":    "Ошибка при увеличении картинки. Пожалуйста, попробуйте позже.",
+		"remove_bg.ask":    "Отправьте фото, чтобы удалить фон, или ответьте командой /remove_bg на сгенерированную картинку. Введите /cancel, чтобы вернуться в главное меню",
+		"remove_bg.status": "Удаляю фон, пожалуйста, подождите...",
+		"remove_bg.error":  "Ошибка при удалении фона. Пожалуйста, попробуйте позже.",
+		"cancel.cancelled": "Отменено генераций: %d",
+		"cancel.menu":      "Вы вернулись в главное меню.",
+		"cancel.nothing":   "Нечего отменять.",
+		"admin.only":       "Эта команда только для администраторов.",
+		"catalog.reloaded": "Каталог перезагружен.",
+		"catalog.failed":   "Каталог не перезагружен, оставлен старый:\n%v",
+		"ban.usage":        "Использование: /ban <id чата> или /unban <id чата>",
+		"ban.admin":        "Администраторов нельзя заблокировать.",
+		"ban.done":         "Чат %d заблокирован.",
+		"ban.already":      "Чат %d уже заблокирован.",
+		"ban.removed":      "Чат %d разблокирован.",
+		"ban.not_banned":   "Чат %d не заблокирован.",
+		"ban.error":        "Не удалось сохранить список блокировок, попробуйте ещё раз.",
+		"banned":           "Извините, вам запрещено пользоваться этим ботом.",
+		"broadcast.usage":  "Использование: /broadcast <текст>",
+		"broadcast.busy":   "Уже идёт другая рассылка, дождитесь её окончания.",
+		"broadcast.start":  "Отправляю сообщение в %d чатов…",
+		"broadcast.done":   "Рассылка завершена: доставлено %d, ошибок %d.",
+		"stats.text": "Статистика\n" +
+			"Известных пользователей: %d, заблокировано: %d\n" +
+			"Активны сегодня: %d, за 7 дней: %d\n" +
+			"Заданий сегодня: %d, с ошибкой: %d\n" +
+			"Заданий за 7 дней: %d, с ошибкой: %d\n" +
+			"Очередь: %d ждут, %d выполняются",
+		"stats.top_models": "Популярные модели за 7 дней:",
+		"stats.model":      "%d. %s — %d",
+		"quota.exceeded": "Дневной лимит исчерпан. Это задание стоит %d кредитов за %d картинок, у вас осталось %s кредитов и %s картинок. " +
+			"Лимиты обновятся %s. Меньше картинок, меньший размер или меньше шагов стоят дешевле.",
+		"quota.balance":         "Тариф: %s\nКартинок сегодня: %s\nКредитов сегодня: %s\nГенерация с вашими настройками стоит %d кредитов.\nЛимиты обновятся %s.",
+		"quota.no_limits":       "У вас нет дневных лимитов. Генерация с вашими настройками стоит %d кредитов.",
+		"quota.task_prices":     "Увеличение стоит столько кредитов, во сколько раз увеличивает картинку, удаление фона, улучшение и описание - %d.",
+		"quota.usage":           "%d из %d",
+		"quota.usage_unlimited": "%d, без лимита",
+		"quota.unlimited":       "без лимита",
+		"quota.tier_usage":      "Использование: /tier <id чата> <тариф>. Тарифы: %s",
+		"quota.tier_unknown":    "Неизвестный тариф %s. Тарифы: %s",
+		"quota.tier_set":        "Чат %d переведён на тариф %s.",
+		"moderation.blocked":    "Извините, это описание нельзя использовать: «%s» здесь не допускается. Переформулируйте его и отправьте снова.",
+		"moderation.usage": "Использование:\n" +
+			"/moderation list [язык] - показать списки запрещённых слов\n" +
+			"/moderation add <язык> [strict] <слово или фраза> - запретить слово\n" +
+			"/moderation regex <язык> [strict] <выражение> - запретить регулярное выражение\n" +
+			"/moderation remove <язык> <номер или шаблон> - удалить правило\n" +
+			"/moderation level <id чата> <off|normal|strict|default> - строгость для чата, по умолчанию %s\n" +
+			"/moderation log [количество] - последние заблокированные промпты\n" +
+			"Правила strict действуют только для чатов со строгим уровнем.",
+		"moderation.list_title":   "Список %s, правил: %d",
+		"moderation.list_empty":   "Списков запрещённых слов нет.",
+		"moderation.strict_mark":  " (strict)",
+		"moderation.invalid_rule": "Правило не добавлено: %v",
+		"moderation.exists":       "%s уже есть в списке %s.",
+		"moderation.added":        "%s добавлено в список %s.",
+		"moderation.not_found":    "%s не найдено в списке %s.",
+		"moderation.removed":      "%s удалено из списка %s.",
+		"moderation.error":        "Не удалось сохранить изменение, попробуйте ещё раз.",
+		"moderation.level_set":    "Уровень модерации чата %d: %s.",
+		"moderation.log_empty":    "Заблокированных промптов нет.",
+		"moderation.log_title":    "Последние заблокированные промпты: %d",
+		"moderation.log_entry":    "%s, чат %d, уровень %s\nПравило %s: %s\n%s",
+
+		"menu.start":          "Старт",
+		"menu.help":           "Помощь",
+		"menu.models":         "Модели",
+		"menu.steps":          "Шаги",
+		"menu.size":           "Размер",
+		"menu.number_results": "Количество картинок",
+		"menu.schedulers":     "Планировщики",
+		"menu.power_off":      "Сбросить настройки",
+		"menu.language":       "Язык",
+
+		"command.start":          "Перезапустить бота",
+		"command.help":           "Получить помощь",
+		"command.settings":       "Все ваши настройки в одном сообщении",
+		"command.models":         "Выбрать модель",
+		"command.steps":          "Больше шагов - лучше, но дольше генерация",
+		"command.size":           "Выбрать размер картинки",
+		"command.number_results": "Выбрать количество картинок",
+		"command.schedulers":     "Выбрать планировщик",
+		"command.negative":       "Что вы не хотите видеть на картинке",
+		"command.seed":           "Зафиксировать seed, чтобы снова получить ту же картинку",
+		"command.cfg":            "Насколько точно картинка следует описанию",
+		"command.strength":       "Насколько сильно меняется отправленное фото",
+		"command.remove_bg":      "Вырезать объект с картинки",
+		"command.enhance":        "Улучшать короткие описания перед генерацией",
+		"command.describe":       "Описать фото, чтобы сгенерировать похожее",
+		"command.history":        "Ваши последние картинки",
+		"command.preset":         "Сохранить и загрузить наборы настроек",
+		"command.language":       "Сменить язык",
+		"command.balance":        "Ваши дневные лимиты",
+		"command.cancel":         "Отменить задания и вернуться в главное меню",
+		"command.power_off":      "Сбросить настройки",
+		"command.stats":          "Статистика использования",
+		"command.broadcast":      "Отправить сообщение всем пользователям",
+		"command.ban":            "Заблокировать чат",
+		"command.unban":          "Разблокировать чат",
+		"command.tier":           "Перевести чат на другой тариф",
+		"command.moderation":     "Списки запретов и уровни модерации",
+		"command.reload_catalog": "Перечитать каталог моделей и размеров",
+	},
+}
+
+// tr returns the text with the key in the language, formatted with args if there are any.
+func tr(lang, key string, args ...any) string {
+	text, ok := messages[lang][key]
+	if !ok {
+		text, ok = messages[defaultLanguage][key]
+	}
+	if !ok {
+		slog.Warn("Missing text", "key", key)
+		return key
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(text, args...)
+	}
+	return text
+}
+
+// text returns the text in the language of the chat. It reads the live settings, so only the
+// update loop may call it, job workers use tr with the language of the job.
+func (b *Bot) text(chatID int64, key string, args ...any) string {
+	return tr(b.getSettings(chatID).language, key, args...)
+}
+
+// detectLanguage picks a supported language by the IETF tag Telegram sends, e.g. "ru" or "en-US".
+func detectLanguage(code string) string {
+	code, _, _ = strings.Cut(strings.ToLower(code), "-")
+	if _, ok := messages[code]; ok {
+		return code
+	}
+	return defaultLanguage
+}
+
+func languageName(code string) string {
+	for _, l := range languages {
+		if l.code == code {
+			return l.name
+		}
+	}
+	return code
+}
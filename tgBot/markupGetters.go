@@ -2,20 +2,19 @@ package tgBot
 
 import (
 	"fmt"
-	"sort"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
-func getStepsMarkup() [][]tgbotapi.KeyboardButton {
+func getStepsMarkup(lang string) [][]tgbotapi.KeyboardButton {
 	var keyboard [][]tgbotapi.KeyboardButton
 
 	var row []tgbotapi.KeyboardButton
-	for i, step := range stepsOptions {
-		if step == defaultSteps {
-			button := tgbotapi.NewKeyboardButton("default")
+	for i, step := range options().Steps {
+		if step == options().Defaults.Steps {
+			button := tgbotapi.NewKeyboardButton(tr(lang, "button.default"))
 			row = append(row, button)
-		} else if step != defaultSteps {
+		} else if step != options().Defaults.Steps {
 			button := tgbotapi.NewKeyboardButton(fmt.Sprintf("%d", step))
 			row = append(row, button)
 		}
@@ -33,16 +32,38 @@ func getStepsMarkup() [][]tgbotapi.KeyboardButton {
 	return keyboard
 }
 
-func getNumberResultsMarkup() [][]tgbotapi.KeyboardButton {
+func getCFGMarkup(lang string) [][]tgbotapi.KeyboardButton {
+	var keyboard [][]tgbotapi.KeyboardButton
+
+	// Первая кнопка - значение по умолчанию для выбранной модели
+	row := []tgbotapi.KeyboardButton{tgbotapi.NewKeyboardButton(tr(lang, "button.default"))}
+	for _, cfg := range options().CFGScales {
+		button := tgbotapi.NewKeyboardButton(formatFloat(cfg))
+		row = append(row, button)
+		// Если добавили три кнопки в ряд, создаем новый ряд
+		if len(row) == 3 {
+			keyboard = append(keyboard, row)
+			row = []tgbotapi.KeyboardButton{} // Очищаем текущий ряд
+		}
+	}
+
+	// Добавляем оставшиеся кнопки, если они есть
+	if len(row) > 0 {
+		keyboard = append(keyboard, row)
+	}
+	return keyboard
+}
+
+func getStrengthMarkup(lang string) [][]tgbotapi.KeyboardButton {
 	var keyboard [][]tgbotapi.KeyboardButton
 
 	var row []tgbotapi.KeyboardButton
-	for i, numberResult := range numberResultsOptions {
-		if numberResult == defaultNumberResults {
-			button := tgbotapi.NewKeyboardButton("default")
+	for i, strength := range options().Strengths {
+		if strength == options().Defaults.Strength {
+			button := tgbotapi.NewKeyboardButton(tr(lang, "button.default"))
 			row = append(row, button)
-		} else if numberResult != defaultNumberResults {
-			button := tgbotapi.NewKeyboardButton(fmt.Sprintf("%d", numberResult))
+		} else {
+			button := tgbotapi.NewKeyboardButton(formatFloat(strength))
 			row = append(row, button)
 		}
 		// Если добавили три кнопки в ряд, создаем новый ряд
@@ -59,21 +80,43 @@ func getNumberResultsMarkup() [][]tgbotapi.KeyboardButton {
 	return keyboard
 }
 
-func getModelsMarkup() [][]tgbotapi.KeyboardButton {
+func getNumberResultsMarkup(lang string) [][]tgbotapi.KeyboardButton {
 	var keyboard [][]tgbotapi.KeyboardButton
+
 	var row []tgbotapi.KeyboardButton
+	for i, numberResult := range options().NumberResults {
+		if numberResult == options().Defaults.NumberResults {
+			button := tgbotapi.NewKeyboardButton(tr(lang, "button.default"))
+			row = append(row, button)
+		} else if numberResult != options().Defaults.NumberResults {
+			button := tgbotapi.NewKeyboardButton(fmt.Sprintf("%d", numberResult))
+			row = append(row, button)
+		}
+		// Если добавили три кнопки в ряд, создаем новый ряд
+		if (i+1)%3 == 0 {
+			keyboard = append(keyboard, row)
+			row = []tgbotapi.KeyboardButton{} // Очищаем текущий ряд
+		}
+	}
 
-	// Создаем слайс для ключей и сортируем их
-	keys := make([]string, 0, len(modelsOptions))
-	for key := range modelsOptions {
-		keys = append(keys, key)
+	// Добавляем оставшиеся кнопки, если они есть
+	if len(row) > 0 {
+		keyboard = append(keyboard, row)
 	}
-	sort.Strings(keys) // Сортируем ключи
+	return keyboard
+}
 
-	// Генерация кнопок в нужном порядке
+func getModelsMarkup(lang string) [][]tgbotapi.KeyboardButton {
+	var keyboard [][]tgbotapi.KeyboardButton
+	var row []tgbotapi.KeyboardButton
+
+	// Кнопки идут в порядке каталога
 	i := 0
-	for _, key := range keys {
-		button := tgbotapi.NewKeyboardButton(fmt.Sprintf("%s", key))
+	for _, model := range options().Models {
+		button := tgbotapi.NewKeyboardButton(model.Name)
+		if model.AIR == options().Defaults.Model {
+			button = tgbotapi.NewKeyboardButton(tr(lang, "button.default"))
+		}
 		row = append(row, button)
 
 		// Добавляем ряд каждые три кнопки
@@ -92,21 +135,17 @@ func getModelsMarkup() [][]tgbotapi.KeyboardButton {
 	return keyboard
 }
 
-func getSizeMarkup() [][]tgbotapi.KeyboardButton {
+func getSizeMarkup(lang string) [][]tgbotapi.KeyboardButton {
 	var keyboard [][]tgbotapi.KeyboardButton
 	var row []tgbotapi.KeyboardButton
 
-	// Создаем слайс для ключей и сортируем их
-	keys := make([]string, 0, len(sizeOptions))
-	for key := range sizeOptions {
-		keys = append(keys, key)
-	}
-	sort.Strings(keys) // Сортируем ключи
-
-	// Генерация кнопок
+	// Кнопки идут в порядке каталога
 	i := 0
-	for _, key := range keys {
-		button := tgbotapi.NewKeyboardButton(fmt.Sprintf("%s", key))
+	for _, size := range options().Sizes {
+		button := tgbotapi.NewKeyboardButton(size.Name)
+		if size.Width == options().Defaults.Width && size.Height == options().Defaults.Height {
+			button = tgbotapi.NewKeyboardButton(tr(lang, "button.default"))
+		}
 		row = append(row, button)
 
 		// Добавляем ряд каждые четыре кнопки
@@ -125,13 +164,14 @@ func getSizeMarkup() [][]tgbotapi.KeyboardButton {
 	return keyboard
 }
 
-func getDefaultMarkup() [][]tgbotapi.KeyboardButton {
+// getDefaultMarkup builds the main keyboard, menuCommand turns its labels back into commands.
+func getDefaultMarkup(lang string) [][]tgbotapi.KeyboardButton {
 	var keyboard [][]tgbotapi.KeyboardButton
 
 	var row []tgbotapi.KeyboardButton
 	i := 0
 	for _, value := range serviceCommands {
-		button := tgbotapi.NewKeyboardButton(fmt.Sprintf("%s", value))
+		button := tgbotapi.NewKeyboardButton(menuLabel(lang, value))
 		row = append(row, button)
 
 		// Если добавили три кнопки в ряд, создаем новый ряд
@@ -145,18 +185,42 @@ func getDefaultMarkup() [][]tgbotapi.KeyboardButton {
 	return keyboard
 }
 
-func getSchedulersMarkup() [][]tgbotapi.KeyboardButton {
+func getPresetsMarkup(names []string) [][]tgbotapi.KeyboardButton {
 	var keyboard [][]tgbotapi.KeyboardButton
 	var row []tgbotapi.KeyboardButton
+	for _, name := range names {
+		row = append(row, tgbotapi.NewKeyboardButton(name))
+		// Добавляем ряд каждые три кнопки
+		if len(row) == 3 {
+			keyboard = append(keyboard, row)
+			row = []tgbotapi.KeyboardButton{}
+		}
+	}
+	if len(row) > 0 {
+		keyboard = append(keyboard, row)
+	}
+	return keyboard
+}
+
+func getLanguageMarkup() [][]tgbotapi.KeyboardButton {
+	var row []tgbotapi.KeyboardButton
+	for _, l := range languages {
+		row = append(row, tgbotapi.NewKeyboardButton(l.name))
+	}
+	return [][]tgbotapi.KeyboardButton{row}
+}
 
-	// Создаем слайс для ключей и сортируем их
-	keys := schedulersOptions
-	sort.Strings(keys) // Сортируем ключи
+func getSchedulersMarkup(lang string) [][]tgbotapi.KeyboardButton {
+	var keyboard [][]tgbotapi.KeyboardButton
+	var row []tgbotapi.KeyboardButton
 
-	// Генерация кнопок в нужном порядке
+	// Кнопки идут в порядке каталога
 	i := 0
-	for _, key := range keys {
-		button := tgbotapi.NewKeyboardButton(fmt.Sprintf("%s", key))
+	for _, key := range options().Schedulers {
+		button := tgbotapi.NewKeyboardButton(key)
+		if key == options().Defaults.Scheduler {
+			button = tgbotapi.NewKeyboardButton(tr(lang, "button.default"))
+		}
 		row = append(row, button)
 
 		// Добавляем ряд каждые три кнопки
@@ -174,3 +238,35 @@ func getSchedulersMarkup() [][]tgbotapi.KeyboardButton {
 
 	return keyboard
 }
+
+// getImageActionsMarkup builds buttons for pictures saved under keys.
+func getImageActionsMarkup(lang string, keys []string) tgbotapi.InlineKeyboardMarkup {
+	var keyboard [][]tgbotapi.InlineKeyboardButton
+	for i, key := range keys {
+		var row []tgbotapi.InlineKeyboardButton
+		for _, factor := range upscaleFactors {
+			label := tr(lang, "button.upscale", factor)
+			if len(keys) > 1 {
+				label = tr(lang, "button.upscale_short", i+1, factor)
+			}
+			row = append(row, tgbotapi.NewInlineKeyboardButtonData(label, fmt.Sprintf("up:%d:%s", factor, key)))
+		}
+		label := tr(lang, "button.remove_bg")
+		if len(keys) > 1 {
+			label = tr(lang, "button.remove_bg_short", i+1)
+		}
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData(label, "bg::"+key))
+		keyboard = append(keyboard, row)
+	}
+	return tgbotapi.NewInlineKeyboardMarkup(keyboard...)
+}
+
+// getEnhanceMarkup builds the choice between the improved and the original description.
+func getEnhanceMarkup(lang, key string, enhanced bool) tgbotapi.InlineKeyboardMarkup {
+	var row []tgbotapi.InlineKeyboardButton
+	if enhanced {
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData(tr(lang, "button.use_improved"), "en:e:"+key))
+	}
+	row = append(row, tgbotapi.NewInlineKeyboardButtonData(tr(lang, "button.use_original"), "en:o:"+key))
+	return tgbotapi.NewInlineKeyboardMarkup(row)
+}
@@ -0,0 +1,153 @@
+package tgBot
+
+import (
+	"errors"
+	"net/http"
+	"path"
+	"slices"
+
+	"github.com/MTUCI-Pixel-Team/Picture_Generator/generator"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Metrics are registered in the default registry, promhttp.Handler serves them
+// together with the metrics of the Go runtime and the process.
+var (
+	updatesReceived = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "bot_updates_total",
+		Help: "Updates received from Telegram by type.",
+	}, []string{"type"})
+	commandsUsed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "bot_commands_total",
+		Help: "Commands sent by users.",
+	}, []string{"command"})
+	jobsStarted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "bot_jobs_started_total",
+		Help: "Jobs taken by a worker. The model is set for generations only.",
+	}, []string{"kind", "model"})
+	jobsSucceeded = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "bot_jobs_succeeded_total",
+		Help: "Jobs that delivered their result.",
+	}, []string{"kind", "model"})
+	jobsFailed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "bot_jobs_failed_total",
+		Help: "Jobs that failed or were cancelled, by error class.",
+	}, []string{"kind", "model", "class"})
+	jobDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "bot_job_duration_seconds",
+		Help:    "Time a worker spends on a job, including downloads and sending the result.",
+		Buckets: []float64{1, 2.5, 5, 10, 20, 30, 60, 90, 120, 180},
+	}, []string{"kind"})
+	downloadDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "bot_image_download_seconds",
+		Help:    "Time to download a picture from the provider or from Telegram.",
+		Buckets: []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+	})
+	downloadSize = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "bot_image_download_bytes",
+		Help:    "Size of downloaded pictures.",
+		Buckets: []float64{64 << 10, 256 << 10, 512 << 10, 1 << 20, 2 << 20, 4 << 20, 8 << 20, 16 << 20},
+	})
+	telegramFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "bot_telegram_request_failures_total",
+		Help: "Requests to the Bot API that failed or were rejected, by method.",
+	}, []string{"method"})
+	promptsBlocked = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "bot_prompts_blocked_total",
+		Help: "Prompts refused by moderation, by the language of the blocklist.",
+	}, []string{"language"})
+)
+
+// knownCommands are counted by name, anything else that starts with a slash is counted as "other".
+var knownCommands = []string{
+	"/start", "/help", "/settings", "/models", "/steps", "/size", "/number_results", "/schedulers",
+	"/negative", "/seed", "/cfg", "/strength", "/enhance", "/describe", "/remove_bg", "/history", "/preset",
+	"/language", "/balance", "/cancel", "/power_off", "/reload_catalog", "/stats", "/broadcast",
+	"/ban", "/unban", "/tier", "/moderation",
+}
+
+func updateType(update tgbotapi.Update) string {
+	switch {
+	case update.Message != nil:
+		if len(update.Message.Photo) > 0 {
+			return "photo"
+		}
+		return "message"
+	case update.CallbackQuery != nil:
+		return "callback_query"
+	case update.EditedMessage != nil:
+		return "edited_message"
+	}
+	return "other"
+}
+
+func countCommand(command string) {
+	if len(command) < 2 || command[0] != '/' {
+		return
+	}
+	if !slices.Contains(knownCommands, command) {
+		command = "other"
+	}
+	commandsUsed.WithLabelValues(command).Inc()
+}
+
+// errorClass adds Telegram errors to the classes of the generator.
+func errorClass(err error) string {
+	var tgErr *tgbotapi.Error
+	if errors.As(err, &tgErr) {
+		return "telegram"
+	}
+	return generator.ErrorClass(err)
+}
+
+// jobModel is the model label of the job.
+func jobModel(j *job) string {
+	if j.kind != jobGenerate {
+		return ""
+	}
+	return j.settings.model
+}
+
+// countingClient counts failed requests to the Bot API and tells health about polling.
+// The URL holds the token, so only the method name is taken from it.
+type countingClient struct {
+	client *http.Client
+	health *healthState
+}
+
+func (c countingClient) Do(req *http.Request) (*http.Response, error) {
+	resp, err := c.client.Do(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		telegramFailures.WithLabelValues(path.Base(req.URL.Path)).Inc()
+	}
+	c.health.observe(req, resp, err)
+	return resp, err
+}
+
+// registerGauges exposes the state of the queue and of the generator connections.
+func (b *Bot) registerGauges() {
+	replaceGauge("bot_queue_pending_jobs", "Jobs waiting for a free worker.", func() float64 {
+		pending, _ := b.queue.depth()
+		return float64(pending)
+	})
+	replaceGauge("bot_queue_running_jobs", "Jobs being processed by workers.", func() float64 {
+		_, running := b.queue.depth()
+		return float64(running)
+	})
+	if gen, ok := b.generator.(interface{ OpenConnections() int }); ok {
+		replaceGauge("bot_provider_connections", "Open WebSocket connections to the provider.", func() float64 {
+			return float64(gen.OpenConnections())
+		})
+	}
+}
+
+// replaceGauge registers the gauge in place of the one registered by a previous Bot.
+// Unregister finds the old gauge by the same name and help.
+func replaceGauge(name, help string, fn func() float64) {
+	gauge := prometheus.NewGaugeFunc(prometheus.GaugeOpts{Name: name, Help: help}, fn)
+	prometheus.Unregister(gauge)
+	prometheus.MustRegister(gauge)
+}
@@ -0,0 +1,88 @@
+package tgBot
+
+import (
+	"context"
+	"testing"
+
+	"github.com/MTUCI-Pixel-Team/Picture_Generator/storage"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestJobMetrics(t *testing.T) {
+	serveTelegramFiles(t, map[string][]byte{"photo": testPNG(t, 16, 16)})
+	b, _ := newJobBot(t, storage.NewMemoryStore())
+	// Метрики глобальные, поэтому проверяем прирост
+	started := testutil.ToFloat64(jobsStarted.WithLabelValues("describe", ""))
+	succeeded := testutil.ToFloat64(jobsSucceeded.WithLabelValues("describe", ""))
+	failed := testutil.ToFloat64(jobsFailed.WithLabelValues("enhance", "", "other"))
+
+	b.runJob(describeJob(b, 1))
+	b.generator = failingEnhancer{b.generator}
+	j := b.queue.newJob(context.Background(), jobEnhance, 1)
+	j.prompt = "a cat"
+	b.runJob(j)
+
+	if got := testutil.ToFloat64(jobsStarted.WithLabelValues("describe", "")) - started; got != 1 {
+		t.Errorf("%v describe jobs started", got)
+	}
+	if got := testutil.ToFloat64(jobsSucceeded.WithLabelValues("describe", "")) - succeeded; got != 1 {
+		t.Errorf("%v describe jobs succeeded", got)
+	}
+	if got := testutil.ToFloat64(jobsFailed.WithLabelValues("enhance", "", "other")) - failed; got != 1 {
+		t.Errorf("%v enhance jobs failed", got)
+	}
+}
+
+func TestCountCommand(t *testing.T) {
+	start := testutil.ToFloat64(commandsUsed.WithLabelValues("/start"))
+	other := testutil.ToFloat64(commandsUsed.WithLabelValues("other"))
+	for _, command := range []string{"/start", "/secret", "hello", "/"} {
+		countCommand(command)
+	}
+	if got := testutil.ToFloat64(commandsUsed.WithLabelValues("/start")) - start; got != 1 {
+		t.Errorf("/start counted %v times", got)
+	}
+	// Неизвестные команды не создают новых меток
+	if got := testutil.ToFloat64(commandsUsed.WithLabelValues("other")) - other; got != 1 {
+		t.Errorf("other counted %v times", got)
+	}
+}
+
+func TestRegisterGaugesAgain(t *testing.T) {
+	first, _ := newJobBot(t, storage.NewMemoryStore())
+	first.registerGauges()
+	second, _ := newJobBot(t, storage.NewMemoryStore())
+	second.queue.push(second.queue.newJob(context.Background(), jobEnhance, 1))
+	// Второй бот заменяет датчики первого, а не падает на повторной регистрации
+	second.registerGauges()
+
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		if family.GetName() == "bot_queue_pending_jobs" {
+			if value := family.GetMetric()[0].GetGauge().GetValue(); value != 1 {
+				t.Errorf("pending jobs %v, want the queue of the second bot", value)
+			}
+			return
+		}
+	}
+	t.Error("no bot_queue_pending_jobs")
+}
+
+func TestMetricsLint(t *testing.T) {
+	for _, collector := range []prometheus.Collector{
+		updatesReceived, commandsUsed, jobsStarted, jobsSucceeded, jobsFailed, jobDuration,
+		downloadDuration, downloadSize, telegramFailures, promptsBlocked,
+	} {
+		problems, err := testutil.CollectAndLint(collector)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, problem := range problems {
+			t.Errorf("%s: %s", problem.Metric, problem.Text)
+		}
+	}
+}
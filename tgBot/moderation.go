@@ -0,0 +1,558 @@
+package tgBot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	blocklistsBucket       = "blocklists"
+	moderationLevelsBucket = "moderation_levels"
+	moderationAuditBucket  = "moderation_audit"
+	// moderationAuditRetention is how long blocked prompts are kept for review.
+	moderationAuditRetention = 30 * 24 * time.Hour
+	moderationAuditShown     = 10
+	moderationAuditMaxShown  = 50
+	// messageLimit is the maximum length of a Telegram message, long lists are split.
+	messageLimit = 4000
+)
+
+// Strictness levels of a chat. Normal applies the common rules, strict applies the rules marked strict too.
+const (
+	moderationOff    = "off"
+	moderationNormal = "normal"
+	moderationStrict = "strict"
+)
+
+var moderationLevels = []string{moderationOff, moderationNormal, moderationStrict}
+
+var languagePattern = regexp.MustCompile(`^[a-z]{2,3}$`)
+
+// ModerationConfig sets up the check of prompts before they are queued.
+type ModerationConfig struct {
+	// BlocklistPath is a JSON file with the initial blocklists by language, like moderation.example.json.
+	// It is read only while the store has no blocklists, later they are changed with /moderation.
+	BlocklistPath string
+	// DefaultLevel is the strictness of chats without their own level: off, normal or strict.
+	DefaultLevel string
+}
+
+func (c *ModerationConfig) setDefaults() error {
+	if c.DefaultLevel == "" {
+		c.DefaultLevel = moderationNormal
+	}
+	if !validLevel(c.DefaultLevel) {
+		return fmt.Errorf("unknown moderation level %q", c.DefaultLevel)
+	}
+	return nil
+}
+
+func validLevel(level string) bool {
+	for _, l := range moderationLevels {
+		if l == level {
+			return true
+		}
+	}
+	return false
+}
+
+// blockRule is a word, a phrase or a regular expression that is not allowed in prompts.
+// Words and phrases match whole words in any case, expressions are case-insensitive.
+type blockRule struct {
+	Pattern string `json:"pattern"`
+	Regex   bool   `json:"regex,omitempty"`
+	// Strict rules apply only to chats with the strict level.
+	Strict bool `json:"strict,omitempty"`
+}
+
+func (r blockRule) String() string {
+	if r.Regex {
+		return "/" + r.Pattern + "/"
+	}
+	return r.Pattern
+}
+
+// blocklist keeps the rules of a language together with the compiled expressions.
+type blocklist struct {
+	Language  string      `json:"language"`
+	Rules     []blockRule `json:"rules"`
+	UpdatedBy int64       `json:"updatedBy,omitempty"`
+	UpdatedAt time.Time   `json:"updatedAt"`
+	// compiled are the expressions of the rules by index, nil for words and phrases.
+	compiled []*regexp.Regexp
+}
+
+// moderationLevel is the strictness an admin set for a chat.
+type moderationLevel struct {
+	ChatID    int64     `json:"chatId"`
+	Level     string    `json:"level"`
+	By        int64     `json:"by"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// blockedPrompt is the audit record of a refused prompt.
+type blockedPrompt struct {
+	ChatID int64  `json:"chatId"`
+	Prompt string `json:"prompt"`
+	// Language is the blocklist of the rule.
+	Language  string    `json:"language"`
+	Rule      blockRule `json:"rule"`
+	Level     string    `json:"level"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// normalizeWords lowercases the text and keeps only words separated by single spaces,
+// with a space at both ends, so a phrase matches only whole words.
+func normalizeWords(s string) string {
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) == 0 {
+		return ""
+	}
+	return " " + strings.Join(words, " ") + " "
+}
+
+// newBlockRule checks the rule and brings words to the normalized form.
+func newBlockRule(pattern string, regex, strict bool) (blockRule, *regexp.Regexp, error) {
+	pattern = strings.TrimSpace(pattern)
+	if regex {
+		re, err := regexp.Compile("(?i)" + pattern)
+		if err != nil {
+			return blockRule{}, nil, err
+		}
+		return blockRule{Pattern: pattern, Regex: true, Strict: strict}, re, nil
+	}
+	words := strings.TrimSpace(normalizeWords(pattern))
+	if words == "" {
+		return blockRule{}, nil, errors.New("no words in the pattern")
+	}
+	return blockRule{Pattern: words, Strict: strict}, nil, nil
+}
+
+// compile checks all rules, broken ones are dropped.
+func (l *blocklist) compile() {
+	rules := l.Rules[:0]
+	l.compiled = l.compiled[:0]
+	for _, raw := range l.Rules {
+		rule, re, err := newBlockRule(raw.Pattern, raw.Regex, raw.Strict)
+		if err != nil {
+			slog.Warn("Skip broken block rule", "language", l.Language, "pattern", raw.Pattern, "err", err)
+			continue
+		}
+		rules = append(rules, rule)
+		l.compiled = append(l.compiled, re)
+	}
+	l.Rules = rules
+}
+
+// match returns the first rule of the level found in the prompt and the matched part.
+// words is the prompt after normalizeWords.
+func (l *blocklist) match(prompt, words string, strict bool) (blockRule, string, bool) {
+	for i, rule := range l.Rules {
+		if rule.Strict && !strict {
+			continue
+		}
+		if re := l.compiled[i]; re != nil {
+			if found := re.FindString(prompt); found != "" {
+				return rule, found, true
+			}
+			continue
+		}
+		if strings.Contains(words, " "+rule.Pattern+" ") {
+			return rule, rule.Pattern, true
+		}
+	}
+	return blockRule{}, "", false
+}
+
+// readBlocklists reads a file with rules by language: {"en": [{"pattern": "gore"}, ...], ...}.
+func readBlocklists(path string) (map[string][]blockRule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var lists map[string][]blockRule
+	if err := json.Unmarshal(data, &lists); err != nil {
+		return nil, fmt.Errorf("invalid blocklists %s: %w", path, err)
+	}
+	var problems []string
+	for lang, rules := range lists {
+		if !languagePattern.MatchString(lang) {
+			problems = append(problems, fmt.Sprintf("invalid language %q", lang))
+		}
+		for _, rule := range rules {
+			if _, _, err := newBlockRule(rule.Pattern, rule.Regex, rule.Strict); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %q: %v", lang, rule.Pattern, err))
+			}
+		}
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return nil, fmt.Errorf("invalid blocklists %s:\n%s", path, strings.Join(problems, "\n"))
+	}
+	return lists, nil
+}
+
+// loadModeration reads the blocklists and the levels of the chats. An empty store
+// gets the lists from cfg.Moderation.BlocklistPath.
+func (b *Bot) loadModeration() error {
+	lists := make(map[string]*blocklist)
+	err := b.store.ForEach(blocklistsBucket, func(key string, data []byte) error {
+		list := &blocklist{}
+		if err := json.Unmarshal(data, list); err != nil {
+			slog.Warn("Skip broken blocklist", "language", key, "err", err)
+			return nil
+		}
+		list.Language = key
+		list.compile()
+		lists[key] = list
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(lists) == 0 && b.cfg.Moderation.BlocklistPath != "" {
+		seed, err := readBlocklists(b.cfg.Moderation.BlocklistPath)
+		if err != nil {
+			return err
+		}
+		for lang, rules := range seed {
+			list := &blocklist{Language: lang, Rules: rules, UpdatedAt: time.Now()}
+			list.compile()
+			if err := b.store.Put(blocklistsBucket, lang, list); err != nil {
+				return err
+			}
+			lists[lang] = list
+		}
+		slog.Info("Blocklists imported", "path", b.cfg.Moderation.BlocklistPath)
+	}
+	b.moderationMu.Lock()
+	b.blocklists = lists
+	b.moderationMu.Unlock()
+
+	rules := 0
+	for _, list := range lists {
+		rules += len(list.Rules)
+	}
+	slog.Info("Blocklists loaded", "languages", len(lists), "rules", rules)
+
+	return b.store.ForEach(moderationLevelsBucket, func(key string, data []byte) error {
+		var record moderationLevel
+		if err := json.Unmarshal(data, &record); err != nil || !validLevel(record.Level) {
+			slog.Warn("Skip broken moderation level", "key", key)
+			return nil
+		}
+		b.moderationLevels.Store(record.ChatID, record.Level)
+		return nil
+	})
+}
+
+// chatLevel is the strictness of the chat, set by an admin or the default one.
+func (b *Bot) chatLevel(chatID int64) string {
+	if level, ok := b.moderationLevels.Load(chatID); ok {
+		return level.(string)
+	}
+	return b.cfg.Moderation.DefaultLevel
+}
+
+// allowPrompt checks the positive part of the prompt against the blocklists of all languages,
+// since a prompt may be written in any of them. A blocked prompt is recorded for the admins
+// and the user is told which part to rephrase.
+func (b *Bot) allowPrompt(chatID int64, settings *UserSettings, text string) bool {
+	level := b.chatLevel(chatID)
+	if level == moderationOff {
+		return true
+	}
+	prompt, _ := splitPrompt(text, "")
+	words := normalizeWords(prompt)
+
+	b.moderationMu.RLock()
+	languages := make([]string, 0, len(b.blocklists))
+	for lang := range b.blocklists {
+		languages = append(languages, lang)
+	}
+	sort.Strings(languages)
+	var (
+		lang    string
+		rule    blockRule
+		found   string
+		blocked bool
+	)
+	for _, lang = range languages {
+		if rule, found, blocked = b.blocklists[lang].match(prompt, words, level == moderationStrict); blocked {
+			break
+		}
+	}
+	b.moderationMu.RUnlock()
+	if !blocked {
+		return true
+	}
+
+	record := blockedPrompt{ChatID: chatID, Prompt: prompt, Language: lang, Rule: rule, Level: level, CreatedAt: time.Now()}
+	if err := b.store.Put(moderationAuditBucket, uuid.NewString(), record); err != nil {
+		slog.Error("Failed to save blocked prompt", "chat_id", chatID, "err", err)
+	}
+	promptsBlocked.WithLabelValues(lang).Inc()
+	slog.Info("Prompt blocked", "chat_id", chatID, "language", lang, "rule", rule.String(), "level", level)
+	b.tg.Send(tgbotapi.NewMessage(chatID, tr(settings.language, "moderation.blocked", found)))
+	return false
+}
+
+// handleModeration processes the admin command /moderation:
+//
+//	/moderation list [language]
+//	/moderation add <language> [strict] <word or phrase>
+//	/moderation regex <language> [strict] <expression>
+//	/moderation remove <language> <number or pattern>
+//	/moderation level <chat id> <off|normal|strict|default>
+//	/moderation log [count]
+func handleModeration(b *Bot, args string, chatID int64) {
+	if !b.cfg.isAdmin(chatID) {
+		b.tg.Send(tgbotapi.NewMessage(chatID, b.text(chatID, "admin.only")))
+		return
+	}
+	lang := b.getSettings(chatID).language
+	action, rest, _ := strings.Cut(strings.TrimSpace(args), " ")
+	rest = strings.TrimSpace(rest)
+	var text string
+	switch action {
+	case "list":
+		text = b.blocklistsText(lang, rest)
+	case "add", "regex":
+		text = b.addBlockRule(lang, chatID, rest, action == "regex")
+	case "remove":
+		text = b.removeBlockRule(lang, chatID, rest)
+	case "level":
+		text = b.setModerationLevel(lang, chatID, rest)
+	case "log":
+		text = b.moderationLogText(lang, rest)
+	default:
+		text = tr(lang, "moderation.usage", b.cfg.Moderation.DefaultLevel)
+	}
+	for _, part := range splitMessage(text, messageLimit) {
+		b.tg.Send(tgbotapi.NewMessage(chatID, part))
+	}
+}
+
+// blocklistsText lists the rules of one language or of all of them.
+func (b *Bot) blocklistsText(lang, only string) string {
+	b.moderationMu.RLock()
+	defer b.moderationMu.RUnlock()
+	languages := make([]string, 0, len(b.blocklists))
+	for code := range b.blocklists {
+		if only == "" || code == only {
+			languages = append(languages, code)
+		}
+	}
+	sort.Strings(languages)
+	if len(languages) == 0 {
+		return tr(lang, "moderation.list_empty")
+	}
+	var text strings.Builder
+	for _, code := range languages {
+		list := b.blocklists[code]
+		if text.Len() > 0 {
+			text.WriteString("\n\n")
+		}
+		text.WriteString(tr(lang, "moderation.list_title", code, len(list.Rules)))
+		for i, rule := range list.Rules {
+			text.WriteString("\n")
+			text.WriteString(strconv.Itoa(i+1) + ". " + rule.String())
+			if rule.Strict {
+				text.WriteString(tr(lang, "moderation.strict_mark"))
+			}
+		}
+	}
+	return text.String()
+}
+
+// saveBlocklist stores the list after a change. The caller holds moderationMu.
+func (b *Bot) saveBlocklist(list *blocklist, adminID int64) error {
+	list.UpdatedBy, list.UpdatedAt = adminID, time.Now()
+	return b.store.Put(blocklistsBucket, list.Language, list)
+}
+
+func (b *Bot) addBlockRule(lang string, adminID int64, args string, regex bool) string {
+	code, pattern, _ := strings.Cut(args, " ")
+	pattern = strings.TrimSpace(pattern)
+	strict := false
+	if first, rest, found := strings.Cut(pattern, " "); found && first == moderationStrict {
+		strict, pattern = true, strings.TrimSpace(rest)
+	}
+	if !languagePattern.MatchString(code) || pattern == "" {
+		return tr(lang, "moderation.usage", b.cfg.Moderation.DefaultLevel)
+	}
+	rule, re, err := newBlockRule(pattern, regex, strict)
+	if err != nil {
+		return tr(lang, "moderation.invalid_rule", err)
+	}
+
+	b.moderationMu.Lock()
+	defer b.moderationMu.Unlock()
+	list, ok := b.blocklists[code]
+	if !ok {
+		list = &blocklist{Language: code}
+	}
+	for _, existing := range list.Rules {
+		if existing.Pattern == rule.Pattern && existing.Regex == rule.Regex {
+			return tr(lang, "moderation.exists", rule.String(), code)
+		}
+	}
+	updated := *list
+	updated.Rules = append(append([]blockRule(nil), list.Rules...), rule)
+	updated.compiled = append(append([]*regexp.Regexp(nil), list.compiled...), re)
+	if err := b.saveBlocklist(&updated, adminID); err != nil {
+		slog.Error("Failed to save blocklist", "language", code, "err", err)
+		return tr(lang, "moderation.error")
+	}
+	b.blocklists[code] = &updated
+	slog.Info("Block rule added", "language", code, "rule", rule.String(), "strict", strict, "admin_id", adminID)
+	return tr(lang, "moderation.added", rule.String(), code)
+}
+
+// removeBlockRule deletes a rule by its number in the list or by its pattern.
+// An emptied list is kept, so the seed file isn't imported again.
+func (b *Bot) removeBlockRule(lang string, adminID int64, args string) string {
+	code, pattern, _ := strings.Cut(args, " ")
+	pattern = strings.TrimSpace(pattern)
+	if !languagePattern.MatchString(code) || pattern == "" {
+		return tr(lang, "moderation.usage", b.cfg.Moderation.DefaultLevel)
+	}
+
+	b.moderationMu.Lock()
+	defer b.moderationMu.Unlock()
+	list, ok := b.blocklists[code]
+	if !ok {
+		return tr(lang, "moderation.not_found", pattern, code)
+	}
+	index := -1
+	if n, err := strconv.Atoi(pattern); err == nil && n >= 1 && n <= len(list.Rules) {
+		index = n - 1
+	}
+	words := strings.TrimSpace(normalizeWords(pattern))
+	for i, rule := range list.Rules {
+		if index >= 0 {
+			break
+		}
+		if rule.String() == pattern || rule.Pattern == pattern || !rule.Regex && rule.Pattern == words {
+			index = i
+		}
+	}
+	if index < 0 {
+		return tr(lang, "moderation.not_found", pattern, code)
+	}
+	rule := list.Rules[index]
+	updated := *list
+	updated.Rules = append(append([]blockRule(nil), list.Rules[:index]...), list.Rules[index+1:]...)
+	updated.compiled = append(append([]*regexp.Regexp(nil), list.compiled[:index]...), list.compiled[index+1:]...)
+	if err := b.saveBlocklist(&updated, adminID); err != nil {
+		slog.Error("Failed to save blocklist", "language", code, "err", err)
+		return tr(lang, "moderation.error")
+	}
+	b.blocklists[code] = &updated
+	slog.Info("Block rule removed", "language", code, "rule", rule.String(), "admin_id", adminID)
+	return tr(lang, "moderation.removed", rule.String(), code)
+}
+
+// setModerationLevel processes "level <chat id> <level>", "default" returns the chat to the default level.
+func (b *Bot) setModerationLevel(lang string, adminID int64, args string) string {
+	fields := strings.Fields(args)
+	var target int64
+	var err error
+	if len(fields) == 2 {
+		target, err = strconv.ParseInt(fields[0], 10, 64)
+	}
+	if len(fields) != 2 || err != nil || fields[1] != "default" && !validLevel(fields[1]) {
+		return tr(lang, "moderation.usage", b.cfg.Moderation.DefaultLevel)
+	}
+	key := strconv.FormatInt(target, 10)
+	level := fields[1]
+	if level == "default" {
+		if err := b.store.Delete(moderationLevelsBucket, key); err != nil {
+			slog.Error("Failed to delete moderation level", "chat_id", target, "err", err)
+			return tr(lang, "moderation.error")
+		}
+		b.moderationLevels.Delete(target)
+		level = b.cfg.Moderation.DefaultLevel
+	} else {
+		record := moderationLevel{ChatID: target, Level: level, By: adminID, CreatedAt: time.Now()}
+		if err := b.store.Put(moderationLevelsBucket, key, record); err != nil {
+			slog.Error("Failed to save moderation level", "chat_id", target, "err", err)
+			return tr(lang, "moderation.error")
+		}
+		b.moderationLevels.Store(target, level)
+	}
+	slog.Info("Moderation level changed", "chat_id", target, "level", level, "admin_id", adminID)
+	return tr(lang, "moderation.level_set", target, level)
+}
+
+// moderationLogText shows the latest blocked prompts, the newest first.
+func (b *Bot) moderationLogText(lang, args string) string {
+	count := moderationAuditShown
+	if args != "" {
+		n, err := strconv.Atoi(args)
+		if err != nil || n <= 0 {
+			return tr(lang, "moderation.usage", b.cfg.Moderation.DefaultLevel)
+		}
+		count = min(n, moderationAuditMaxShown)
+	}
+	var records []blockedPrompt
+	err := b.store.ForEach(moderationAuditBucket, func(_ string, data []byte) error {
+		var record blockedPrompt
+		if err := json.Unmarshal(data, &record); err == nil {
+			records = append(records, record)
+		}
+		return nil
+	})
+	if err != nil {
+		slog.Error("Failed to load blocked prompts", "err", err)
+		return tr(lang, "moderation.error")
+	}
+	if len(records) == 0 {
+		return tr(lang, "moderation.log_empty")
+	}
+	sort.Slice(records, func(i, k int) bool { return records[i].CreatedAt.After(records[k].CreatedAt) })
+	records = records[:min(len(records), count)]
+
+	var text strings.Builder
+	text.WriteString(tr(lang, "moderation.log_title", len(records)))
+	for _, record := range records {
+		text.WriteString("\n\n")
+		text.WriteString(tr(lang, "moderation.log_entry", record.CreatedAt.Format("02.01.2006 15:04"), record.ChatID,
+			record.Level, record.Language, record.Rule.String(), record.Prompt))
+	}
+	return text.String()
+}
+
+// splitMessage cuts the text by lines into parts no longer than limit bytes.
+func splitMessage(text string, limit int) []string {
+	var parts []string
+	for len(text) > limit {
+		cut := strings.LastIndexByte(text[:limit], '\n')
+		if cut <= 0 {
+			cut = limit
+			// Не разрезаем символ посередине
+			for cut > 0 && !utf8.RuneStart(text[cut]) {
+				cut--
+			}
+		}
+		parts = append(parts, text[:cut])
+		text = strings.TrimLeft(text[cut:], "\n")
+	}
+	return append(parts, text)
+}
@@ -0,0 +1,205 @@
+package tgBot
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/MTUCI-Pixel-Team/Picture_Generator/storage"
+)
+
+func TestNormalizeWords(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"", ""},
+		{"  ,.! ", ""},
+		{"Cat", " cat "},
+		{"A  cat, on\tthe SOFA!", " a cat on the sofa "},
+		{"КОШКА на Диване", " кошка на диване "},
+		{"r2-d2", " r2 d2 "},
+	}
+	for _, tt := range tests {
+		if got := normalizeWords(tt.in); got != tt.want {
+			t.Errorf("normalizeWords(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func testBlocklist(t *testing.T) *blocklist {
+	list := &blocklist{Language: "en", Rules: []blockRule{
+		{Pattern: "gore"},
+		{Pattern: "Blood Bath"},
+		{Pattern: "кровь"},
+		{Pattern: `k[i1]ll(ing)?`, Regex: true},
+		{Pattern: "nude", Strict: true},
+		{Pattern: "(", Regex: true}, // Сломанное выражение отбрасывается
+	}}
+	list.compile()
+	if len(list.Rules) != 5 || len(list.compiled) != 5 {
+		t.Fatalf("compiled %d rules, want 5", len(list.Rules))
+	}
+	return list
+}
+
+func TestBlocklistMatch(t *testing.T) {
+	list := testBlocklist(t)
+	tests := []struct {
+		name   string
+		prompt string
+		strict bool
+		want   string // Найденная часть, пусто - промпт разрешён
+	}{
+		{"word", "a gore scene", false, "gore"},
+		{"case folding", "GORE everywhere", false, "gore"},
+		{"part of a word", "ignore the gorest", false, ""},
+		{"phrase across punctuation", "after the blood, bath!", false, "blood bath"},
+		{"phrase words apart", "blood and a bath", false, ""},
+		{"cyrillic", "Кровь на снегу", false, "кровь"},
+		{"cyrillic part of a word", "кровью", false, ""},
+		{"regex case-insensitive", "K1LLING time", false, "K1LLING"},
+		{"strict rule at normal level", "nude portrait", false, ""},
+		{"strict rule at strict level", "nude portrait", true, "nude"},
+		{"clean", "a cat on a sofa", true, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, found, blocked := list.match(tt.prompt, normalizeWords(tt.prompt), tt.strict)
+			if blocked != (tt.want != "") || found != tt.want {
+				t.Errorf("found %q, blocked %v, want %q", found, blocked, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadBlocklists(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string // Части ошибки, пусто - файл правильный
+	}{
+		{"valid", `{"en": [{"pattern": "gore"}, {"pattern": "k[i1]ll", "regex": true}], "ru": [{"pattern": "кровь", "strict": true}]}`, nil},
+		{"bad json", `{"en": [`, []string{"invalid blocklists"}},
+		{"bad language", `{"EN": [{"pattern": "gore"}]}`, []string{`invalid language "EN"`}},
+		{"no words", `{"en": [{"pattern": " !? "}]}`, []string{"no words in the pattern"}},
+		{"bad regex", `{"en": [{"pattern": "(", "regex": true}]}`, []string{`en: "("`}},
+		{"all problems", `{"english": [{"pattern": ""}], "ru": [{"pattern": "[", "regex": true}]}`,
+			[]string{`invalid language "english"`, `english: ""`, `ru: "["`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "blocklists.json")
+			os.WriteFile(path, []byte(tt.content), 0o600)
+			lists, err := readBlocklists(path)
+			if tt.want == nil {
+				if err != nil || len(lists["en"]) != 2 || len(lists["ru"]) != 1 {
+					t.Fatalf("got %v, err %v", lists, err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("invalid blocklists are read")
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error %q doesn't mention %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRemoveBlockRule(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    string
+		removed string // Удалённое правило, пусто - ничего не удалено
+	}{
+		{"by number", "en 2", "blood bath"},
+		{"by word", "en gore", "gore"},
+		{"by phrase in another form", "en Blood,  BATH", "blood bath"},
+		{"by expression", "en /k[i1]ll/", "/k[i1]ll/"},
+		{"by bare expression", "en k[i1]ll", "/k[i1]ll/"},
+		{"number out of range is a pattern", "en 4", ""},
+		{"zero", "en 0", ""},
+		{"unknown pattern", "en gorey", ""},
+		{"unknown language", "de gore", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &Bot{store: storage.NewMemoryStore(), blocklists: map[string]*blocklist{}}
+			b.addBlockRule("en", 1, "en gore", false)
+			b.addBlockRule("en", 1, "en strict blood bath", false)
+			b.addBlockRule("en", 1, "en k[i1]ll", true)
+
+			b.removeBlockRule("en", 1, tt.args)
+			left := map[string]bool{}
+			for _, rule := range b.blocklists["en"].Rules {
+				left[rule.String()] = true
+			}
+			want := 3
+			if tt.removed != "" {
+				want = 2
+				if left[tt.removed] {
+					t.Errorf("%s is not removed", tt.removed)
+				}
+			}
+			if len(left) != want || len(b.blocklists["en"].compiled) != want {
+				t.Errorf("rules left: %v", left)
+			}
+			// Список в хранилище совпадает со списком в памяти
+			var stored blocklist
+			b.store.Get(blocklistsBucket, "en", &stored)
+			if len(stored.Rules) != want {
+				t.Errorf("%d rules stored, want %d", len(stored.Rules), want)
+			}
+		})
+	}
+}
+
+func TestSplitMessage(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		limit int
+		want  []string
+	}{
+		{"short", "one\ntwo", 10, []string{"one\ntwo"}},
+		{"exact", "0123456789", 10, []string{"0123456789"}},
+		{"by lines", "one\ntwo\nthree", 8, []string{"one\ntwo", "three"}},
+		{"empty lines are dropped at the cut", "one\n\n\ntwo", 4, []string{"one", "two"}},
+		{"long line", "abcdefghij", 4, []string{"abcd", "efgh", "ij"}},
+		// Кириллица занимает два байта, символ не режется посередине
+		{"long cyrillic line", "абвгд", 5, []string{"аб", "вг", "д"}},
+		{"long line after a short one", "ab\nабвгдежз", 5, []string{"ab", "аб", "вг", "де", "жз"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitMessage(tt.text, tt.limit)
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+			for _, part := range got {
+				if len(part) > tt.limit || !utf8.ValidString(part) {
+					t.Errorf("bad part %q", part)
+				}
+			}
+		})
+	}
+}
+
+func TestPruneModerationAudit(t *testing.T) {
+	b := &Bot{store: storage.NewMemoryStore()}
+	b.store.Put(moderationAuditBucket, "old", blockedPrompt{ChatID: 1, CreatedAt: time.Now().Add(-moderationAuditRetention - time.Hour)})
+	b.store.Put(moderationAuditBucket, "new", blockedPrompt{ChatID: 1, CreatedAt: time.Now()})
+	b.pruneAll()
+	if found, _ := b.store.Get(moderationAuditBucket, "old", &blockedPrompt{}); found {
+		t.Error("expired record is kept")
+	}
+	if found, _ := b.store.Get(moderationAuditBucket, "new", &blockedPrompt{}); !found {
+		t.Error("fresh record is deleted")
+	}
+}
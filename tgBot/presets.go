@@ -0,0 +1,174 @@
+package tgBot
+
+import (
+	"encoding/json"
+	"log/slog"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	presetsBucket       = "presets"
+	maxPresetsPerUser   = 20
+	presetNameMaxLength = 32
+)
+
+// preset is a named snapshot of the generation settings. Settings are kept as settingsRecord,
+// so presets are migrated together with the user settings.
+type preset struct {
+	ChatID   int64           `json:"chatId"`
+	Name     string          `json:"name"`
+	Settings json.RawMessage `json:"settings"`
+}
+
+func presetKey(chatID int64, name string) string {
+	return chatKey(chatID, name)
+}
+
+// loadPresets returns the presets of the chat sorted by name.
+func (b *Bot) loadPresets(chatID int64) []preset {
+	var presets []preset
+	err := b.store.ForEachPrefix(presetsBucket, chatPrefix(chatID), func(key string, data []byte) error {
+		var p preset
+		if err := json.Unmarshal(data, &p); err != nil {
+			slog.Warn("Skip broken preset", "key", key, "err", err)
+			return nil
+		}
+		presets = append(presets, p)
+		return nil
+	})
+	if err != nil {
+		slog.Error("Failed to load presets", "chat_id", chatID, "err", err)
+	}
+	sort.Slice(presets, func(i, k int) bool { return presets[i].Name < presets[k].Name })
+	return presets
+}
+
+// applyPreset copies the generation fields of the preset, the language and the menu state stay as they are.
+func applyPreset(settings *UserSettings, p preset) error {
+	saved, err := decodeSettings(p.Settings)
+	if err != nil {
+		return err
+	}
+	settings.model = saved.model
+	settings.steps = saved.steps
+	settings.width = saved.width
+	settings.heigth = saved.heigth
+	settings.numberResults = saved.numberResults
+	settings.scheduler = saved.scheduler
+	settings.negativePrompt = saved.negativePrompt
+	settings.seed = saved.seed
+	settings.cfgScale = saved.cfgScale
+	settings.strength = saved.strength
+	settings.enhance = saved.enhance
+	return nil
+}
+
+// handlePreset processes /preset save|load|list|delete <name>.
+func handlePreset(b *Bot, args string, chatID int64) {
+	settings := b.getSettings(chatID)
+	action, name, _ := strings.Cut(args, " ")
+	name = strings.TrimSpace(name)
+	switch action {
+	case "save":
+		if name == "" || utf8.RuneCountInString(name) > presetNameMaxLength || strings.HasPrefix(name, "/") {
+			b.tg.Send(tgbotapi.NewMessage(chatID, tr(settings.language, "preset.invalid_name", presetNameMaxLength)))
+			return
+		}
+		var existing preset
+		found, _ := b.store.Get(presetsBucket, presetKey(chatID, name), &existing)
+		if !found && len(b.loadPresets(chatID)) >= maxPresetsPerUser {
+			b.tg.Send(tgbotapi.NewMessage(chatID, tr(settings.language, "preset.limit", maxPresetsPerUser)))
+			return
+		}
+		record, _ := json.Marshal(settings.record())
+		if err := b.store.Put(presetsBucket, presetKey(chatID, name), preset{ChatID: chatID, Name: name, Settings: record}); err != nil {
+			slog.Error("Failed to save preset", "chat_id", chatID, "err", err)
+			b.tg.Send(tgbotapi.NewMessage(chatID, tr(settings.language, "preset.error")))
+			return
+		}
+		b.tg.Send(tgbotapi.NewMessage(chatID, tr(settings.language, "preset.saved", name)))
+	case "load":
+		if name == "" {
+			showPresets(b, settings, chatID)
+			return
+		}
+		loadPreset(b, settings, name, chatID)
+	case "delete":
+		if name == "" {
+			b.tg.Send(tgbotapi.NewMessage(chatID, tr(settings.language, "preset.usage")))
+			return
+		}
+		found, err := b.store.Get(presetsBucket, presetKey(chatID, name), &preset{})
+		if err != nil || !found {
+			b.tg.Send(tgbotapi.NewMessage(chatID, tr(settings.language, "preset.not_found", name)))
+			return
+		}
+		b.store.Delete(presetsBucket, presetKey(chatID, name))
+		b.tg.Send(tgbotapi.NewMessage(chatID, tr(settings.language, "preset.deleted", name)))
+	case "list", "":
+		showPresets(b, settings, chatID)
+	default:
+		b.tg.Send(tgbotapi.NewMessage(chatID, tr(settings.language, "preset.usage")))
+	}
+}
+
+// showPresets lists the presets and shows a keyboard to load one of them.
+func showPresets(b *Bot, settings *UserSettings, chatID int64) {
+	presets := b.loadPresets(chatID)
+	if len(presets) == 0 {
+		b.tg.Send(tgbotapi.NewMessage(chatID, tr(settings.language, "preset.empty")))
+		return
+	}
+	var text strings.Builder
+	text.WriteString(tr(settings.language, "preset.list"))
+	names := make([]string, 0, len(presets))
+	for _, p := range presets {
+		saved, err := decodeSettings(p.Settings)
+		if err != nil {
+			continue
+		}
+		model, ok := options().modelName(saved.model)
+		if !ok {
+			model = saved.model
+		}
+		text.WriteString("\n")
+		text.WriteString(tr(settings.language, "preset.item", p.Name, model, saved.width, saved.heigth, saved.steps))
+		names = append(names, p.Name)
+	}
+	msg := tgbotapi.NewMessage(chatID, text.String())
+	keyboard := getPresetsMarkup(names)
+	msg.ReplyMarkup = tgbotapi.NewReplyKeyboard(keyboard...)
+	b.tg.Send(msg)
+	settings.state = "choosePreset"
+	b.userSettings.Store(chatID, settings)
+}
+
+// handlePresetChoice loads the preset chosen on the keyboard.
+func handlePresetChoice(b *Bot, message string, chatID int64) {
+	loadPreset(b, b.getSettings(chatID), message, chatID)
+}
+
+func loadPreset(b *Bot, settings *UserSettings, name string, chatID int64) {
+	var p preset
+	found, err := b.store.Get(presetsBucket, presetKey(chatID, name), &p)
+	if err != nil || !found {
+		b.tg.Send(tgbotapi.NewMessage(chatID, tr(settings.language, "preset.not_found", name)))
+		return
+	}
+	if err := applyPreset(settings, p); err != nil {
+		slog.Error("Failed to load preset", "chat_id", chatID, "preset", name, "err", err)
+		b.tg.Send(tgbotapi.NewMessage(chatID, tr(settings.language, "preset.error")))
+		return
+	}
+	settings.state = "done"
+	b.saveSettings(chatID, settings)
+
+	msg := tgbotapi.NewMessage(chatID, tr(settings.language, "preset.loaded", name))
+	defaultKeyboard := getDefaultMarkup(settings.language)
+	msg.ReplyMarkup = tgbotapi.NewReplyKeyboard(defaultKeyboard...)
+	b.tg.Send(msg)
+}
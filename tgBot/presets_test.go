@@ -0,0 +1,113 @@
+package tgBot
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/MTUCI-Pixel-Team/Picture_Generator/storage"
+)
+
+func TestPresetSaveAndLoad(t *testing.T) {
+	b, client := newJobBot(t, storage.NewMemoryStore())
+	settings := b.getSettings(1)
+	settings.model, settings.steps, settings.width, settings.heigth = "civitai:15003@114429", 30, 768, 512
+	settings.negativePrompt, settings.seed, settings.cfgScale, settings.enhance = "blurry", 42, 9, true
+	handlePreset(b, "save night", 1)
+	if !slices.Contains(client.sentTexts(), tr("", "preset.saved", "night")) {
+		t.Fatalf("preset is not saved: %q", client.sentTexts())
+	}
+
+	*settings = *newDefaultSettings()
+	settings.language = "ru"
+	handlePreset(b, "load night", 1)
+	if settings.model != "civitai:15003@114429" || settings.steps != 30 || settings.width != 768 || settings.heigth != 512 ||
+		settings.negativePrompt != "blurry" || settings.seed != 42 || settings.cfgScale != 9 || !settings.enhance {
+		t.Errorf("settings are not restored: %+v", settings)
+	}
+	// Язык не входит в пресет
+	if settings.language != "ru" || settings.state != "done" {
+		t.Errorf("language %q and state %q", settings.language, settings.state)
+	}
+	if !slices.Contains(client.sentTexts(), tr("ru", "preset.loaded", "night")) {
+		t.Errorf("no confirmation in %q", client.sentTexts())
+	}
+	var saved settingsRecord
+	if found, _ := b.store.Get(settingsBucket, "1", &saved); !found || saved.Seed != 42 {
+		t.Errorf("loaded settings are not stored: %+v", saved)
+	}
+}
+
+func TestPresetSaveChecks(t *testing.T) {
+	b, client := newJobBot(t, storage.NewMemoryStore())
+	for _, name := range []string{"", strings.Repeat("я", presetNameMaxLength+1), "/start"} {
+		handlePreset(b, "save "+name, 1)
+	}
+	if n := strings.Count(strings.Join(client.sentTexts(), "\n"), tr("", "preset.invalid_name", presetNameMaxLength)); n != 3 {
+		t.Errorf("%d names refused, want 3: %q", n, client.sentTexts())
+	}
+
+	for i := range maxPresetsPerUser {
+		handlePreset(b, fmt.Sprintf("save p%02d", i), 1)
+	}
+	handlePreset(b, "save one more", 1)
+	if !slices.Contains(client.sentTexts(), tr("", "preset.limit", maxPresetsPerUser)) {
+		t.Error("preset over the limit is saved")
+	}
+	// Перезапись существующего пресета не упирается в лимит
+	handlePreset(b, "save p00", 1)
+	if texts := client.sentTexts(); texts[len(texts)-1] != tr("", "preset.saved", "p00") {
+		t.Errorf("preset is not overwritten: %q", texts[len(texts)-1])
+	}
+	if n := len(b.loadPresets(1)); n != maxPresetsPerUser {
+		t.Errorf("%d presets kept", n)
+	}
+}
+
+func TestPresetDelete(t *testing.T) {
+	b, client := newJobBot(t, storage.NewMemoryStore())
+	handlePreset(b, "save night", 1)
+	handlePreset(b, "save night", 2)
+
+	handlePreset(b, "delete night", 1)
+	if !slices.Contains(client.sentTexts(), tr("", "preset.deleted", "night")) {
+		t.Fatalf("preset is not deleted: %q", client.sentTexts())
+	}
+	handlePreset(b, "delete night", 1)
+	handlePreset(b, "load night", 1)
+	if n := strings.Count(strings.Join(client.sentTexts(), "\n"), tr("", "preset.not_found", "night")); n != 2 {
+		t.Errorf("deleted preset is found: %q", client.sentTexts())
+	}
+	if presets := b.loadPresets(2); len(presets) != 1 {
+		t.Errorf("preset of another chat is deleted, %d left", len(presets))
+	}
+}
+
+func TestPresetWithRemovedModel(t *testing.T) {
+	c := builtinCatalog
+	c.Models = append(slices.Clone(c.Models), ModelOption{Name: "Retired", AIR: "civitai:1@1"})
+	currentCatalog.Store(&c)
+	defer currentCatalog.Store(&builtinCatalog)
+
+	b, client := newJobBot(t, storage.NewMemoryStore())
+	settings := b.getSettings(1)
+	settings.model = "civitai:1@1"
+	handlePreset(b, "save old", 1)
+	// Модель убрали из каталога после сохранения пресета
+	currentCatalog.Store(&builtinCatalog)
+	settings.model = builtinCatalog.Defaults.Model
+
+	handlePreset(b, "list", 1)
+	if want := tr("", "preset.item", "old", "civitai:1@1", settings.width, settings.heigth, settings.steps); !strings.Contains(strings.Join(client.sentTexts(), "\n"), want) {
+		t.Errorf("list does not show the model id: %q", client.sentTexts())
+	}
+	// Как и после перезагрузки каталога, модель остаётся выбранной, пока пользователь её не сменит
+	handlePreset(b, "load old", 1)
+	if settings.model != "civitai:1@1" {
+		t.Errorf("model %q", settings.model)
+	}
+	if !slices.Contains(client.sentTexts(), tr("", "preset.loaded", "old")) {
+		t.Errorf("preset is not loaded: %q", client.sentTexts())
+	}
+}
@@ -0,0 +1,25 @@
+package tgBot
+
+import "strings"
+
+// negativeSeparator splits a message into positive and negative prompts: "cat on a sofa || blurry, watermark".
+const negativeSeparator = "||"
+
+// splitCommand separates "/command arguments". For an ordinary text command is the whole text.
+func splitCommand(text string) (command, args string) {
+	if !strings.HasPrefix(text, "/") {
+		return text, ""
+	}
+	command, args, _ = strings.Cut(text, " ")
+	return command, strings.TrimSpace(args)
+}
+
+// splitPrompt returns the positive prompt and the negative one. If the text has no separator,
+// the default negative prompt of the user is used.
+func splitPrompt(text, defaultNegative string) (positive, negative string) {
+	positive, negative, found := strings.Cut(text, negativeSeparator)
+	if !found {
+		return strings.TrimSpace(text), defaultNegative
+	}
+	return strings.TrimSpace(positive), strings.TrimSpace(negative)
+}
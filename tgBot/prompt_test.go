@@ -0,0 +1,89 @@
+package tgBot
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/MTUCI-Pixel-Team/Picture_Generator/storage"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestSplitCommand(t *testing.T) {
+	tests := []struct {
+		text        string
+		wantCommand string
+		wantArgs    string
+	}{
+		{"/seed 42", "/seed", "42"},
+		{"/seed", "/seed", ""},
+		{"/seed   42  ", "/seed", "42"},
+		{"/negative blurry, watermark", "/negative", "blurry, watermark"},
+		{"/preset save my style", "/preset", "save my style"},
+		{"a cat on a sofa", "a cat on a sofa", ""},
+		{"", "", ""},
+	}
+	for _, tt := range tests {
+		command, args := splitCommand(tt.text)
+		if command != tt.wantCommand || args != tt.wantArgs {
+			t.Errorf("%q: got %q and %q, want %q and %q", tt.text, command, args, tt.wantCommand, tt.wantArgs)
+		}
+	}
+}
+
+func TestSplitPrompt(t *testing.T) {
+	tests := []struct {
+		name         string
+		text         string
+		wantPositive string
+		wantNegative string
+	}{
+		{"no separator keeps the default", " a cat on a sofa ", "a cat on a sofa", "default"},
+		{"inline negative", "a cat on a sofa || blurry, watermark", "a cat on a sofa", "blurry, watermark"},
+		{"no spaces", "a cat||blurry", "a cat", "blurry"},
+		{"empty negative clears the default", "a cat ||", "a cat", ""},
+		{"empty positive", "|| blurry", "", "blurry"},
+		{"only the separator", "||", "", ""},
+		{"first separator splits", "a cat || blurry || watermark", "a cat", "blurry || watermark"},
+		{"single bar is text", "a cat | a dog", "a cat | a dog", "default"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			positive, negative := splitPrompt(tt.text, "default")
+			if positive != tt.wantPositive || negative != tt.wantNegative {
+				t.Errorf("got %q and %q, want %q and %q", positive, negative, tt.wantPositive, tt.wantNegative)
+			}
+		})
+	}
+}
+
+func TestSubmitJobChecksInlineNegative(t *testing.T) {
+	tests := []struct {
+		name     string
+		negative string
+		queued   bool
+	}{
+		{"at the limit", strings.Repeat("a", negativePromptMaxLength), true},
+		{"too long", strings.Repeat("a", negativePromptMaxLength+1), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &recordingTelegram{}
+			api, err := tgbotapi.NewBotAPIWithClient("1:token", tgbotapi.APIEndpoint, client)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b := &Bot{tg: api, store: storage.NewMemoryStore(), queue: newJobQueue(10, 10), ctx: context.Background()}
+			b.submitJob(1, b.getSettings(1), "a cat on a sofa || "+tt.negative, "")
+
+			if pending, _ := b.queue.depth(); (pending == 1) != tt.queued {
+				t.Errorf("%d jobs queued", pending)
+			}
+			tooLong := tr("", "negative.too_long", negativePromptMaxLength)
+			if told := slices.Contains(client.sentTexts(), tooLong); told == tt.queued {
+				t.Errorf("user is told the negative prompt is too long: %v", told)
+			}
+		})
+	}
+}
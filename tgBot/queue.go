@@ -0,0 +1,259 @@
+package tgBot
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/MTUCI-Pixel-Team/Picture_Generator/generator"
+	"github.com/MTUCI-Pixel-Team/Picture_Generator/logging"
+	"github.com/google/uuid"
+)
+
+var (
+	errQueueFull = errors.New("generation queue is full")
+	errUserLimit = errors.New("too many jobs of the user")
+	// errQueueClosed is returned while the bot is shutting down.
+	errQueueClosed = errors.New("generation queue is closed")
+)
+
+type jobKind int
+
+const (
+	jobGenerate jobKind = iota
+	jobUpscale
+	jobRemoveBackground
+	jobEnhance
+	jobDescribe
+)
+
+func (k jobKind) String() string {
+	switch k {
+	case jobGenerate:
+		return "generate"
+	case jobUpscale:
+		return "upscale"
+	case jobRemoveBackground:
+		return "remove_background"
+	case jobEnhance:
+		return "enhance"
+	case jobDescribe:
+		return "describe"
+	}
+	return "unknown"
+}
+
+// job is a single request to the generator waiting in the queue or being processed.
+type job struct {
+	id        string
+	kind      jobKind
+	chatID    int64
+	prompt    string
+	negative  string
+	photo     string       // file_id фото для image-to-image
+	settings  UserSettings // Снимок настроек на момент отправки
+	image     storedImage  // Картинка для обработки (upscale, удаление фона, описание)
+	factor    int
+	statusMsg int
+	// charged and chargedImages are the price taken from the quota of the chat in the period chargedPeriod.
+	charged       int
+	chargedImages int
+	chargedPeriod time.Time
+	// lang is the language of the chat when the job was submitted. Workers use it instead of
+	// the live settings, which the update loop changes without a lock.
+	lang string
+	// statusText replaces the queue position in the status message when the job starts.
+	statusText string
+	createdAt  time.Time
+	// ready is closed once the status message is sent, the worker waits for it before starting.
+	ready chan struct{}
+	// log adds chat_id, job_id and task_uuid to every line about the job.
+	log    *slog.Logger
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// jobQueue is a FIFO of generation jobs shared by a pool of workers.
+// A user never has more than one job running at a time, the rest of their jobs wait in order.
+type jobQueue struct {
+	mu         sync.Mutex
+	cond       *sync.Cond
+	pending    []*job
+	running    map[int64]*job
+	perUser    map[int64]int // Задачи пользователя в очереди и в работе
+	maxSize    int
+	maxPerUser int
+	closed     bool
+	lastID     atomic.Uint64
+}
+
+func newJobQueue(maxSize, maxPerUser int) *jobQueue {
+	q := &jobQueue{
+		running:    make(map[int64]*job),
+		perUser:    make(map[int64]int),
+		maxSize:    maxSize,
+		maxPerUser: maxPerUser,
+	}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+// newJob creates a job with a context derived from parent. The caller fills in the parameters of its kind.
+// The context carries the logger of the job and the taskUUID for the generator.
+func (q *jobQueue) newJob(parent context.Context, kind jobKind, chatID int64) *job {
+	id := strconv.FormatUint(q.lastID.Add(1), 10)
+	taskUUID := uuid.NewString()
+	logger := slog.With("chat_id", chatID, "job_id", id, "task_uuid", taskUUID, "kind", kind.String())
+	ctx, cancel := context.WithCancel(generator.WithTaskUUID(logging.WithLogger(parent, logger), taskUUID))
+	return &job{
+		id:        id,
+		kind:      kind,
+		chatID:    chatID,
+		createdAt: time.Now(),
+		ready:     make(chan struct{}),
+		log:       logger,
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+}
+
+// push adds the job to the end of the queue and returns its position starting from 1.
+func (q *jobQueue) push(j *job) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		j.cancel()
+		return 0, errQueueClosed
+	}
+	if len(q.pending) >= q.maxSize {
+		j.cancel()
+		return 0, errQueueFull
+	}
+	if q.perUser[j.chatID] >= q.maxPerUser {
+		j.cancel()
+		return 0, errUserLimit
+	}
+	q.pending = append(q.pending, j)
+	q.perUser[j.chatID]++
+	q.cond.Signal()
+	return len(q.pending), nil
+}
+
+// next blocks until there is a job whose user has nothing running.
+// It returns nil when the queue is closed and no jobs are left.
+func (q *jobQueue) next() *job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for {
+		if q.closed && len(q.pending) == 0 {
+			return nil
+		}
+		for i, j := range q.pending {
+			if _, busy := q.running[j.chatID]; busy {
+				continue
+			}
+			q.pending = append(q.pending[:i], q.pending[i+1:]...)
+			q.running[j.chatID] = j
+			return j
+		}
+		q.cond.Wait()
+	}
+}
+
+func (q *jobQueue) done(j *job) {
+	j.cancel()
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.running, j.chatID)
+	q.release(j.chatID)
+	// Могла освободиться очередь другого задания этого пользователя
+	q.cond.Broadcast()
+}
+
+func (q *jobQueue) release(chatID int64) {
+	q.perUser[chatID]--
+	if q.perUser[chatID] <= 0 {
+		delete(q.perUser, chatID)
+	}
+}
+
+// cancelUser removes waiting jobs of the user from the queue and cancels the running one.
+// The running job is still finished by its worker.
+func (q *jobQueue) cancelUser(chatID int64) (removed []*job, running *job) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	pending := q.pending[:0]
+	for _, j := range q.pending {
+		if j.chatID != chatID {
+			pending = append(pending, j)
+			continue
+		}
+		j.cancel()
+		q.release(chatID)
+		removed = append(removed, j)
+	}
+	clear(q.pending[len(pending):])
+	q.pending = pending
+
+	if running = q.running[chatID]; running != nil {
+		running.cancel()
+	}
+	return removed, running
+}
+
+// depth returns the number of waiting and running jobs.
+func (q *jobQueue) depth() (pending, running int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.pending), len(q.running)
+}
+
+// close stops accepting jobs. Workers still finish the jobs that are already queued.
+func (q *jobQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.cond.Broadcast()
+}
+
+// cancelAll removes all waiting jobs from the queue and cancels them together with the running ones.
+// Running jobs are still finished by their workers.
+func (q *jobQueue) cancelAll() (removed, running []*job) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	removed = q.pending
+	for _, j := range removed {
+		j.cancel()
+		q.release(j.chatID)
+	}
+	q.pending = nil
+	for _, j := range q.running {
+		j.cancel()
+		running = append(running, j)
+	}
+	q.cond.Broadcast()
+	return removed, running
+}
+
+// work runs n workers that pass jobs to handle until the queue is closed and empty.
+func (q *jobQueue) work(n int, wg *sync.WaitGroup, handle func(*job)) {
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				j := q.next()
+				if j == nil {
+					return
+				}
+				<-j.ready
+				handle(j)
+				q.done(j)
+			}
+		}()
+	}
+}
@@ -0,0 +1,240 @@
+package tgBot
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func testJob(q *jobQueue, chatID int64) *job {
+	j := q.newJob(context.Background(), jobGenerate, chatID)
+	close(j.ready)
+	return j
+}
+
+// nextWithin returns the next job or nil if next is still blocked after d.
+// A blocked call returns once the queue is closed and emptied.
+func nextWithin(q *jobQueue, d time.Duration) *job {
+	got := make(chan *job, 1)
+	go func() { got <- q.next() }()
+	select {
+	case j := <-got:
+		return j
+	case <-time.After(d):
+		return nil
+	}
+}
+
+func TestJobQueueOrder(t *testing.T) {
+	tests := []struct {
+		name  string
+		chats []int64 // Чаты заданий в порядке отправки
+		// running are chats whose first job is taken before the check.
+		running []int64
+		want    []int64 // Чаты заданий в порядке выдачи
+	}{
+		{"fifo", []int64{1, 2, 3}, nil, []int64{1, 2, 3}},
+		{"second job of a user waits", []int64{1, 1, 2}, []int64{1}, []int64{2}},
+		{"other users overtake a busy one", []int64{1, 1, 1, 2, 3}, []int64{1}, []int64{2, 3}},
+		{"first free job wins", []int64{1, 2, 1, 3}, []int64{1, 2}, []int64{3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := newJobQueue(10, 10)
+			for _, chatID := range tt.chats {
+				if _, err := q.push(testJob(q, chatID)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, chatID := range tt.running {
+				if j := q.next(); j == nil || j.chatID != chatID {
+					t.Fatalf("running job of chat %d is not taken first: %+v", chatID, j)
+				}
+			}
+			for _, chatID := range tt.want {
+				j := nextWithin(q, time.Second)
+				if j == nil || j.chatID != chatID {
+					t.Fatalf("got job %+v, want chat %d", j, chatID)
+				}
+			}
+			// Остальные задания ждут, пока у их пользователей что-то выполняется
+			if pending, _ := q.depth(); pending > 0 {
+				if j := nextWithin(q, 50*time.Millisecond); j != nil {
+					t.Fatalf("job of busy chat %d is given out", j.chatID)
+				}
+			}
+			q.close()
+			q.cancelAll()
+		})
+	}
+}
+
+func TestJobQueueSecondJobWaitsForFirst(t *testing.T) {
+	q := newJobQueue(10, 10)
+	first, second := testJob(q, 1), testJob(q, 1)
+	q.push(first)
+	q.push(second)
+	if j := q.next(); j != first {
+		t.Fatal("first job is not given out first")
+	}
+	got := make(chan *job, 1)
+	go func() { got <- q.next() }()
+	select {
+	case <-got:
+		t.Fatal("second job started while the first one runs")
+	case <-time.After(50 * time.Millisecond):
+	}
+	q.done(first)
+	select {
+	case j := <-got:
+		if j != second {
+			t.Fatal("wrong job after the first one finished")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("second job doesn't start after the first one finished")
+	}
+}
+
+func TestJobQueuePushLimits(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxSize    int
+		maxPerUser int
+		chats      []int64
+		closed     bool
+		wantErr    error
+	}{
+		{"fits", 3, 3, []int64{1, 1, 2}, false, nil},
+		{"user limit", 10, 2, []int64{1, 1, 1}, false, errUserLimit},
+		{"other user is not limited", 10, 2, []int64{1, 1, 2}, false, nil},
+		{"queue full", 2, 5, []int64{1, 2, 3}, false, errQueueFull},
+		{"closed", 10, 10, []int64{1}, true, errQueueClosed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := newJobQueue(tt.maxSize, tt.maxPerUser)
+			if tt.closed {
+				q.close()
+			}
+			var err error
+			var last *job
+			for i, chatID := range tt.chats {
+				last = testJob(q, chatID)
+				var position int
+				position, err = q.push(last)
+				if err == nil && position != i+1 {
+					t.Errorf("position %d, want %d", position, i+1)
+				}
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil && last.ctx.Err() == nil {
+				t.Error("rejected job is not cancelled")
+			}
+		})
+	}
+}
+
+func TestJobQueueUserLimitCountsRunningJobs(t *testing.T) {
+	q := newJobQueue(10, 1)
+	j := testJob(q, 1)
+	q.push(j)
+	q.next()
+	if _, err := q.push(testJob(q, 1)); !errors.Is(err, errUserLimit) {
+		t.Fatalf("got %v while a job runs, want %v", err, errUserLimit)
+	}
+	q.done(j)
+	if _, err := q.push(testJob(q, 1)); err != nil {
+		t.Fatalf("job after the running one finished: %v", err)
+	}
+}
+
+func TestJobQueueCancelUser(t *testing.T) {
+	q := newJobQueue(10, 10)
+	running, queued, other := testJob(q, 1), testJob(q, 1), testJob(q, 2)
+	q.push(running)
+	q.push(queued)
+	q.push(other)
+	q.next()
+
+	removed, cancelled := q.cancelUser(1)
+	if len(removed) != 1 || removed[0] != queued {
+		t.Errorf("removed %v, want the queued job", removed)
+	}
+	if cancelled != running {
+		t.Errorf("running job %v is not returned", cancelled)
+	}
+	for _, j := range []*job{running, queued} {
+		if j.ctx.Err() == nil {
+			t.Errorf("job %s is not cancelled", j.id)
+		}
+	}
+	if other.ctx.Err() != nil {
+		t.Error("job of another user is cancelled")
+	}
+	if pending, _ := q.depth(); pending != 1 {
+		t.Errorf("%d jobs pending, want 1", pending)
+	}
+	// Работающее задание остаётся у воркера до done
+	q.done(running)
+	if n := q.perUser[1]; n != 0 {
+		t.Errorf("user still has %d jobs counted", n)
+	}
+	if j := q.next(); j != other {
+		t.Errorf("got %v, want the job of the other user", j)
+	}
+}
+
+func TestJobQueueCancelAll(t *testing.T) {
+	q := newJobQueue(10, 10)
+	jobs := []*job{testJob(q, 1), testJob(q, 1), testJob(q, 2)}
+	for _, j := range jobs {
+		q.push(j)
+	}
+	q.next()
+	removed, running := q.cancelAll()
+	if len(removed) != 2 || len(running) != 1 {
+		t.Fatalf("removed %d and running %d, want 2 and 1", len(removed), len(running))
+	}
+	for _, j := range jobs {
+		if j.ctx.Err() == nil {
+			t.Errorf("job %s is not cancelled", j.id)
+		}
+	}
+}
+
+func TestJobQueueCloseReleasesWorkers(t *testing.T) {
+	q := newJobQueue(10, 10)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var handled []int64
+	q.work(3, &wg, func(j *job) {
+		mu.Lock()
+		handled = append(handled, j.chatID)
+		mu.Unlock()
+	})
+	// Воркеры уже ждут в next, задания после закрытия всё равно доделываются
+	q.push(testJob(q, 1))
+	q.push(testJob(q, 2))
+	q.close()
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("workers are still blocked after close")
+	}
+	if len(handled) != 2 {
+		t.Errorf("handled %v, want both queued jobs", handled)
+	}
+	if _, err := q.push(testJob(q, 3)); !errors.Is(err, errQueueClosed) {
+		t.Errorf("got %v after close, want %v", err, errQueueClosed)
+	}
+}
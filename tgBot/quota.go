@@ -0,0 +1,277 @@
+package tgBot
+
+import (
+	"errors"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	quotasBucket = "quotas"
+	// creditPixels and creditSteps define a credit: one 512x512 picture with 25 steps.
+	creditPixels = 512 * 512
+	creditSteps  = 25
+	// taskCredits is the price of removing a background, enhancing a prompt and describing a picture.
+	taskCredits = 1
+)
+
+var errQuotaExceeded = errors.New("daily quota exceeded")
+
+// QuotaConfig limits generations per day. Without tiers there are no limits.
+type QuotaConfig struct {
+	// Tiers are the limits by tier name.
+	Tiers map[string]QuotaLimits
+	// DefaultTier is the tier of chats without an assigned one.
+	DefaultTier string
+	// ResetHour is the hour of the local time when the counters start over.
+	ResetHour int
+}
+
+// QuotaLimits are the daily limits of a tier. Zero means no limit.
+type QuotaLimits struct {
+	Images  int
+	Credits int
+}
+
+func (c *QuotaConfig) enabled() bool {
+	return len(c.Tiers) > 0
+}
+
+func (c *QuotaConfig) setDefaults() error {
+	if !c.enabled() {
+		return nil
+	}
+	if c.ResetHour < 0 || c.ResetHour > 23 {
+		return errors.New("quota reset hour must be between 0 and 23")
+	}
+	if c.DefaultTier == "" && len(c.Tiers) == 1 {
+		c.DefaultTier = c.tierNames()[0]
+	}
+	if c.DefaultTier == "" {
+		return errors.New("default quota tier is not set")
+	}
+	if _, ok := c.Tiers[c.DefaultTier]; !ok {
+		return errors.New("default quota tier " + c.DefaultTier + " is not configured")
+	}
+	return nil
+}
+
+func (c *QuotaConfig) tierNames() []string {
+	names := make([]string, 0, len(c.Tiers))
+	for name := range c.Tiers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// periodStart is the last reset before now.
+func (c *QuotaConfig) periodStart(now time.Time) time.Time {
+	start := time.Date(now.Year(), now.Month(), now.Day(), c.ResetHour, 0, 0, 0, now.Location())
+	if now.Before(start) {
+		start = start.AddDate(0, 0, -1)
+	}
+	return start
+}
+
+// quotaRecord is the usage of a chat in the current period.
+type quotaRecord struct {
+	ChatID int64 `json:"chatId"`
+	// Tier is assigned by an admin, empty means the default tier.
+	Tier    string    `json:"tier,omitempty"`
+	Period  time.Time `json:"period"`
+	Images  int       `json:"images"`
+	Credits int       `json:"credits"`
+}
+
+// generationCost is the price of a generation in credits. A credit is a 512x512 picture
+// with 25 steps, bigger pictures and more steps cost proportionally more.
+func generationCost(s *UserSettings) int {
+	perImage := (s.width*s.heigth*s.steps + creditPixels*creditSteps - 1) / (creditPixels * creditSteps)
+	return max(1, perImage) * s.numberResults
+}
+
+// jobCost is the price of the job in credits and pictures. Every job that goes to the provider is paid:
+// an upscale costs a credit per factor, the other tasks taskCredits. Text results are not pictures.
+func jobCost(j *job) (credits, images int) {
+	switch j.kind {
+	case jobGenerate:
+		return generationCost(&j.settings), j.settings.numberResults
+	case jobUpscale:
+		return j.factor, 1
+	case jobRemoveBackground:
+		return taskCredits, 1
+	}
+	return taskCredits, 0
+}
+
+// loadQuota returns the usage of the chat, the counters of a past period are reset.
+// The caller holds quotaMu.
+func (b *Bot) loadQuota(chatID int64) quotaRecord {
+	record := quotaRecord{ChatID: chatID}
+	if _, err := b.store.Get(quotasBucket, strconv.FormatInt(chatID, 10), &record); err != nil {
+		slog.Error("Failed to load quota", "chat_id", chatID, "err", err)
+	}
+	period := b.cfg.Quota.periodStart(time.Now())
+	if record.Period.Before(period) {
+		record.Period, record.Images, record.Credits = period, 0, 0
+	}
+	return record
+}
+
+func (b *Bot) saveQuota(record quotaRecord) {
+	if err := b.store.Put(quotasBucket, strconv.FormatInt(record.ChatID, 10), record); err != nil {
+		slog.Error("Failed to save quota", "chat_id", record.ChatID, "err", err)
+	}
+}
+
+func (b *Bot) quotaLimits(record quotaRecord) (string, QuotaLimits) {
+	tier := record.Tier
+	limits, ok := b.cfg.Quota.Tiers[tier]
+	if !ok {
+		// Тариф мог пропасть из конфигурации
+		tier = b.cfg.Quota.DefaultTier
+		limits = b.cfg.Quota.Tiers[tier]
+	}
+	return tier, limits
+}
+
+// quotaLimited reports whether the quotas apply to the chat, admins are never limited.
+func (b *Bot) quotaLimited(chatID int64) bool {
+	return b.cfg.Quota.enabled() && !b.cfg.isAdmin(chatID)
+}
+
+func fits(used, amount, limit int) bool {
+	return limit == 0 || used+amount <= limit
+}
+
+// checkQuota tells the user if the job doesn't fit into their daily limits.
+// Nothing is charged yet, the job pays when it starts.
+func (b *Bot) checkQuota(j *job) bool {
+	if !b.quotaLimited(j.chatID) {
+		return true
+	}
+	b.quotaMu.Lock()
+	record := b.loadQuota(j.chatID)
+	b.quotaMu.Unlock()
+	_, limits := b.quotaLimits(record)
+	cost, images := jobCost(j)
+	if fits(record.Images, images, limits.Images) && fits(record.Credits, cost, limits.Credits) {
+		return true
+	}
+	b.tg.Send(tgbotapi.NewMessage(j.chatID, quotaExceededText(j.lang, record, limits, cost, images)))
+	return false
+}
+
+// chargeQuota takes the price of the job before it starts. Jobs queued before
+// the limit was reached are checked again here.
+func (b *Bot) chargeQuota(j *job) error {
+	if !b.quotaLimited(j.chatID) {
+		return nil
+	}
+	b.quotaMu.Lock()
+	defer b.quotaMu.Unlock()
+	record := b.loadQuota(j.chatID)
+	_, limits := b.quotaLimits(record)
+	cost, images := jobCost(j)
+	if !fits(record.Images, images, limits.Images) || !fits(record.Credits, cost, limits.Credits) {
+		b.tg.Send(tgbotapi.NewMessage(j.chatID, quotaExceededText(j.lang, record, limits, cost, images)))
+		return errQuotaExceeded
+	}
+	record.Images += images
+	record.Credits += cost
+	b.saveQuota(record)
+	j.charged, j.chargedImages, j.chargedPeriod = cost, images, record.Period
+	return nil
+}
+
+// refundQuota returns the price of a job that didn't deliver pictures.
+func (b *Bot) refundQuota(j *job) {
+	if j.charged == 0 {
+		return
+	}
+	b.quotaMu.Lock()
+	defer b.quotaMu.Unlock()
+	record := b.loadQuota(j.chatID)
+	// После сброса счётчиков возвращать нечего
+	if record.Period.Equal(j.chargedPeriod) {
+		record.Images = max(0, record.Images-j.chargedImages)
+		record.Credits = max(0, record.Credits-j.charged)
+		b.saveQuota(record)
+	}
+	j.log.Info("Credits refunded", "credits", j.charged)
+	j.charged, j.chargedImages = 0, 0
+}
+
+func quotaExceededText(lang string, record quotaRecord, limits QuotaLimits, cost, images int) string {
+	reset := record.Period.AddDate(0, 0, 1).Format("02.01.2006 15:04")
+	return tr(lang, "quota.exceeded", cost, images,
+		remaining(lang, record.Credits, limits.Credits), remaining(lang, record.Images, limits.Images), reset)
+}
+
+func remaining(lang string, used, limit int) string {
+	if limit == 0 {
+		return tr(lang, "quota.unlimited")
+	}
+	return strconv.Itoa(max(0, limit-used))
+}
+
+func usage(lang string, used, limit int) string {
+	if limit == 0 {
+		return tr(lang, "quota.usage_unlimited", used)
+	}
+	return tr(lang, "quota.usage", used, limit)
+}
+
+func handleBalance(b *Bot, chatID int64) {
+	settings := b.getSettings(chatID)
+	lang := settings.language
+	cost := generationCost(settings)
+	if !b.quotaLimited(chatID) {
+		b.tg.Send(tgbotapi.NewMessage(chatID, tr(lang, "quota.no_limits", cost)))
+		return
+	}
+	b.quotaMu.Lock()
+	record := b.loadQuota(chatID)
+	b.quotaMu.Unlock()
+	tier, limits := b.quotaLimits(record)
+	text := tr(lang, "quota.balance", tier, usage(lang, record.Images, limits.Images),
+		usage(lang, record.Credits, limits.Credits), cost, record.Period.AddDate(0, 0, 1).Format("02.01.2006 15:04"))
+	b.tg.Send(tgbotapi.NewMessage(chatID, text+"\n"+tr(lang, "quota.task_prices", taskCredits)))
+}
+
+// handleTier processes /tier <chat id> <tier>, the admin command to move a chat to another tier.
+func handleTier(b *Bot, args string, chatID int64) {
+	if !b.cfg.isAdmin(chatID) {
+		b.tg.Send(tgbotapi.NewMessage(chatID, b.text(chatID, "admin.only")))
+		return
+	}
+	names := b.cfg.Quota.tierNames()
+	fields := strings.Fields(args)
+	var target int64
+	var err error
+	if len(fields) == 2 {
+		target, err = strconv.ParseInt(fields[0], 10, 64)
+	}
+	if len(fields) != 2 || err != nil {
+		b.tg.Send(tgbotapi.NewMessage(chatID, b.text(chatID, "quota.tier_usage", strings.Join(names, ", "))))
+		return
+	}
+	tier := fields[1]
+	if _, ok := b.cfg.Quota.Tiers[tier]; !ok {
+		b.tg.Send(tgbotapi.NewMessage(chatID, b.text(chatID, "quota.tier_unknown", tier, strings.Join(names, ", "))))
+		return
+	}
+	b.quotaMu.Lock()
+	record := b.loadQuota(target)
+	record.Tier = tier
+	b.saveQuota(record)
+	b.quotaMu.Unlock()
+	slog.Info("Chat moved to another tier", "chat_id", target, "tier", tier, "admin_id", chatID)
+	b.tg.Send(tgbotapi.NewMessage(chatID, b.text(chatID, "quota.tier_set", target, tier)))
+}
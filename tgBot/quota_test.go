@@ -0,0 +1,308 @@
+package tgBot
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/MTUCI-Pixel-Team/Picture_Generator/storage"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestGenerationCost(t *testing.T) {
+	tests := []struct {
+		name                 string
+		width, height, steps int
+		number               int
+		want                 int
+	}{
+		{"one credit", 512, 512, 25, 1, 1},
+		{"cheaper is still one credit", 256, 256, 10, 1, 1},
+		{"a bit more rounds up", 512, 512, 26, 1, 2},
+		{"double steps", 512, 512, 50, 1, 2},
+		{"four times the pixels", 1024, 1024, 25, 1, 4},
+		{"wide picture", 1024, 512, 25, 1, 2},
+		{"big and slow", 1024, 1024, 50, 1, 8},
+		{"per picture", 512, 512, 26, 3, 6},
+		{"minimum per picture", 128, 128, 1, 4, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &UserSettings{width: tt.width, heigth: tt.height, steps: tt.steps, numberResults: tt.number}
+			if got := generationCost(s); got != tt.want {
+				t.Errorf("cost %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJobCost(t *testing.T) {
+	tests := []struct {
+		name        string
+		kind        jobKind
+		factor      int
+		wantCredits int
+		wantImages  int
+	}{
+		{"generation", jobGenerate, 0, 4, 2},
+		{"upscale x2", jobUpscale, 2, 2, 1},
+		{"upscale x4", jobUpscale, 4, 4, 1},
+		{"remove background", jobRemoveBackground, 0, taskCredits, 1},
+		{"enhance", jobEnhance, 0, taskCredits, 0},
+		{"describe", jobDescribe, 0, taskCredits, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			j := quotaJob(1, 1024, 512, 25, 2)
+			j.kind, j.factor = tt.kind, tt.factor
+			credits, images := jobCost(j)
+			if credits != tt.wantCredits || images != tt.wantImages {
+				t.Errorf("costs %d credits and %d pictures, want %d and %d", credits, images, tt.wantCredits, tt.wantImages)
+			}
+		})
+	}
+}
+
+func TestQuotaPeriodStart(t *testing.T) {
+	moscow := time.FixedZone("MSK", 3*60*60)
+	newYork := time.FixedZone("EST", -5*60*60)
+	tests := []struct {
+		name      string
+		resetHour int
+		now       time.Time
+		want      time.Time
+	}{
+		{"midnight reset during the day", 0, time.Date(2024, 5, 10, 15, 0, 0, 0, time.UTC), time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC)},
+		{"exactly at midnight", 0, time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC), time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC)},
+		{"just before midnight", 0, time.Date(2024, 5, 10, 23, 59, 59, 0, time.UTC), time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC)},
+		{"before the reset hour", 6, time.Date(2024, 5, 10, 5, 59, 59, 0, time.UTC), time.Date(2024, 5, 9, 6, 0, 0, 0, time.UTC)},
+		{"exactly at the reset hour", 6, time.Date(2024, 5, 10, 6, 0, 0, 0, time.UTC), time.Date(2024, 5, 10, 6, 0, 0, 0, time.UTC)},
+		{"after midnight, before the reset", 6, time.Date(2024, 5, 10, 0, 30, 0, 0, time.UTC), time.Date(2024, 5, 9, 6, 0, 0, 0, time.UTC)},
+		{"across the month", 6, time.Date(2024, 3, 1, 2, 0, 0, 0, time.UTC), time.Date(2024, 2, 29, 6, 0, 0, 0, time.UTC)},
+		{"across the year", 0, time.Date(2025, 1, 1, 0, 0, 0, -1, time.UTC), time.Date(2024, 12, 31, 0, 0, 0, 0, time.UTC)},
+		{"local time east of utc", 0, time.Date(2024, 5, 10, 1, 0, 0, 0, moscow), time.Date(2024, 5, 10, 0, 0, 0, 0, moscow)},
+		{"local time west of utc", 23, time.Date(2024, 5, 10, 22, 0, 0, 0, newYork), time.Date(2024, 5, 9, 23, 0, 0, 0, newYork)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := QuotaConfig{ResetHour: tt.resetHour}
+			got := c.periodStart(tt.now)
+			if !got.Equal(tt.want) {
+				t.Errorf("period starts at %v, want %v", got, tt.want)
+			}
+			if tt.now.Before(got) || !tt.now.Before(got.AddDate(0, 0, 1)) {
+				t.Errorf("%v is outside of the period starting at %v", tt.now, got)
+			}
+		})
+	}
+}
+
+func newQuotaBot(t *testing.T, quota QuotaConfig) *Bot {
+	api, err := tgbotapi.NewBotAPIWithClient("1:token", tgbotapi.APIEndpoint, fakeTelegram{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := quota.setDefaults(); err != nil {
+		t.Fatal(err)
+	}
+	return &Bot{tg: api, store: storage.NewMemoryStore(), cfg: Config{Quota: quota, Admins: []int64{100}}}
+}
+
+func quotaJob(chatID int64, width, height, steps, number int) *job {
+	q := newJobQueue(10, 10)
+	j := q.newJob(context.Background(), jobGenerate, chatID)
+	j.settings = UserSettings{width: width, heigth: height, steps: steps, numberResults: number}
+	return j
+}
+
+func TestChargeThenRefund(t *testing.T) {
+	b := newQuotaBot(t, QuotaConfig{Tiers: map[string]QuotaLimits{"free": {Images: 10, Credits: 20}}})
+	b.quotaMu.Lock()
+	before := b.loadQuota(1)
+	before.Images, before.Credits = 3, 5
+	b.saveQuota(before)
+	b.quotaMu.Unlock()
+
+	j := quotaJob(1, 1024, 1024, 25, 2)
+	if err := b.chargeQuota(j); err != nil {
+		t.Fatal(err)
+	}
+	b.quotaMu.Lock()
+	charged := b.loadQuota(1)
+	b.quotaMu.Unlock()
+	if charged.Images != 5 || charged.Credits != 13 || j.charged != 8 {
+		t.Fatalf("after charge %d images and %d credits, job charged %d", charged.Images, charged.Credits, j.charged)
+	}
+
+	b.refundQuota(j)
+	// Повторный возврат ничего не меняет
+	b.refundQuota(j)
+	b.quotaMu.Lock()
+	after := b.loadQuota(1)
+	b.quotaMu.Unlock()
+	if after.Images != before.Images || after.Credits != before.Credits {
+		t.Errorf("after refund %d images and %d credits, want %d and %d", after.Images, after.Credits, before.Images, before.Credits)
+	}
+}
+
+func TestRefundAfterReset(t *testing.T) {
+	b := newQuotaBot(t, QuotaConfig{Tiers: map[string]QuotaLimits{"free": {Credits: 20}}})
+	j := quotaJob(1, 512, 512, 25, 1)
+	b.chargeQuota(j)
+	// Задание оплачено в прошлом периоде, новые счётчики не трогаем
+	j.chargedPeriod = j.chargedPeriod.AddDate(0, 0, -1)
+	b.refundQuota(j)
+	b.quotaMu.Lock()
+	record := b.loadQuota(1)
+	b.quotaMu.Unlock()
+	if record.Credits != 1 {
+		t.Errorf("%d credits after refund of the past period, want 1", record.Credits)
+	}
+}
+
+func TestChargeQuotaLimits(t *testing.T) {
+	tiers := map[string]QuotaLimits{
+		"free":    {Images: 4, Credits: 4},
+		"credits": {Credits: 4},
+		"images":  {Images: 4},
+	}
+	tests := []struct {
+		name    string
+		chatID  int64
+		tier    string
+		used    int // Уже потрачено и картинок, и кредитов
+		number  int
+		wantErr bool
+	}{
+		{"fits exactly", 1, "", 2, 2, false},
+		{"one over", 1, "", 3, 2, true},
+		{"credits over with unlimited images", 1, "credits", 3, 2, true},
+		{"unlimited credits", 1, "images", 2, 2, false},
+		{"images over", 1, "images", 3, 2, true},
+		{"removed tier falls back to the default", 1, "gold", 3, 2, true},
+		{"admin is not limited", 100, "", 100, 2, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newQuotaBot(t, QuotaConfig{Tiers: tiers, DefaultTier: "free"})
+			b.quotaMu.Lock()
+			record := b.loadQuota(tt.chatID)
+			record.Tier, record.Images, record.Credits = tt.tier, tt.used, tt.used
+			b.saveQuota(record)
+			b.quotaMu.Unlock()
+
+			err := b.chargeQuota(quotaJob(tt.chatID, 512, 512, 25, tt.number))
+			if tt.wantErr != errors.Is(err, errQuotaExceeded) {
+				t.Fatalf("got %v, want error %v", err, tt.wantErr)
+			}
+			b.quotaMu.Lock()
+			after := b.loadQuota(tt.chatID)
+			b.quotaMu.Unlock()
+			if tt.wantErr && (after.Images != tt.used || after.Credits != tt.used) {
+				t.Errorf("rejected job is charged: %+v", after)
+			}
+		})
+	}
+}
+
+func TestQuotaLimitsTierFallback(t *testing.T) {
+	b := newQuotaBot(t, QuotaConfig{Tiers: map[string]QuotaLimits{"free": {Images: 5}, "premium": {Images: 50}}, DefaultTier: "free"})
+	tests := []struct {
+		tier     string
+		wantTier string
+		want     int
+	}{
+		{"", "free", 5},
+		{"premium", "premium", 50},
+		{"gold", "free", 5},
+	}
+	for _, tt := range tests {
+		tier, limits := b.quotaLimits(quotaRecord{Tier: tt.tier})
+		if tier != tt.wantTier || limits.Images != tt.want {
+			t.Errorf("tier %q: got %s with %d images, want %s with %d", tt.tier, tier, limits.Images, tt.wantTier, tt.want)
+		}
+	}
+}
+
+func TestQuotaConfigDefaults(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     QuotaConfig
+		want    string
+		wantErr bool
+	}{
+		{"disabled", QuotaConfig{}, "", false},
+		{"single tier is the default", QuotaConfig{Tiers: map[string]QuotaLimits{"free": {}}}, "free", false},
+		{"several tiers need a default", QuotaConfig{Tiers: map[string]QuotaLimits{"free": {}, "premium": {}}}, "", true},
+		{"unknown default", QuotaConfig{Tiers: map[string]QuotaLimits{"free": {}}, DefaultTier: "gold"}, "", true},
+		{"bad reset hour", QuotaConfig{Tiers: map[string]QuotaLimits{"free": {}}, ResetHour: 24}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.setDefaults()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && tt.cfg.DefaultTier != tt.want {
+				t.Errorf("default tier %q, want %q", tt.cfg.DefaultTier, tt.want)
+			}
+		})
+	}
+}
+
+func TestEveryJobKindIsCharged(t *testing.T) {
+	for _, kind := range []jobKind{jobGenerate, jobUpscale, jobRemoveBackground, jobEnhance, jobDescribe} {
+		t.Run(kind.String(), func(t *testing.T) {
+			b := newQuotaBot(t, QuotaConfig{Tiers: map[string]QuotaLimits{"free": {Credits: 1}}})
+			j := quotaJob(1, 512, 512, 25, 1)
+			j.kind, j.factor = kind, 2
+			credits, _ := jobCost(j)
+			err := b.chargeQuota(j)
+			if credits > 1 {
+				if !errors.Is(err, errQuotaExceeded) {
+					t.Fatalf("job over the limit: %v", err)
+				}
+				return
+			}
+			if err != nil || j.charged != credits {
+				t.Fatalf("charged %d credits, want %d: %v", j.charged, credits, err)
+			}
+			// Второе задание того же вида в лимит уже не влезает
+			if err := b.chargeQuota(quotaJob(1, 512, 512, 25, 1)); !errors.Is(err, errQuotaExceeded) {
+				t.Errorf("second job: %v", err)
+			}
+		})
+	}
+}
+
+func TestEnqueueChecksQuota(t *testing.T) {
+	b := newQuotaBot(t, QuotaConfig{Tiers: map[string]QuotaLimits{"free": {Credits: 3}}})
+	b.queue = newJobQueue(10, 10)
+	b.quotaMu.Lock()
+	record := b.loadQuota(1)
+	record.Credits = 2
+	b.saveQuota(record)
+	b.quotaMu.Unlock()
+
+	tests := []struct {
+		name   string
+		kind   jobKind
+		factor int
+		queued bool
+	}{
+		{"upscale over the limit", jobUpscale, 2, false},
+		{"describe fits", jobDescribe, 0, true},
+	}
+	for _, tt := range tests {
+		j := b.queue.newJob(context.Background(), tt.kind, 1)
+		j.factor = tt.factor
+		b.enqueue(j)
+		if pending, _ := b.queue.depth(); (pending == 1) != tt.queued {
+			t.Errorf("%s: %d jobs queued", tt.name, pending)
+		}
+		if queued := j.ctx.Err() == nil; queued != tt.queued {
+			t.Errorf("%s: job context %v", tt.name, j.ctx.Err())
+		}
+	}
+}
@@ -0,0 +1,311 @@
+package tgBot
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// settingsField is a line of the /settings message. A field is changed either by a choice
+// from the message itself (options and apply) or by a value typed in the chat (input).
+type settingsField struct {
+	id string
+	// label is the key of the field name in messages.
+	label string
+	value func(c *Catalog, lang string, s *UserSettings) string
+	// options returns the labels of the choices, apply sets the choice with the index.
+	// The index is only valid for the same catalog, the picker buttons carry its version.
+	options func(c *Catalog, lang string) []string
+	apply   func(c *Catalog, s *UserSettings, index int)
+	// input asks the user to send the new value, the answer is handled like the command of the field.
+	input func(b *Bot, chatID int64)
+}
+
+// settingsFields are shown in this order. A new setting only needs a new entry here.
+var settingsFields = []settingsField{
+	{
+		id:    "model",
+		label: "settings.model",
+		value: func(c *Catalog, lang string, s *UserSettings) string {
+			if name, ok := c.modelName(s.model); ok {
+				return name
+			}
+			return s.model
+		},
+		options: func(c *Catalog, _ string) []string {
+			var labels []string
+			for _, m := range c.Models {
+				labels = append(labels, m.Name)
+			}
+			return labels
+		},
+		apply: func(c *Catalog, s *UserSettings, i int) { s.model = c.Models[i].AIR },
+	},
+	{
+		id:      "steps",
+		label:   "settings.steps",
+		value:   func(c *Catalog, lang string, s *UserSettings) string { return strconv.Itoa(s.steps) },
+		options: func(c *Catalog, _ string) []string { return intLabels(c.Steps) },
+		apply:   func(c *Catalog, s *UserSettings, i int) { s.steps = c.Steps[i] },
+	},
+	{
+		id:    "size",
+		label: "settings.size",
+		value: func(c *Catalog, lang string, s *UserSettings) string {
+			if name, ok := c.sizeName(s.width, s.heigth); ok {
+				return name
+			}
+			return fmt.Sprintf("%dx%d", s.width, s.heigth)
+		},
+		options: func(c *Catalog, _ string) []string {
+			var labels []string
+			for _, size := range c.Sizes {
+				labels = append(labels, size.Name)
+			}
+			return labels
+		},
+		apply: func(c *Catalog, s *UserSettings, i int) {
+			s.width, s.heigth = c.Sizes[i].Width, c.Sizes[i].Height
+		},
+	},
+	{
+		id:      "scheduler",
+		label:   "settings.scheduler",
+		value:   func(c *Catalog, lang string, s *UserSettings) string { return s.scheduler },
+		options: func(c *Catalog, _ string) []string { return c.Schedulers },
+		apply:   func(c *Catalog, s *UserSettings, i int) { s.scheduler = c.Schedulers[i] },
+	},
+	{
+		id:      "results",
+		label:   "settings.number_results",
+		value:   func(c *Catalog, lang string, s *UserSettings) string { return strconv.Itoa(s.numberResults) },
+		options: func(c *Catalog, _ string) []string { return intLabels(c.NumberResults) },
+		apply:   func(c *Catalog, s *UserSettings, i int) { s.numberResults = c.NumberResults[i] },
+	},
+	{
+		id:    "cfg",
+		label: "settings.cfg",
+		value: func(c *Catalog, lang string, s *UserSettings) string {
+			if s.cfgScale == 0 {
+				return tr(lang, "cfg.current_default", formatFloat(c.cfgForModel(s.model)))
+			}
+			return formatFloat(s.cfgScale)
+		},
+		// Первый вариант - значение по умолчанию для модели
+		options: func(c *Catalog, lang string) []string {
+			return append([]string{tr(lang, "button.default")}, floatLabels(c.CFGScales)...)
+		},
+		apply: func(c *Catalog, s *UserSettings, i int) {
+			s.cfgScale = 0
+			if i > 0 {
+				s.cfgScale = c.CFGScales[i-1]
+			}
+		},
+	},
+	{
+		id:      "strength",
+		label:   "settings.strength",
+		value:   func(c *Catalog, lang string, s *UserSettings) string { return formatFloat(s.strength) },
+		options: func(c *Catalog, _ string) []string { return floatLabels(c.Strengths) },
+		apply:   func(c *Catalog, s *UserSettings, i int) { s.strength = c.Strengths[i] },
+	},
+	{
+		id:    "seed",
+		label: "settings.seed",
+		value: func(c *Catalog, lang string, s *UserSettings) string {
+			if s.seed == 0 {
+				return tr(lang, "button.random")
+			}
+			return strconv.FormatInt(s.seed, 10)
+		},
+		input: func(b *Bot, chatID int64) {
+			settings := b.getSettings(chatID)
+			settings.state = "showVariableSeed"
+			b.userSettings.Store(chatID, settings)
+			handleSeed(b, "", chatID)
+		},
+	},
+	{
+		id:    "negative",
+		label: "settings.negative",
+		value: func(c *Catalog, lang string, s *UserSettings) string {
+			if s.negativePrompt == "" {
+				return tr(lang, "button.none")
+			}
+			return s.negativePrompt
+		},
+		input: func(b *Bot, chatID int64) {
+			settings := b.getSettings(chatID)
+			settings.state = "showVariableNegativePrompt"
+			b.userSettings.Store(chatID, settings)
+			handleNegativePrompt(b, "", chatID)
+		},
+	},
+	{
+		id:    "enhance",
+		label: "settings.enhance",
+		value: func(c *Catalog, lang string, s *UserSettings) string { return onOff(lang, s.enhance) },
+		options: func(c *Catalog, lang string) []string {
+			return []string{onOff(lang, true), onOff(lang, false)}
+		},
+		apply: func(c *Catalog, s *UserSettings, i int) { s.enhance = i == 0 },
+	},
+	{
+		id:    "language",
+		label: "settings.language",
+		value: func(c *Catalog, lang string, s *UserSettings) string { return languageName(s.language) },
+		options: func(c *Catalog, _ string) []string {
+			var labels []string
+			for _, l := range languages {
+				labels = append(labels, l.name)
+			}
+			return labels
+		},
+		apply: func(c *Catalog, s *UserSettings, i int) { s.language = languages[i].code },
+	},
+}
+
+func findSettingsField(id string) (settingsField, bool) {
+	for _, field := range settingsFields {
+		if field.id == id {
+			return field, true
+		}
+	}
+	return settingsField{}, false
+}
+
+func intLabels(values []int) []string {
+	labels := make([]string, len(values))
+	for i, v := range values {
+		labels[i] = strconv.Itoa(v)
+	}
+	return labels
+}
+
+func floatLabels(values []float64) []string {
+	labels := make([]string, len(values))
+	for i, v := range values {
+		labels[i] = formatFloat(v)
+	}
+	return labels
+}
+
+func onOff(lang string, on bool) string {
+	if on {
+		return tr(lang, "option.on")
+	}
+	return tr(lang, "option.off")
+}
+
+// settingsOverview renders all settings with a button for every field that can be changed here.
+func settingsOverview(c *Catalog, settings *UserSettings) (string, tgbotapi.InlineKeyboardMarkup) {
+	lang := settings.language
+	var text strings.Builder
+	text.WriteString(tr(lang, "settings.title"))
+	var keyboard [][]tgbotapi.InlineKeyboardButton
+	var row []tgbotapi.InlineKeyboardButton
+	for _, field := range settingsFields {
+		fmt.Fprintf(&text, "\n%s: %s", tr(lang, field.label), field.value(c, lang, settings))
+		if field.options == nil && field.input == nil {
+			continue
+		}
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData(tr(lang, field.label), "st:"+field.id+":"))
+		if len(row) == 2 {
+			keyboard = append(keyboard, row)
+			row = nil
+		}
+	}
+	if len(row) > 0 {
+		keyboard = append(keyboard, row)
+	}
+	text.WriteString("\n\n")
+	text.WriteString(tr(lang, "settings.hint"))
+	return text.String(), tgbotapi.NewInlineKeyboardMarkup(keyboard...)
+}
+
+// settingsPicker renders the choices of the field, the current one is marked.
+func settingsPicker(c *Catalog, settings *UserSettings, field settingsField) (string, tgbotapi.InlineKeyboardMarkup) {
+	lang := settings.language
+	current := field.value(c, lang, settings)
+	version := c.version()
+	var keyboard [][]tgbotapi.InlineKeyboardButton
+	var row []tgbotapi.InlineKeyboardButton
+	for i, label := range field.options(c, lang) {
+		if label == current {
+			label = "✓ " + label
+		}
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData(label, fmt.Sprintf("sv:%s:%d:%s", field.id, i, version)))
+		if len(row) == 3 {
+			keyboard = append(keyboard, row)
+			row = nil
+		}
+	}
+	if len(row) > 0 {
+		keyboard = append(keyboard, row)
+	}
+	keyboard = append(keyboard, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(tr(lang, "button.back"), "st::")))
+	text := tr(lang, "settings.choose", tr(lang, field.label), current)
+	return text, tgbotapi.NewInlineKeyboardMarkup(keyboard...)
+}
+
+func handleSettings(b *Bot, chatID int64) {
+	text, markup := settingsOverview(options(), b.getSettings(chatID))
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ReplyMarkup = markup
+	b.tg.Send(msg)
+}
+
+// handleSettingsButton switches the /settings message between the overview ("st::") and a picker ("st:<field>:").
+// A field without choices asks for its value in the chat instead.
+func handleSettingsButton(b *Bot, chatID int64, messageID int, fieldID string) string {
+	settings := b.getSettings(chatID)
+	c := options()
+	text, markup := settingsOverview(c, settings)
+	if fieldID != "" {
+		field, ok := findSettingsField(fieldID)
+		switch {
+		case ok && field.options != nil:
+			text, markup = settingsPicker(c, settings, field)
+		case ok && field.input != nil:
+			field.input(b, chatID)
+			return ""
+		default:
+			return tr(settings.language, "button.unknown")
+		}
+	}
+	b.editSettingsMessage(chatID, messageID, text, markup)
+	return ""
+}
+
+// handleSettingsValue applies the choice from a picker ("sv:<field>:<index>:<catalog version>") and returns to the overview.
+func handleSettingsValue(b *Bot, chatID int64, messageID int, fieldID, indexArg, version string) string {
+	settings := b.getSettings(chatID)
+	c := options()
+	field, ok := findSettingsField(fieldID)
+	index, err := strconv.Atoi(indexArg)
+	if !ok || field.options == nil || err != nil || index < 0 || index >= len(field.options(c, settings.language)) {
+		return tr(settings.language, "button.unknown")
+	}
+	// Выбор открыт до перезагрузки каталога: под тем же номером может быть другое значение
+	if version != c.version() {
+		text, markup := settingsPicker(c, settings, field)
+		b.editSettingsMessage(chatID, messageID, text, markup)
+		return tr(settings.language, "settings.outdated")
+	}
+	field.apply(c, settings, index)
+	b.saveSettings(chatID, settings)
+
+	text, markup := settingsOverview(c, settings)
+	b.editSettingsMessage(chatID, messageID, text, markup)
+	return tr(settings.language, "settings.updated", tr(settings.language, field.label), field.value(c, settings.language, settings))
+}
+
+func (b *Bot) editSettingsMessage(chatID int64, messageID int, text string, markup tgbotapi.InlineKeyboardMarkup) {
+	edit := tgbotapi.NewEditMessageTextAndMarkup(chatID, messageID, text, markup)
+	if _, err := b.tg.Send(edit); err != nil {
+		slog.Warn("Failed to edit settings message", "chat_id", chatID, "err", err)
+	}
+}
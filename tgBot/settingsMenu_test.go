@@ -0,0 +1,137 @@
+package tgBot
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/MTUCI-Pixel-Team/Picture_Generator/storage"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func newSettingsBot(t *testing.T) *Bot {
+	api, err := tgbotapi.NewBotAPIWithClient("1:token", tgbotapi.APIEndpoint, fakeTelegram{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Bot{tg: api, store: storage.NewMemoryStore()}
+}
+
+// pickerButton returns the callback data of the choice with the label.
+func pickerButton(t *testing.T, markup tgbotapi.InlineKeyboardMarkup, label string) []string {
+	for _, row := range markup.InlineKeyboard {
+		for _, button := range row {
+			if strings.TrimPrefix(button.Text, "✓ ") == label {
+				return strings.Split(*button.CallbackData, ":")
+			}
+		}
+	}
+	t.Fatalf("no button %q", label)
+	return nil
+}
+
+func TestSettingsValueOutOfRange(t *testing.T) {
+	b := newSettingsBot(t)
+	small := builtinCatalog
+	small.Steps = []int{10, 20}
+	currentCatalog.Store(&small)
+	defer currentCatalog.Store(&builtinCatalog)
+
+	tests := []struct {
+		index   string
+		want    int
+		applied bool
+	}{
+		{"1", 20, true},
+		{"5", 20, false},
+		{"-1", 20, false},
+		{"x", 20, false},
+	}
+	for _, tt := range tests {
+		reply := handleSettingsValue(b, 1, 10, "steps", tt.index, small.version())
+		if applied := reply != tr("", "button.unknown"); applied != tt.applied {
+			t.Errorf("index %s: reply %q", tt.index, reply)
+		}
+		if got := b.getSettings(1).steps; got != tt.want {
+			t.Errorf("index %s: steps %d, want %d", tt.index, got, tt.want)
+		}
+	}
+}
+
+func TestSettingsValueAfterCatalogReload(t *testing.T) {
+	b := newSettingsBot(t)
+	field, _ := findSettingsField("steps")
+	before := builtinCatalog
+	before.Steps = []int{10, 20, 30}
+	currentCatalog.Store(&before)
+	defer currentCatalog.Store(&builtinCatalog)
+	_, markup := settingsPicker(options(), b.getSettings(1), field)
+	old := pickerButton(t, markup, "30")
+
+	// Тот же номер после перезагрузки указывает на другое значение
+	after := builtinCatalog
+	after.Steps = []int{40, 30, 20}
+	currentCatalog.Store(&after)
+	reply := handleSettingsValue(b, 1, 10, old[1], old[2], old[3])
+	if reply != tr("", "settings.outdated") {
+		t.Errorf("button from the old picker: reply %q", reply)
+	}
+	if got := b.getSettings(1).steps; got != builtinCatalog.Defaults.Steps {
+		t.Fatalf("button from the old picker set steps to %d", got)
+	}
+
+	_, markup = settingsPicker(options(), b.getSettings(1), field)
+	fresh := pickerButton(t, markup, "30")
+	handleSettingsValue(b, 1, 10, fresh[1], fresh[2], fresh[3])
+	if got := b.getSettings(1).steps; got != 30 {
+		t.Errorf("button from the new picker set steps to %d, want 30", got)
+	}
+
+	// Перезагрузка того же каталога кнопки не портит
+	same := after
+	currentCatalog.Store(&same)
+	if same.version() != after.version() {
+		t.Error("the same catalog has another version")
+	}
+}
+
+func TestSettingsInputFields(t *testing.T) {
+	tests := []struct {
+		field string
+		state string
+	}{
+		{"seed", "chooseSeed"},
+		{"negative", "chooseNegativePrompt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.field, func(t *testing.T) {
+			b := newSettingsBot(t)
+			text, _ := settingsOverview(options(), b.getSettings(1))
+			if strings.Contains(text, "/"+tt.field) {
+				t.Errorf("overview still points to a command: %q", text)
+			}
+			if reply := handleSettingsButton(b, 1, 10, tt.field); reply != "" {
+				t.Fatalf("reply %q", reply)
+			}
+			if got := b.getSettings(1).state; got != tt.state {
+				t.Errorf("state %q, want %q", got, tt.state)
+			}
+		})
+	}
+}
+
+func TestSettingsOverviewButtons(t *testing.T) {
+	b := newSettingsBot(t)
+	_, markup := settingsOverview(options(), b.getSettings(1))
+	buttons := map[string]bool{}
+	for _, row := range markup.InlineKeyboard {
+		for _, button := range row {
+			buttons[*button.CallbackData] = true
+		}
+	}
+	for _, field := range settingsFields {
+		if data := fmt.Sprintf("st:%s:", field.id); !buttons[data] {
+			t.Errorf("field %s can't be changed from /settings", field.id)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package tgBot
+
+import (
+	"encoding/json"
+	"log/slog"
+	"strconv"
+)
+
+const (
+	settingsBucket = "settings"
+	// settingsVersion is the current schema version of settingsRecord.
+	// Bump it and add a migration when the meaning of an existing field changes.
+	settingsVersion = 1
+)
+
+// settingsRecord is the persisted part of UserSettings. New fields can be added freely:
+// records written before will get the default value for them.
+type settingsRecord struct {
+	Version        int     `json:"version"`
+	Model          string  `json:"model"`
+	Steps          int     `json:"steps"`
+	Width          int     `json:"width"`
+	Height         int     `json:"height"`
+	NumberResults  int     `json:"numberResults"`
+	Scheduler      string  `json:"scheduler"`
+	NegativePrompt string  `json:"negativePrompt,omitempty"`
+	Seed           int64   `json:"seed,omitempty"`
+	CFGScale       float64 `json:"cfgScale,omitempty"`
+	Strength       float64 `json:"strength"`
+	Enhance        bool    `json:"enhance,omitempty"`
+	Language       string  `json:"language,omitempty"`
+}
+
+// settingsMigrations upgrade a record from version N (the key) to version N+1.
+var settingsMigrations = map[int]func(*settingsRecord){}
+
+func newDefaultSettings() *UserSettings {
+	d := options().Defaults
+	return &UserSettings{
+		steps:         d.Steps,
+		model:         d.Model,
+		state:         defaultState,
+		width:         d.Width,
+		heigth:        d.Height,
+		numberResults: d.NumberResults,
+		scheduler:     d.Scheduler,
+		strength:      d.Strength,
+	}
+}
+
+func (s *UserSettings) record() settingsRecord {
+	return settingsRecord{
+		Version:        settingsVersion,
+		Model:          s.model,
+		Steps:          s.steps,
+		Width:          s.width,
+		Height:         s.heigth,
+		NumberResults:  s.numberResults,
+		Scheduler:      s.scheduler,
+		NegativePrompt: s.negativePrompt,
+		Seed:           s.seed,
+		CFGScale:       s.cfgScale,
+		Strength:       s.strength,
+		Enhance:        s.enhance,
+		Language:       s.language,
+	}
+}
+
+func decodeSettings(data []byte) (*UserSettings, error) {
+	// Заполняем значениями по умолчанию, чтобы у старых записей появились новые поля
+	record := newDefaultSettings().record()
+	record.Version = 0
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, err
+	}
+	for v := record.Version; v < settingsVersion; v++ {
+		if migrate, ok := settingsMigrations[v]; ok {
+			migrate(&record)
+		}
+	}
+
+	settings := newDefaultSettings()
+	settings.model = record.Model
+	settings.steps = record.Steps
+	settings.width = record.Width
+	settings.heigth = record.Height
+	settings.numberResults = record.NumberResults
+	settings.scheduler = record.Scheduler
+	settings.negativePrompt = record.NegativePrompt
+	settings.seed = record.Seed
+	settings.cfgScale = record.CFGScale
+	settings.strength = record.Strength
+	settings.enhance = record.Enhance
+	settings.language = record.Language
+	return settings, nil
+}
+
+// loadAllSettings fills userSettings with everything saved in the store.
+func (b *Bot) loadAllSettings() error {
+	count := 0
+	err := b.store.ForEach(settingsBucket, func(key string, data []byte) error {
+		chatID, err := strconv.ParseInt(key, 10, 64)
+		if err != nil {
+			slog.Warn("Skip settings with invalid chat id", "key", key)
+			return nil
+		}
+		settings, err := decodeSettings(data)
+		if err != nil {
+			slog.Warn("Skip broken settings", "chat_id", chatID, "err", err)
+			return nil
+		}
+		b.userSettings.Store(chatID, settings)
+		count++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	slog.Info("Settings loaded", "users", count)
+	return nil
+}
+
+func (b *Bot) getSettings(chatID int64) *UserSettings {
+	loadSettings, exists := b.userSettings.Load(chatID)
+	if !exists {
+		settings := newDefaultSettings()
+		b.userSettings.Store(chatID, settings)
+		return settings
+	}
+	return loadSettings.(*UserSettings)
+}
+
+// saveSettings stores settings in memory and writes them through to the store.
+func (b *Bot) saveSettings(chatID int64, settings *UserSettings) {
+	b.userSettings.Store(chatID, settings)
+	if err := b.store.Put(settingsBucket, strconv.FormatInt(chatID, 10), settings.record()); err != nil {
+		slog.Error("Failed to save settings", "chat_id", chatID, "err", err)
+	}
+}
@@ -0,0 +1,61 @@
+package tgBot
+
+import (
+	"log/slog"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Shutdown stops the bot. Updates are no longer fetched and the ones already received are refused,
+// queued and running jobs get cfg.ShutdownTimeout to deliver their results, then they are cancelled.
+// The generator and the store are not closed, they belong to the caller.
+func (b *Bot) Shutdown() {
+	if !b.stopping.CompareAndSwap(false, true) {
+		return
+	}
+	slog.Info("Bot is shutting down, waiting for running jobs", "timeout", b.cfg.ShutdownTimeout)
+	deadline := time.After(b.cfg.ShutdownTimeout)
+	if b.cfg.Webhook.enabled() {
+		// Если вебхук ещё не установлен, его остановит startWebhook
+		b.stopWebhook()
+	} else {
+		b.tg.StopReceivingUpdates()
+	}
+	b.queue.close()
+
+	drained := make(chan struct{})
+	go func() {
+		b.workers.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+		slog.Info("All jobs are finished")
+	case <-deadline:
+		removed, running := b.queue.cancelAll()
+		slog.Warn("Shutdown timeout, jobs cancelled", "queued", len(removed), "running", len(running))
+		for _, j := range removed {
+			b.deleteMessage(j.chatID, j.statusMsg)
+		}
+		// Статус работающих заданий удалят сами воркеры
+		for _, j := range append(removed, running...) {
+			b.tg.Send(tgbotapi.NewMessage(j.chatID, b.text(j.chatID, "maintenance")))
+		}
+		<-drained
+	}
+	b.cancel()
+	slog.Info("Bot is stopped")
+}
+
+// refuse answers an update received during shutdown.
+func (b *Bot) refuse(update tgbotapi.Update) {
+	switch {
+	case update.CallbackQuery != nil && update.CallbackQuery.Message != nil:
+		chatID := update.CallbackQuery.Message.Chat.ID
+		b.tg.Request(tgbotapi.NewCallback(update.CallbackQuery.ID, b.text(chatID, "maintenance")))
+	case update.Message != nil:
+		chatID := update.Message.Chat.ID
+		b.tg.Send(tgbotapi.NewMessage(chatID, b.text(chatID, "maintenance")))
+	}
+}
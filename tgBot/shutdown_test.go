@@ -0,0 +1,105 @@
+package tgBot
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/MTUCI-Pixel-Team/Picture_Generator/generator"
+	"github.com/MTUCI-Pixel-Team/Picture_Generator/storage"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// newShutdownBot returns a bot with one running worker. Enhancing takes half of delay.
+func newShutdownBot(t *testing.T, delay, timeout time.Duration) (*Bot, *recordingTelegram) {
+	b, client := newJobBot(t, storage.NewMemoryStore())
+	b.generator = generator.NewFake(delay)
+	b.ctx, b.cancel = context.WithCancel(context.Background())
+	b.cfg = Config{Workers: 1, ShutdownTimeout: timeout}
+	b.queue.work(b.cfg.Workers, &b.workers, b.runJob)
+	return b, client
+}
+
+// submitEnhance queues an enhance job and waits until the worker takes it.
+func submitEnhance(t *testing.T, b *Bot, chatID int64) {
+	settings := b.getSettings(chatID)
+	settings.enhance = true
+	b.submitPrompt(chatID, settings, "a cat on a sofa", "")
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, running := b.queue.depth(); running > 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("job is not started")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestShutdownWaitsForJob(t *testing.T) {
+	b, client := newShutdownBot(t, 400*time.Millisecond, 5*time.Second)
+	submitEnhance(t, b, 1)
+	b.Shutdown()
+
+	texts := client.sentTexts()
+	enhanced, _ := b.generator.EnhancePrompt(context.Background(), generator.EnhanceRequest{Prompt: "a cat on a sofa"})
+	if !slices.Contains(texts, tr("", "enhance.result", enhanced, "a cat on a sofa")) {
+		t.Errorf("job is not finished, messages %q", texts)
+	}
+	if slices.Contains(texts, tr("", "maintenance")) {
+		t.Error("user is told about maintenance though the job finished in time")
+	}
+	if b.ctx.Err() == nil {
+		t.Error("bot context is not cancelled")
+	}
+}
+
+func TestShutdownCancelsSlowJob(t *testing.T) {
+	b, client := newShutdownBot(t, time.Minute, 100*time.Millisecond)
+	limitQuota(t, b)
+	submitEnhance(t, b, 1)
+	// Второй пользователь ждёт в очереди единственного воркера
+	b.submitPrompt(2, b.getSettings(2), "a dog", "")
+
+	stopped := make(chan struct{})
+	go func() {
+		b.Shutdown()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Shutdown waits for the job after the timeout")
+	}
+
+	texts := client.sentTexts()
+	if n := len(slices.DeleteFunc(slices.Clone(texts), func(text string) bool { return text != tr("", "maintenance") })); n != 2 {
+		t.Errorf("%d maintenance messages, want one for the running and one for the queued job: %q", n, texts)
+	}
+	if pending, running := b.queue.depth(); pending+running != 0 {
+		t.Errorf("%d jobs queued and %d running after shutdown", pending, running)
+	}
+	if credits, _ := chargedCredits(b, 1); credits != 0 {
+		t.Errorf("cancelled job is charged %d credits", credits)
+	}
+}
+
+func TestJobsRefusedWhileStopping(t *testing.T) {
+	b, client := newShutdownBot(t, 0, time.Second)
+	b.Shutdown()
+
+	b.submitJob(1, b.getSettings(1), "a cat on a sofa", "")
+	if pending, _ := b.queue.depth(); pending != 0 {
+		t.Errorf("%d jobs queued after shutdown", pending)
+	}
+	b.refuse(tgbotapi.Update{Message: &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: 2}, Text: "a dog"}})
+
+	texts := client.sentTexts()
+	if n := len(slices.DeleteFunc(slices.Clone(texts), func(text string) bool { return text != tr("", "maintenance") })); n != 2 {
+		t.Errorf("%d maintenance messages, want one for the job and one for the update: %q", n, texts)
+	}
+	// Повторная остановка ничего не делает
+	b.Shutdown()
+}
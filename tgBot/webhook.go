@@ -0,0 +1,189 @@
+package tgBot
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// WebhookConfig turns on the webhook mode. Without URL the bot uses long polling.
+type WebhookConfig struct {
+	// URL is the public address Telegram sends updates to, e.g. https://bot.example.com/telegram.
+	URL string
+	// Listen is the address of the embedded HTTP server.
+	Listen string
+	// Path is served by the embedded server. Empty means the path of URL,
+	// set it when a reverse proxy rewrites the path.
+	Path string
+	// SecretToken is sent by Telegram in the X-Telegram-Bot-Api-Secret-Token header of every request.
+	SecretToken string
+	// CertFile and KeyFile make the server use TLS. Leave them empty behind a proxy that terminates TLS.
+	CertFile string
+	KeyFile  string
+	// UploadCert sends CertFile to Telegram, it is needed for a self-signed certificate.
+	UploadCert bool
+}
+
+const (
+	defaultWebhookListen = ":8080"
+	secretTokenHeader    = "X-Telegram-Bot-Api-Secret-Token"
+	// maxUpdateSize limits the body of a webhook request, updates are much smaller.
+	maxUpdateSize      = 1 << 20
+	webhookStopTimeout = 10 * time.Second
+)
+
+// secretTokenPattern is what Telegram accepts as a secret token.
+var secretTokenPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,256}$`)
+
+func (c *WebhookConfig) enabled() bool {
+	return c.URL != ""
+}
+
+func (c *WebhookConfig) setDefaults() error {
+	if !c.enabled() {
+		return nil
+	}
+	link, err := url.Parse(c.URL)
+	if err != nil {
+		return fmt.Errorf("invalid webhook url: %w", err)
+	}
+	if link.Scheme != "https" {
+		return errors.New("webhook url must use https")
+	}
+	if c.SecretToken == "" {
+		slog.Warn("Webhook secret token is not set, anyone who knows the url can send updates")
+	} else if !secretTokenPattern.MatchString(c.SecretToken) {
+		return errors.New("webhook secret token must be 1-256 characters A-Z, a-z, 0-9, _ and -")
+	}
+	if c.Listen == "" {
+		c.Listen = defaultWebhookListen
+	}
+	if c.Path == "" {
+		c.Path = link.Path
+	}
+	if c.Path == "" {
+		c.Path = "/"
+	}
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return errors.New("webhook needs both certificate and key files for TLS")
+	}
+	if c.UploadCert && c.CertFile == "" {
+		return errors.New("webhook certificate to upload is not set")
+	}
+	return nil
+}
+
+// webhookServer receives updates from Telegram and passes them to the bot.
+type webhookServer struct {
+	cfg     WebhookConfig
+	server  *http.Server
+	updates chan tgbotapi.Update
+	// done is closed when the server stops, handlers stop waiting for room in updates.
+	done chan struct{}
+}
+
+// startWebhook starts the HTTP server and registers the webhook in Telegram.
+func (b *Bot) startWebhook() (tgbotapi.UpdatesChannel, error) {
+	w := &webhookServer{
+		cfg:     b.cfg.Webhook,
+		updates: make(chan tgbotapi.Update, b.tg.Buffer),
+		done:    make(chan struct{}),
+	}
+	mux := http.NewServeMux()
+	mux.Handle(w.cfg.Path, w)
+	w.server = &http.Server{
+		Addr:              w.cfg.Listen,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		var err error
+		if w.cfg.CertFile != "" {
+			err = w.server.ListenAndServeTLS(w.cfg.CertFile, w.cfg.KeyFile)
+		} else {
+			err = w.server.ListenAndServe()
+		}
+		if !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("Webhook server stopped", "err", err)
+		}
+	}()
+
+	params := tgbotapi.Params{"url": w.cfg.URL}
+	params.AddNonEmpty("secret_token", w.cfg.SecretToken)
+	var err error
+	if w.cfg.UploadCert {
+		files := []tgbotapi.RequestFile{{Name: "certificate", Data: tgbotapi.FilePath(w.cfg.CertFile)}}
+		_, err = b.tg.UploadFiles("setWebhook", params, files)
+	} else {
+		_, err = b.tg.MakeRequest("setWebhook", params)
+	}
+	if err != nil {
+		w.server.Close()
+		return nil, fmt.Errorf("set webhook: %w", err)
+	}
+	b.webhook.Store(w)
+	slog.Info("Webhook is set", "listen", w.cfg.Listen, "path", w.cfg.Path)
+	// Shutdown мог прийти, пока вебхук устанавливался
+	if b.stopping.Load() {
+		b.stopWebhook()
+	}
+	return w.updates, nil
+}
+
+// ServeHTTP accepts an update if the request carries the secret token.
+func (w *webhookServer) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	token := r.Header.Get(secretTokenHeader)
+	if subtle.ConstantTimeCompare([]byte(token), []byte(w.cfg.SecretToken)) != 1 {
+		slog.Warn("Webhook request with a wrong secret token", "remote", r.RemoteAddr)
+		http.Error(rw, "forbidden", http.StatusForbidden)
+		return
+	}
+	var update tgbotapi.Update
+	if err := json.NewDecoder(http.MaxBytesReader(rw, r.Body, maxUpdateSize)).Decode(&update); err != nil {
+		http.Error(rw, "bad update", http.StatusBadRequest)
+		return
+	}
+	// Telegram повторит запрос, если не получит ответ 200
+	select {
+	case w.updates <- update:
+	case <-w.done:
+		http.Error(rw, "shutting down", http.StatusServiceUnavailable)
+	case <-r.Context().Done():
+	}
+}
+
+// stopWebhook removes the webhook in Telegram and stops the server. Updates sent meanwhile
+// wait in Telegram until the next start. Only the first call does anything.
+// The updates channel is closed only after all handlers returned, a handler still running
+// would send into a closed channel.
+func (b *Bot) stopWebhook() {
+	w := b.webhook.Swap(nil)
+	if w == nil {
+		return
+	}
+	if _, err := b.tg.Request(tgbotapi.DeleteWebhookConfig{}); err != nil {
+		slog.Error("Failed to delete webhook", "err", err)
+	}
+	close(w.done)
+	ctx, cancel := context.WithTimeout(context.Background(), webhookStopTimeout)
+	defer cancel()
+	if err := w.server.Shutdown(ctx); err != nil {
+		slog.Error("Failed to stop webhook server", "err", err)
+		return
+	}
+	close(w.updates)
+}
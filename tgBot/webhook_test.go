@@ -0,0 +1,171 @@
+package tgBot
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// fakeTelegram answers every Bot API method with success.
+type fakeTelegram struct{}
+
+func (fakeTelegram) Do(req *http.Request) (*http.Response, error) {
+	result := "true"
+	if path.Base(req.URL.Path) == "getMe" {
+		result = `{"id":1,"is_bot":true,"first_name":"bot","username":"bot"}`
+	}
+	body := fmt.Sprintf(`{"ok":true,"result":%s}`, result)
+	return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(body)), Header: http.Header{}}, nil
+}
+
+func newWebhookBot(t *testing.T) *Bot {
+	api, err := tgbotapi.NewBotAPIWithClient("1:token", tgbotapi.APIEndpoint, fakeTelegram{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	api.Buffer = 1
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listen := listener.Addr().String()
+	listener.Close()
+	cfg := WebhookConfig{URL: "https://bot.example.com/hook", Listen: listen, SecretToken: "secret"}
+	if err := cfg.setDefaults(); err != nil {
+		t.Fatal(err)
+	}
+	return &Bot{tg: api, cfg: Config{Webhook: cfg}}
+}
+
+func postUpdate(listen string, id int) (int, error) {
+	req, _ := http.NewRequest(http.MethodPost, "http://"+listen+"/hook", bytes.NewBufferString(fmt.Sprintf(`{"update_id":%d}`, id)))
+	req.Header.Set(secretTokenHeader, "secret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+func TestStopWebhookReleasesBlockedHandlers(t *testing.T) {
+	b := newWebhookBot(t)
+	updates, err := b.startWebhook()
+	if err != nil {
+		t.Fatal(err)
+	}
+	listen := b.cfg.Webhook.Listen
+	// Сервер запускается в горутине
+	deadline := time.Now().Add(time.Second)
+	for {
+		status, err := postUpdate(listen, 1)
+		if err == nil && status == http.StatusOK {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("webhook server doesn't answer: %d %v", status, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Буфер полон, этот обработчик ждёт места в канале
+	blocked := make(chan int, 1)
+	go func() {
+		status, _ := postUpdate(listen, 2)
+		blocked <- status
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	b.stopWebhook()
+	select {
+	case status := <-blocked:
+		if status != http.StatusServiceUnavailable {
+			t.Errorf("blocked request got %d, want %d", status, http.StatusServiceUnavailable)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("handler is still blocked after stop")
+	}
+	if u := <-updates; u.UpdateID != 1 {
+		t.Errorf("got update %d, want 1", u.UpdateID)
+	}
+	if _, ok := <-updates; ok {
+		t.Error("updates channel is not closed after a clean stop")
+	}
+	// Повторная остановка ничего не делает
+	b.stopWebhook()
+}
+
+func TestStartWebhookDuringShutdown(t *testing.T) {
+	b := newWebhookBot(t)
+	b.stopping.Store(true)
+	updates, err := b.startWebhook()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.webhook.Load() != nil {
+		t.Error("webhook is kept after shutdown")
+	}
+	select {
+	case _, ok := <-updates:
+		if ok {
+			t.Error("got an update")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("updates channel is not closed")
+	}
+	if _, err := postUpdate(b.cfg.Webhook.Listen, 1); err == nil {
+		t.Error("webhook server still accepts requests")
+	}
+}
+
+func TestServeHTTPChecksSecret(t *testing.T) {
+	w := &webhookServer{
+		cfg:     WebhookConfig{SecretToken: "secret"},
+		updates: make(chan tgbotapi.Update, 1),
+		done:    make(chan struct{}),
+	}
+	tests := []struct {
+		name   string
+		method string
+		secret string
+		body   string
+		want   int
+	}{
+		{"accepted", http.MethodPost, "secret", `{"update_id":1}`, http.StatusOK},
+		{"wrong secret", http.MethodPost, "other", `{"update_id":1}`, http.StatusForbidden},
+		{"no secret", http.MethodPost, "", `{"update_id":1}`, http.StatusForbidden},
+		{"get", http.MethodGet, "secret", "", http.StatusMethodNotAllowed},
+		{"bad body", http.MethodPost, "secret", `{`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequestWithContext(context.Background(), tt.method, "/hook", strings.NewReader(tt.body))
+			if tt.secret != "" {
+				req.Header.Set(secretTokenHeader, tt.secret)
+			}
+			rec := &responseRecorder{header: http.Header{}, status: http.StatusOK}
+			w.ServeHTTP(rec, req)
+			if rec.status != tt.want {
+				t.Errorf("status %d, want %d", rec.status, tt.want)
+			}
+		})
+	}
+}
+
+type responseRecorder struct {
+	header http.Header
+	status int
+}
+
+func (r *responseRecorder) Header() http.Header         { return r.header }
+func (r *responseRecorder) Write(p []byte) (int, error) { return len(p), nil }
+func (r *responseRecorder) WriteHeader(status int)      { r.status = status }